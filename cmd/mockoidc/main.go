@@ -0,0 +1,247 @@
+// cmd/mockoidc/main.go
+//
+// mockoidc is a minimal OpenID Connect provider for exercising the OIDC login
+// flow locally. It approves every authorization request without a login page
+// and signs ID tokens with a throwaway RSA key.
+//
+//	go run ./cmd/mockoidc -addr :9000 -client-id social-experiment
+//
+// The asserted user can be overridden per request by appending mock_sub,
+// mock_email and mock_username to the authorization URL.
+package main
+
+import (
+    "crypto/rand"
+    "crypto/rsa"
+    "crypto/sha256"
+    "crypto/subtle"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "flag"
+    "log"
+    "math/big"
+    "net/http"
+    "net/url"
+    "sync"
+    "time"
+
+    "github.com/dgrijalva/jwt-go"
+)
+
+const keyID = "mock-1"
+
+// authorization is an issued, not yet redeemed authorization code
+type authorization struct {
+    clientID      string
+    redirectURI   string
+    nonce         string
+    codeChallenge string
+    subject       string
+    email         string
+    username      string
+    expiresAt     time.Time
+}
+
+type provider struct {
+    issuer       string
+    clientID     string
+    clientSecret string
+    subject      string
+    email        string
+    username     string
+    key          *rsa.PrivateKey
+
+    mu    sync.Mutex
+    codes map[string]*authorization
+}
+
+func main() {
+    addr := flag.String("addr", ":9000", "listen address")
+    issuer := flag.String("issuer", "http://localhost:9000", "issuer URL")
+    clientID := flag.String("client-id", "social-experiment", "accepted client ID")
+    clientSecret := flag.String("client-secret", "mock-secret", "client secret (empty for public clients)")
+    subject := flag.String("subject", "mock-user-1", "default subject")
+    email := flag.String("email", "mock.user@example.com", "default verified email")
+    username := flag.String("username", "mockuser", "default preferred_username")
+    flag.Parse()
+
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        log.Fatalf("[ERROR] Failed to generate signing key: %v", err)
+    }
+
+    p := &provider{
+        issuer:       *issuer,
+        clientID:     *clientID,
+        clientSecret: *clientSecret,
+        subject:      *subject,
+        email:        *email,
+        username:     *username,
+        key:          key,
+        codes:        make(map[string]*authorization),
+    }
+
+    http.HandleFunc("/.well-known/openid-configuration", p.discovery)
+    http.HandleFunc("/jwks", p.jwks)
+    http.HandleFunc("/authorize", p.authorize)
+    http.HandleFunc("/token", p.token)
+
+    log.Printf("[INFO] Mock OIDC provider %s listening on %s", p.issuer, *addr)
+    log.Fatal(http.ListenAndServe(*addr, nil))
+}
+
+func (p *provider) discovery(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "issuer":                                p.issuer,
+        "authorization_endpoint":                p.issuer + "/authorize",
+        "token_endpoint":                        p.issuer + "/token",
+        "jwks_uri":                              p.issuer + "/jwks",
+        "response_types_supported":              []string{"code"},
+        "subject_types_supported":               []string{"public"},
+        "id_token_signing_alg_values_supported": []string{"RS256"},
+        "code_challenge_methods_supported":      []string{"S256"},
+    })
+}
+
+func (p *provider) jwks(w http.ResponseWriter, r *http.Request) {
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "keys": []map[string]string{{
+            "kty": "RSA",
+            "use": "sig",
+            "alg": "RS256",
+            "kid": keyID,
+            "n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+            "e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+        }},
+    })
+}
+
+// authorize approves the request immediately and redirects back with a code
+func (p *provider) authorize(w http.ResponseWriter, r *http.Request) {
+    q := r.URL.Query()
+    if q.Get("client_id") != p.clientID || q.Get("response_type") != "code" {
+        http.Error(w, "invalid client_id or response_type", http.StatusBadRequest)
+        return
+    }
+    if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+        http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+        return
+    }
+    redirectURI, err := url.Parse(q.Get("redirect_uri"))
+    if err != nil || !redirectURI.IsAbs() {
+        http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+        return
+    }
+
+    auth := &authorization{
+        clientID:      p.clientID,
+        redirectURI:   q.Get("redirect_uri"),
+        nonce:         q.Get("nonce"),
+        codeChallenge: q.Get("code_challenge"),
+        subject:       valueOr(q.Get("mock_sub"), p.subject),
+        email:         valueOr(q.Get("mock_email"), p.email),
+        username:      valueOr(q.Get("mock_username"), p.username),
+        expiresAt:     time.Now().Add(time.Minute),
+    }
+    code := randomString()
+
+    p.mu.Lock()
+    p.codes[code] = auth
+    p.mu.Unlock()
+
+    callback := redirectURI.Query()
+    callback.Set("code", code)
+    callback.Set("state", q.Get("state"))
+    redirectURI.RawQuery = callback.Encode()
+    http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token redeems an authorization code for a signed ID token
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+    if r.Method != http.MethodPost {
+        http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+        return
+    }
+    if err := r.ParseForm(); err != nil {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+        return
+    }
+
+    clientID, clientSecret, ok := r.BasicAuth()
+    if ok {
+        clientID, _ = url.QueryUnescape(clientID)
+        clientSecret, _ = url.QueryUnescape(clientSecret)
+    } else {
+        clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+    }
+    if clientID != p.clientID || subtle.ConstantTimeCompare([]byte(clientSecret), []byte(p.clientSecret)) != 1 {
+        writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+        return
+    }
+    if r.PostForm.Get("grant_type") != "authorization_code" {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+        return
+    }
+
+    p.mu.Lock()
+    auth := p.codes[r.PostForm.Get("code")]
+    delete(p.codes, r.PostForm.Get("code"))
+    p.mu.Unlock()
+
+    if auth == nil || time.Now().After(auth.expiresAt) || auth.redirectURI != r.PostForm.Get("redirect_uri") {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+        return
+    }
+    sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+    if base64.RawURLEncoding.EncodeToString(sum[:]) != auth.codeChallenge {
+        writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+        return
+    }
+
+    now := time.Now()
+    idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+        "iss":                p.issuer,
+        "sub":                auth.subject,
+        "aud":                auth.clientID,
+        "exp":                now.Add(5 * time.Minute).Unix(),
+        "iat":                now.Unix(),
+        "nonce":              auth.nonce,
+        "email":              auth.email,
+        "email_verified":     true,
+        "preferred_username": auth.username,
+    })
+    idToken.Header["kid"] = keyID
+    signed, err := idToken.SignedString(p.key)
+    if err != nil {
+        writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+        return
+    }
+
+    writeJSON(w, http.StatusOK, map[string]interface{}{
+        "access_token": randomString(),
+        "token_type":   "Bearer",
+        "expires_in":   300,
+        "id_token":     signed,
+    })
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+    w.Header().Set("Content-Type", "application/json")
+    w.Header().Set("Cache-Control", "no-store")
+    w.WriteHeader(status)
+    json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+    b := make([]byte, 16)
+    rand.Read(b)
+    return hex.EncodeToString(b)
+}
+
+func valueOr(value, fallback string) string {
+    if value != "" {
+        return value
+    }
+    return fallback
+}
@@ -0,0 +1,128 @@
+// controllers/account.go
+package controllers
+
+import (
+    "context"
+    "io"
+    "log"
+    "net/http"
+    "time"
+
+    "social-experiment/models"
+    "social-experiment/utils"
+    "social-experiment/websocket"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DeleteAccount schedules the authenticated user's account for erasure after
+// the grace period and signs the user out everywhere, revoking personal access
+// tokens and applications. Logging in again before then cancels the deletion.
+// Accounts with a password must confirm it, which is throttled like a login.
+func DeleteAccount(db *mongo.Collection, hasher *utils.PasswordHasher, throttle *utils.LoginThrottle, revocations *utils.RevocationList, issuer *utils.TokenIssuer, personalTokens *utils.PersonalAccessTokenStore, oauth *utils.OAuthServer, hub *websocket.Hub, grace time.Duration) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            Password string `json:"password"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+            log.Printf("[WARNING] Invalid account deletion request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        var user models.User
+        if err := db.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user); err != nil {
+            if err == mongo.ErrNoDocuments {
+                c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+            } else {
+                log.Printf("[ERROR] Error fetching user: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing request"})
+            }
+            return
+        }
+
+        if user.Password != "" {
+            // Wrong passwords count towards the same lockout as failed logins
+            if !reserveLoginAttempt(c, throttle, user.Username) {
+                return
+            }
+            valid, _, err := hasher.Verify(req.Password, user.Password)
+            if err != nil {
+                log.Printf("[ERROR] Error verifying password for user %s: %v", user.Username, err)
+            }
+            if !valid {
+                c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+                return
+            }
+            if err := throttle.RecordSuccess(context.Background(), user.Username, c.ClientIP()); err != nil {
+                log.Printf("[ERROR] Error clearing login failures: %v", err)
+            }
+        }
+
+        // Keep the original date if deletion was already requested
+        err = db.FindOneAndUpdate(context.Background(),
+            bson.M{"_id": userID, "deletion_scheduled_at": nil},
+            bson.M{"$set": bson.M{"deletion_scheduled_at": time.Now().Add(grace)}},
+            options.FindOneAndUpdate().SetReturnDocument(options.After),
+        ).Decode(&user)
+        if err != nil && err != mongo.ErrNoDocuments {
+            log.Printf("[ERROR] Error scheduling account deletion: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting account"})
+            return
+        }
+
+        if err := revokeUserTokens(userID, revocations, issuer, personalTokens, hub); err != nil {
+            log.Printf("[ERROR] Error revoking tokens of deleted account: %v", err)
+        }
+        grantIDs, err := oauth.RevokeUser(context.Background(), userID)
+        if err != nil {
+            log.Printf("[ERROR] Error revoking applications of deleted account: %v", err)
+        }
+        for _, grantID := range grantIDs {
+            hub.DisconnectSession(grantID)
+        }
+
+        log.Printf("[INFO] Account deletion scheduled for %s (UserID: %s)", user.DeletionScheduledAt.Format(time.RFC3339), userID.Hex())
+        c.JSON(http.StatusAccepted, gin.H{
+            "message":               "Account scheduled for deletion. Log in before then to cancel.",
+            "deletion_scheduled_at": user.DeletionScheduledAt,
+        })
+    }
+}
+
+// cancelAccountDeletion cancels a pending deletion when the account's owner
+// logs in. It responds with 410 and returns false if erasure has already begun.
+func cancelAccountDeletion(c *gin.Context, db *mongo.Collection, user *models.User) bool {
+    if user.DeletionScheduledAt == nil {
+        return true
+    }
+
+    result, err := db.UpdateOne(context.Background(),
+        bson.M{"_id": user.ID, "erasure_started_at": nil},
+        bson.M{"$unset": bson.M{"deletion_scheduled_at": ""}},
+    )
+    if err != nil {
+        log.Printf("[ERROR] Error cancelling account deletion: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing request"})
+        return false
+    }
+    if result.MatchedCount == 0 {
+        c.JSON(http.StatusGone, gin.H{"error": "This account is being deleted"})
+        return false
+    }
+
+    log.Printf("[INFO] Account deletion cancelled by login (UserID: %s)", user.ID.Hex())
+    user.DeletionScheduledAt = nil
+    return true
+}
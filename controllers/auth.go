@@ -2,26 +2,38 @@ package controllers
 
 import (
     "context"
+    "errors"
     "log"
+    "math"
     "net/http"
+    "strconv"
     "strings"
     "time"
 
     "social-experiment/models"
     "social-experiment/utils"
+    "social-experiment/websocket"
 
     "github.com/gin-gonic/gin"
     "go.mongodb.org/mongo-driver/bson"
     "go.mongodb.org/mongo-driver/bson/primitive"
     "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// Register handles user registration
-func Register(db *mongo.Collection, jwtSecret string) gin.HandlerFunc {
+// Register handles user registration according to the configured registration mode
+func Register(db *mongo.Collection, invites *mongo.Collection, usernames *utils.UsernamePolicy, policy *utils.PasswordPolicy, hasher *utils.PasswordHasher, issuer *utils.TokenIssuer, accountMailer *utils.AccountMailer, mode string) gin.HandlerFunc {
     return func(c *gin.Context) {
+        if mode == utils.RegistrationClosed {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Registration is closed"})
+            return
+        }
+
         var req struct {
-            Username string `json:"username"`
-            Password string `json:"password"`
+            Username   string `json:"username"`
+            Password   string `json:"password"`
+            Email      string `json:"email"`
+            InviteCode string `json:"invite_code"`
         }
 
         if err := c.ShouldBindJSON(&req); err != nil {
@@ -36,60 +48,130 @@ func Register(db *mongo.Collection, jwtSecret string) gin.HandlerFunc {
             c.JSON(http.StatusBadRequest, gin.H{"error": "Username and password are required"})
             return
         }
+        var ok bool
+        if req.Username, ok = checkUsername(c, usernames, req.Username); !ok {
+            return
+        }
+        if mode == utils.RegistrationVerifyEmail && req.Email == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
+            return
+        }
+        if mode == utils.RegistrationInvite && req.InviteCode == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invite code is required"})
+            return
+        }
+
+        if !checkPasswordPolicy(c, policy, req.Username, req.Password) {
+            return
+        }
 
-        // Check if user exists
-        count, err := db.CountDocuments(context.Background(), bson.M{"username": req.Username})
+        // Check if user exists or the name is reserved for a renamed account
+        taken, err := usernameTaken(db, req.Username, primitive.NilObjectID)
         if err != nil {
             log.Printf("[ERROR] Database error: %v", err)
             c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
             return
         }
-        if count > 0 {
+        if taken {
             c.JSON(http.StatusBadRequest, gin.H{"error": "Username already exists"})
             return
         }
 
+        // Email is optional, but must be valid and not verified by another
+        // account when given
+        if req.Email != "" {
+            req.Email, err = utils.NormalizeEmail(req.Email)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+                return
+            }
+            count, err := db.CountDocuments(context.Background(), bson.M{"email": req.Email, "email_verified": true})
+            if err != nil {
+                log.Printf("[ERROR] Database error: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+                return
+            }
+            if count > 0 {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Email already in use"})
+                return
+            }
+        }
+
         // Hash password
-        hashedPassword, err := utils.HashPassword(req.Password)
+        hashedPassword, err := hasher.Hash(req.Password)
         if err != nil {
             log.Printf("[ERROR] Error hashing password: %v", err)
             c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing password"})
             return
         }
 
+        // Consume an invite use; it is given back if the account cannot be created
+        var invite *models.Invite
+        if mode == utils.RegistrationInvite {
+            invite, err = redeemInvite(invites, req.InviteCode)
+            if err != nil {
+                if err != errInviteInvalid {
+                    log.Printf("[ERROR] Error redeeming invite: %v", err)
+                    c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing invite"})
+                    return
+                }
+                c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired invite code"})
+                return
+            }
+        }
+
         // Create user
         user := models.User{
-            Username:  req.Username,
-            Password:  hashedPassword,
-            CreatedAt: time.Now().Format(time.RFC3339),
+            Username:         req.Username,
+            UsernameKey:      utils.UsernameKey(req.Username),
+            UsernameSkeleton: utils.UsernameSkeleton(req.Username),
+            Password:         hashedPassword,
+            Email:            req.Email,
+            CreatedAt:        time.Now().Format(time.RFC3339),
         }
 
         result, err := db.InsertOne(context.Background(), user)
         if err != nil {
+            if invite != nil {
+                releaseInvite(invites, invite.ID)
+            }
+            if mongo.IsDuplicateKeyError(err) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Username or email already exists"})
+                return
+            }
             log.Printf("[ERROR] Error creating user: %v", err)
             c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating user"})
             return
         }
+        user.ID = result.InsertedID.(primitive.ObjectID)
 
-        // Generate JWT
-        userID := result.InsertedID.(primitive.ObjectID).Hex()
-        token, err := utils.GenerateJWT(userID, jwtSecret)
+        // Ask the user to confirm their email address
+        if user.Email != "" {
+            if err := accountMailer.SendEmailVerification(context.Background(), user); err != nil {
+                log.Printf("[ERROR] Error sending verification email: %v", err)
+            }
+        }
+
+        // Issue access and refresh tokens
+        tokens, err := issuer.Issue(context.Background(), user.ID, sessionInfo(c, ""))
         if err != nil {
             log.Printf("[ERROR] Error generating token: %v", err)
             c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
             return
         }
 
-        c.JSON(http.StatusOK, gin.H{"token": token})
+        c.JSON(http.StatusOK, tokens)
     }
 }
 
-// Login handles user authentication
-func Login(db *mongo.Collection, jwtSecret string) gin.HandlerFunc {
+// Login handles user authentication. Attempts are throttled per username and
+// per client IP, and count as failures unless they succeed.
+func Login(db *mongo.Collection, hasher *utils.PasswordHasher, issuer *utils.TokenIssuer, throttle *utils.LoginThrottle) gin.HandlerFunc {
     return func(c *gin.Context) {
         var req struct {
-            Username string `json:"username"`
-            Password string `json:"password"`
+            Username   string `json:"username"`
+            Password   string `json:"password"`
+            DeviceName string `json:"device_name"`
         }
 
         if err := c.ShouldBindJSON(&req); err != nil {
@@ -105,30 +187,275 @@ func Login(db *mongo.Collection, jwtSecret string) gin.HandlerFunc {
             return
         }
 
+        // Refuse attempts while the username or IP is backing off or locked out
+        if !reserveLoginAttempt(c, throttle, req.Username) {
+            return
+        }
+
         // Find user
-        var user models.User
-        err := db.FindOne(context.Background(), bson.M{"username": req.Username}).Decode(&user)
-        if err != nil {
+        user, err := findUserByUsername(db, req.Username, nil)
+        if err != nil && err != mongo.ErrNoDocuments {
+            log.Printf("[ERROR] Error fetching user: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing request"})
+            return
+        }
+        if err == mongo.ErrNoDocuments {
+            // Spend the same time as a real password check so timing does not reveal accounts
+            hasher.DummyVerify(req.Password)
             log.Printf("[WARNING] User not found: %s", req.Username)
             c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
             return
         }
 
-        // Check password
-        if !utils.CheckPasswordHash(req.Password, user.Password) {
+        // Check password; accounts created through an identity provider may have none
+        if user.Password == "" {
+            hasher.DummyVerify(req.Password)
+            log.Printf("[WARNING] Password login for account without password: %s", req.Username)
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+            return
+        }
+        valid, needsRehash, err := hasher.Verify(req.Password, user.Password)
+        if err != nil {
+            log.Printf("[ERROR] Error verifying password for user %s: %v", req.Username, err)
+        }
+        if !valid {
             log.Printf("[WARNING] Invalid password for user: %s", req.Username)
             c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
             return
         }
 
-        // Generate JWT
-        token, err := utils.GenerateJWT(user.ID.Hex(), jwtSecret)
+        // Upgrade hashes made with an outdated algorithm or parameters while the plaintext is at hand
+        if needsRehash {
+            rehashPassword(db, hasher, user, req.Password)
+        }
+
+        // Accounts with two-factor authentication must complete /login/2fa,
+        // whose attempts are throttled on their own
+        if user.TOTPEnabled {
+            if err := throttle.Release(context.Background(), user.Username, c.ClientIP()); err != nil {
+                log.Printf("[ERROR] Error releasing login attempt: %v", err)
+            }
+            challenge, err := issuer.IssueChallenge(user.ID)
+            if err != nil {
+                log.Printf("[ERROR] Error generating challenge token: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+                return
+            }
+            c.JSON(http.StatusOK, gin.H{"two_factor_required": true, "challenge_token": challenge})
+            return
+        }
+
+        if err := throttle.RecordSuccess(context.Background(), user.Username, c.ClientIP()); err != nil {
+            log.Printf("[ERROR] Error clearing login failures: %v", err)
+        }
+
+        if !cancelAccountDeletion(c, db, user) {
+            return
+        }
+
+        // Issue access and refresh tokens
+        tokens, err := issuer.Issue(context.Background(), user.ID, sessionInfo(c, req.DeviceName))
         if err != nil {
             log.Printf("[ERROR] Error generating token: %v", err)
             c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
             return
         }
 
-        c.JSON(http.StatusOK, gin.H{"token": token})
+        c.JSON(http.StatusOK, tokens)
+    }
+}
+
+// rehashPassword replaces the user's stored hash with one using the preferred
+// algorithm and parameters. Failures are logged and leave the old hash in place.
+func rehashPassword(db *mongo.Collection, hasher *utils.PasswordHasher, user *models.User, password string) {
+    hashedPassword, err := hasher.Hash(password)
+    if err != nil {
+        log.Printf("[ERROR] Error rehashing password: %v", err)
+        return
+    }
+
+    // Match on the old hash so a concurrent password change is not overwritten
+    _, err = db.UpdateOne(context.Background(),
+        bson.M{"_id": user.ID, "password": user.Password},
+        bson.M{"$set": bson.M{"password": hashedPassword}},
+    )
+    if err != nil {
+        log.Printf("[ERROR] Error saving rehashed password: %v", err)
+        return
     }
+    log.Printf("[INFO] Upgraded password hash for user: %s", user.Username)
+}
+
+// reserveLoginAttempt counts an attempt to prove the username's credentials
+// from the client IP before they are checked. It responds with 429 and returns
+// false if the username or the IP must wait before trying again.
+func reserveLoginAttempt(c *gin.Context, throttle *utils.LoginThrottle, username string) bool {
+    wait, err := throttle.Reserve(context.Background(), username, c.ClientIP())
+    if err != nil {
+        log.Printf("[ERROR] Error checking login throttle: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing request"})
+        return false
+    }
+    if wait > 0 {
+        seconds := int(math.Ceil(wait.Seconds()))
+        c.Header("Retry-After", strconv.Itoa(seconds))
+        c.JSON(http.StatusTooManyRequests, gin.H{"error": "Too many failed login attempts, try again later", "retry_after": seconds})
+        return false
+    }
+    return true
+}
+
+// UnlockUser clears the failed login counter and any lockout for a username.
+func UnlockUser(throttle *utils.LoginThrottle) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        unlocked, err := throttle.Unlock(context.Background(), c.Param("username"))
+        if err != nil {
+            log.Printf("[ERROR] Error unlocking user: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unlocking user"})
+            return
+        }
+        if !unlocked {
+            c.JSON(http.StatusNotFound, gin.H{"error": "No lockout found for user"})
+            return
+        }
+
+        log.Printf("[INFO] Login lockout cleared for user: %s (by UserID: %s)", c.Param("username"), c.GetString("userID"))
+        c.Status(http.StatusNoContent)
+    }
+}
+
+// Logout revokes the access token used for the request together with the
+// session it belongs to, and closes the session's sockets. Tokens issued before
+// sessions existed can end their refresh token family by supplying it.
+func Logout(revocations *utils.RevocationList, issuer *utils.TokenIssuer, hub *websocket.Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        claims := c.MustGet("claims").(*utils.Claims)
+
+        var req struct {
+            RefreshToken string `json:"refresh_token"`
+        }
+        // The body is optional; an empty or missing body only revokes the access token
+        if c.Request.ContentLength > 0 {
+            if err := c.ShouldBindJSON(&req); err != nil {
+                log.Printf("[WARNING] Invalid logout request: %v", err)
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+                return
+            }
+        }
+
+        userID, err := primitive.ObjectIDFromHex(claims.UserID)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        if err := revocations.RevokeToken(context.Background(), claims); err != nil {
+            log.Printf("[ERROR] Error revoking token: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error logging out"})
+            return
+        }
+
+        if sessionID, err := primitive.ObjectIDFromHex(claims.SessionID); err == nil {
+            if _, err := endSession(userID, sessionID, revocations, issuer, hub); err != nil {
+                log.Printf("[ERROR] Error revoking session: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error logging out"})
+                return
+            }
+        } else if req.RefreshToken != "" {
+            _, err = issuer.RevokeRefreshToken(context.Background(), req.RefreshToken, userID)
+            if err != nil && err != utils.ErrRefreshTokenInvalid {
+                log.Printf("[ERROR] Error revoking refresh token: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error logging out"})
+                return
+            }
+        }
+
+        hub.DisconnectToken(claims.Id)
+
+        c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+    }
+}
+
+// LogoutAll revokes every access, refresh and personal access token issued to
+// the user and closes all of the user's WebSocket connections.
+func LogoutAll(revocations *utils.RevocationList, issuer *utils.TokenIssuer, personalTokens *utils.PersonalAccessTokenStore, hub *websocket.Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        claims := c.MustGet("claims").(*utils.Claims)
+
+        userID, err := primitive.ObjectIDFromHex(claims.UserID)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        if err := revokeUserTokens(userID, revocations, issuer, personalTokens, hub); err != nil {
+            log.Printf("[ERROR] Error revoking tokens: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error logging out"})
+            return
+        }
+
+        c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions"})
+    }
+}
+
+// revokeUserTokens revokes every access, refresh and personal access token
+// issued to the user and closes all of the user's WebSocket connections.
+func revokeUserTokens(userID primitive.ObjectID, revocations *utils.RevocationList, issuer *utils.TokenIssuer, personalTokens *utils.PersonalAccessTokenStore, hub *websocket.Hub) error {
+    if err := revocations.RevokeUser(context.Background(), userID.Hex()); err != nil {
+        return err
+    }
+    if err := issuer.RevokeUser(context.Background(), userID); err != nil {
+        return err
+    }
+    if err := personalTokens.RevokeUser(context.Background(), userID); err != nil {
+        return err
+    }
+    hub.DisconnectUser(userID.Hex())
+    return nil
+}
+
+// EnsureUserIndexes creates the indexes the auth handlers rely on
+func EnsureUserIndexes(db *mongo.Collection) error {
+    // Email addresses used to be unique whether verified or not, which let
+    // anyone block the owner of an address by claiming it first
+    if _, err := db.Indexes().DropOne(context.Background(), "email_1"); err != nil {
+        var cmdErr mongo.CommandError
+        if !errors.As(err, &cmdErr) || (cmdErr.Code != 26 && cmdErr.Code != 27) {
+            return err
+        }
+    }
+
+    _, err := db.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+        {
+            // Only verified addresses are unique; unverified ones are claims
+            // that the first account to verify wins
+            Keys: bson.D{{Key: "email", Value: 1}},
+            Options: options.Index().
+                SetName("email_verified_unique").
+                SetUnique(true).
+                SetPartialFilterExpression(bson.M{"email": bson.M{"$type": "string"}, "email_verified": true}),
+        },
+        {
+            Keys: bson.D{{Key: "identities.provider", Value: 1}, {Key: "identities.subject", Value: 1}},
+            Options: options.Index().
+                SetUnique(true).
+                SetPartialFilterExpression(bson.M{"identities": bson.M{"$exists": true}}),
+        },
+        {
+            Keys: bson.D{{Key: "username", Value: 1}},
+        },
+        {
+            Keys: bson.D{{Key: "username_key", Value: 1}},
+        },
+        {
+            Keys: bson.D{{Key: "username_skeleton", Value: 1}},
+            Options: options.Index().
+                SetUnique(true).
+                SetPartialFilterExpression(bson.M{"username_skeleton": bson.M{"$type": "string"}}),
+        },
+        {
+            Keys: bson.D{{Key: "previous_usernames.skeleton", Value: 1}},
+        },
+    })
+    return err
 }
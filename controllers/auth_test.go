@@ -0,0 +1,93 @@
+// controllers/auth_test.go
+package controllers
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "sync"
+    "testing"
+    "time"
+
+    "social-experiment/utils"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLoginThrottlesConcurrentAttempts(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    db := testDatabase(t)
+
+    config := utils.Config{
+        JWTSecret:             "test-secret",
+        AccessTokenTTL:        time.Minute,
+        RefreshTokenTTL:       time.Hour,
+        LoginMaxFailures:      5,
+        LoginIPMaxFailures:    1000,
+        LoginLockoutDuration:  time.Minute,
+        LoginBackoffBase:      time.Nanosecond,
+        PasswordHashAlgorithm: "bcrypt",
+        Argon2Memory:          64,
+        Argon2Time:            1,
+        Argon2Parallelism:     1,
+        BcryptCost:            4,
+    }
+    keys, err := utils.LoadKeyRing(config)
+    if err != nil {
+        t.Fatal(err)
+    }
+    hasher, err := utils.NewPasswordHasher(config)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    users := db.Collection("users")
+    issuer := utils.NewTokenIssuer(keys, config.AccessTokenTTL, utils.NewRefreshTokenStore(db.Collection("refresh_tokens"), config.RefreshTokenTTL), utils.NewSessionStore(db.Collection("sessions"), config.RefreshTokenTTL), users)
+    throttle := utils.NewLoginThrottle(db.Collection("login_attempts"), config)
+
+    hashed, err := hasher.Hash("correct password")
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, err = users.InsertOne(context.Background(), bson.M{"username": "alice", "username_key": utils.UsernameKey("alice"), "password": hashed})
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    router := gin.New()
+    router.POST("/login", Login(users, hasher, issuer, throttle))
+
+    // Only attempts that get past the throttle reach the password check and
+    // are answered with 401
+    const attempts = 30
+    statuses := make(chan int, attempts)
+    var wg sync.WaitGroup
+    for i := 0; i < attempts; i++ {
+        wg.Add(1)
+        go func() {
+            defer wg.Done()
+            body, _ := json.Marshal(gin.H{"username": "alice", "password": "wrong password"})
+            req := httptest.NewRequest(http.MethodPost, "/login", bytes.NewReader(body))
+            req.Header.Set("Content-Type", "application/json")
+            w := httptest.NewRecorder()
+            router.ServeHTTP(w, req)
+            statuses <- w.Code
+        }()
+    }
+    wg.Wait()
+    close(statuses)
+
+    counts := make(map[int]int)
+    for status := range statuses {
+        counts[status]++
+    }
+    if counts[http.StatusUnauthorized] == 0 || counts[http.StatusUnauthorized] > config.LoginMaxFailures {
+        t.Errorf("%d attempts reached the password check, want 1 to %d", counts[http.StatusUnauthorized], config.LoginMaxFailures)
+    }
+    if counts[http.StatusUnauthorized]+counts[http.StatusTooManyRequests] != attempts {
+        t.Errorf("unexpected responses: %v", counts)
+    }
+}
@@ -0,0 +1,129 @@
+// controllers/data_export.go
+package controllers
+
+import (
+    "context"
+    "log"
+    "net/http"
+
+    "social-experiment/models"
+    "social-experiment/utils"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RequestDataExport queues an archive of everything stored about the
+// authenticated user. If an export is already under way, it is returned instead.
+func RequestDataExport(exporter *utils.DataExporter) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        export, created, err := exporter.Request(context.Background(), userID)
+        if err != nil {
+            log.Printf("[ERROR] Error requesting data export: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error requesting export"})
+            return
+        }
+
+        if created {
+            log.Printf("[INFO] Data export requested (UserID: %s)", userID.Hex())
+        }
+        c.JSON(http.StatusAccepted, export)
+    }
+}
+
+// ListDataExports returns the authenticated user's exports that have not expired.
+func ListDataExports(exporter *utils.DataExporter) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        exports, err := exporter.List(context.Background(), userID)
+        if err != nil {
+            log.Printf("[ERROR] Error listing data exports: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching exports"})
+            return
+        }
+
+        c.JSON(http.StatusOK, exports)
+    }
+}
+
+// GetDataExport returns the status of one of the authenticated user's exports.
+// Once it is ready, the response carries a short-lived download URL.
+func GetDataExport(exporter *utils.DataExporter) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        exportID, err := primitive.ObjectIDFromHex(c.Param("id"))
+        if err != nil {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+            return
+        }
+
+        export, err := exporter.Get(context.Background(), userID, exportID)
+        if err == utils.ErrDataExportNotFound {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Export not found"})
+            return
+        }
+        if err != nil {
+            log.Printf("[ERROR] Error fetching data export: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching export"})
+            return
+        }
+
+        if export.Status != utils.DataExportReady {
+            c.JSON(http.StatusOK, export)
+            return
+        }
+
+        downloadURL, expiresAt, err := exporter.DownloadURL(export)
+        if err != nil {
+            log.Printf("[ERROR] Error signing data export download: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching export"})
+            return
+        }
+
+        c.Header("Cache-Control", "no-store")
+        c.JSON(http.StatusOK, struct {
+            *models.DataExport
+            DownloadURL       string `json:"download_url"`
+            DownloadExpiresAt int64  `json:"download_expires_at"`
+        }{export, downloadURL, expiresAt.Unix()})
+    }
+}
+
+// DownloadDataExport streams the archive of an export to whoever holds a valid
+// download URL, so that it can be opened directly in the browser.
+func DownloadDataExport(exporter *utils.DataExporter) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        file, err := exporter.OpenDownload(context.Background(), c.Param("id"), c.Query("token"))
+        if err == utils.ErrDataExportNotFound {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Export not found or download link expired"})
+            return
+        }
+        if err != nil {
+            log.Printf("[ERROR] Error opening data export: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error downloading export"})
+            return
+        }
+        defer file.Close()
+
+        c.Header("Cache-Control", "no-store")
+        c.DataFromReader(http.StatusOK, file.GetFile().Length, "application/zip", file, map[string]string{
+            "Content-Disposition": `attachment; filename="social-experiment-export.zip"`,
+        })
+    }
+}
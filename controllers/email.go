@@ -0,0 +1,131 @@
+// controllers/email.go
+package controllers
+
+import (
+    "context"
+    "log"
+    "net/http"
+
+    "social-experiment/models"
+    "social-experiment/utils"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UpdateEmail sets a new, unverified email address for the current user and
+// sends a verification link to it. The address only becomes the user's own,
+// and unavailable to other accounts, once it is verified.
+func UpdateEmail(db *mongo.Collection, accountMailer *utils.AccountMailer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            Email string `json:"email" binding:"required"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid email update request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        email, err := utils.NormalizeEmail(req.Email)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+            return
+        }
+
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        count, err := db.CountDocuments(context.Background(), bson.M{"_id": bson.M{"$ne": userID}, "email": email, "email_verified": true})
+        if err != nil {
+            log.Printf("[ERROR] Database error: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+            return
+        }
+        if count > 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Email already in use"})
+            return
+        }
+
+        var user models.User
+        err = db.FindOneAndUpdate(context.Background(),
+            bson.M{"_id": userID},
+            bson.M{"$set": bson.M{"email": email, "email_verified": false}},
+            options.FindOneAndUpdate().SetReturnDocument(options.After),
+        ).Decode(&user)
+        if err != nil {
+            if mongo.IsDuplicateKeyError(err) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Email already in use"})
+            } else if err == mongo.ErrNoDocuments {
+                c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+            } else {
+                log.Printf("[ERROR] Error updating email: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating email"})
+            }
+            return
+        }
+
+        if err := accountMailer.SendEmailVerification(context.Background(), user); err != nil {
+            log.Printf("[ERROR] Error sending verification email: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sending verification email"})
+            return
+        }
+
+        c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+    }
+}
+
+// VerifyEmail redeems an email verification token.
+func VerifyEmail(db *mongo.Collection, tokens *utils.ActionTokenStore) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            Token string `json:"token" binding:"required"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid email verification request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        record, err := tokens.Consume(context.Background(), utils.PurposeEmailVerification, req.Token)
+        if err != nil {
+            if err != utils.ErrActionTokenInvalid {
+                log.Printf("[ERROR] Error redeeming verification token: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing request"})
+                return
+            }
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+            return
+        }
+
+        // The address must not have changed since the link was sent, and the
+        // unique index rejects it if another account verified it first
+        result, err := db.UpdateOne(context.Background(),
+            bson.M{"_id": record.UserID, "email": record.Email},
+            bson.M{"$set": bson.M{"email_verified": true}},
+        )
+        if mongo.IsDuplicateKeyError(err) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Email already in use"})
+            return
+        }
+        if err != nil {
+            log.Printf("[ERROR] Error verifying email: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error verifying email"})
+            return
+        }
+        if result.MatchedCount == 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+            return
+        }
+
+        c.JSON(http.StatusOK, gin.H{"message": "Email verified"})
+    }
+}
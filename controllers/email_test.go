@@ -0,0 +1,89 @@
+// controllers/email_test.go
+package controllers
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "testing"
+    "time"
+
+    "social-experiment/utils"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// discardMailer accepts every message without delivering it.
+type discardMailer struct{}
+
+func (discardMailer) Send(to, subject, body string) error { return nil }
+
+func TestUnverifiedEmailDoesNotBlockOwner(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    db := testDatabase(t)
+
+    users := db.Collection("users")
+    if err := EnsureUserIndexes(users); err != nil {
+        t.Fatal(err)
+    }
+    tokens := utils.NewActionTokenStore(db.Collection("action_tokens"))
+    accountMailer := utils.NewAccountMailer(discardMailer{}, tokens, utils.Config{AppBaseURL: "http://localhost:4200", EmailVerificationTTL: time.Hour})
+
+    squatterID := primitive.NewObjectID()
+    ownerID := primitive.NewObjectID()
+    _, err := users.InsertMany(context.Background(), []interface{}{
+        bson.M{"_id": squatterID, "username": "mallory", "email": "alice@example.com", "email_verified": false},
+        bson.M{"_id": ownerID, "username": "alice"},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    router := gin.New()
+    router.POST("/me/email", func(c *gin.Context) {
+        c.Set("userID", ownerID.Hex())
+    }, UpdateEmail(users, accountMailer))
+    router.POST("/email/verify", VerifyEmail(users, tokens))
+
+    post := func(path string, body gin.H) *httptest.ResponseRecorder {
+        encoded, _ := json.Marshal(body)
+        req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(encoded))
+        req.Header.Set("Content-Type", "application/json")
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, req)
+        return w
+    }
+
+    // Both accounts were sent a verification link; the squatter's link
+    // predates the owner's change
+    squatterToken, err := tokens.Issue(context.Background(), utils.PurposeEmailVerification, squatterID, "alice@example.com", time.Hour)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if w := post("/me/email", gin.H{"email": "alice@example.com"}); w.Code != http.StatusAccepted {
+        t.Fatalf("update email: status %d: %s", w.Code, w.Body.String())
+    }
+    ownerToken, err := tokens.Issue(context.Background(), utils.PurposeEmailVerification, ownerID, "alice@example.com", time.Hour)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if w := post("/email/verify", gin.H{"token": ownerToken}); w.Code != http.StatusOK {
+        t.Fatalf("owner verification: status %d: %s", w.Code, w.Body.String())
+    }
+    if w := post("/email/verify", gin.H{"token": squatterToken}); w.Code != http.StatusBadRequest {
+        t.Errorf("squatter verification: status %d, want %d", w.Code, http.StatusBadRequest)
+    }
+
+    count, err := users.CountDocuments(context.Background(), bson.M{"email": "alice@example.com", "email_verified": true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if count != 1 {
+        t.Errorf("%d accounts verified the address, want 1", count)
+    }
+}
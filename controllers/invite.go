@@ -0,0 +1,179 @@
+// controllers/invite.go
+package controllers
+
+import (
+    "context"
+    "errors"
+    "log"
+    "net/http"
+    "time"
+
+    "social-experiment/models"
+    "social-experiment/utils"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var errInviteInvalid = errors.New("invalid invite code")
+
+// CreateInvite mints a new invite code. The code is only returned in this response.
+func CreateInvite(db *mongo.Collection) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            MaxUses   int    `json:"max_uses"`
+            ExpiresIn string `json:"expires_in"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid invite request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        if req.MaxUses == 0 {
+            req.MaxUses = 1
+        }
+        if req.MaxUses < 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "max_uses must be positive"})
+            return
+        }
+
+        var expiresAt *time.Time
+        if req.ExpiresIn != "" {
+            ttl, err := time.ParseDuration(req.ExpiresIn)
+            if err != nil || ttl <= 0 {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in must be a positive duration such as \"72h\""})
+                return
+            }
+            t := time.Now().Add(ttl)
+            expiresAt = &t
+        }
+
+        createdBy, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        code, err := utils.GenerateOpaqueToken()
+        if err != nil {
+            log.Printf("[ERROR] Error generating invite code: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating invite"})
+            return
+        }
+
+        invite := models.Invite{
+            ID:         primitive.NewObjectID(),
+            CodeHash:   utils.HashToken(code),
+            CodePrefix: code[:6],
+            CreatedBy:  createdBy,
+            CreatedAt:  time.Now(),
+            ExpiresAt:  expiresAt,
+            MaxUses:    req.MaxUses,
+        }
+
+        if _, err := db.InsertOne(context.Background(), invite); err != nil {
+            log.Printf("[ERROR] Error creating invite: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating invite"})
+            return
+        }
+
+        c.JSON(http.StatusCreated, gin.H{"code": code, "invite": invite})
+    }
+}
+
+// ListInvites returns all invites, newest first.
+func ListInvites(db *mongo.Collection) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+        cursor, err := db.Find(context.Background(), bson.M{}, findOptions)
+        if err != nil {
+            log.Printf("[ERROR] Error fetching invites: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching invites"})
+            return
+        }
+        defer cursor.Close(context.Background())
+
+        invites := []models.Invite{}
+        if err := cursor.All(context.Background(), &invites); err != nil {
+            log.Printf("[ERROR] Error decoding invites: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding invites"})
+            return
+        }
+
+        c.JSON(http.StatusOK, invites)
+    }
+}
+
+// RevokeInvite prevents further use of an invite.
+func RevokeInvite(db *mongo.Collection) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        inviteID, err := primitive.ObjectIDFromHex(c.Param("id"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite ID"})
+            return
+        }
+
+        result, err := db.UpdateOne(context.Background(),
+            bson.M{"_id": inviteID, "revoked_at": nil},
+            bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+        )
+        if err != nil {
+            log.Printf("[ERROR] Error revoking invite: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking invite"})
+            return
+        }
+        if result.MatchedCount == 0 {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+            return
+        }
+
+        c.Status(http.StatusNoContent)
+    }
+}
+
+// redeemInvite atomically consumes one use of a valid invite code.
+func redeemInvite(db *mongo.Collection, code string) (*models.Invite, error) {
+    now := time.Now()
+    var invite models.Invite
+    err := db.FindOneAndUpdate(context.Background(),
+        bson.M{
+            "code_hash":  utils.HashToken(code),
+            "revoked_at": nil,
+            "$or": []bson.M{
+                {"expires_at": nil},
+                {"expires_at": bson.M{"$gt": now}},
+            },
+            "$expr": bson.M{"$lt": bson.A{"$uses", "$max_uses"}},
+        },
+        bson.M{"$inc": bson.M{"uses": 1}},
+    ).Decode(&invite)
+    if err == mongo.ErrNoDocuments {
+        return nil, errInviteInvalid
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &invite, nil
+}
+
+// releaseInvite gives back a use consumed by a registration that then failed.
+func releaseInvite(db *mongo.Collection, inviteID primitive.ObjectID) {
+    _, err := db.UpdateOne(context.Background(), bson.M{"_id": inviteID}, bson.M{"$inc": bson.M{"uses": -1}})
+    if err != nil {
+        log.Printf("[ERROR] Error releasing invite use: %v", err)
+    }
+}
+
+// EnsureInviteIndexes creates the index used to look up invite codes
+func EnsureInviteIndexes(db *mongo.Collection) error {
+    _, err := db.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+        Keys:    bson.D{{Key: "code_hash", Value: 1}},
+        Options: options.Index().SetUnique(true),
+    })
+    return err
+}
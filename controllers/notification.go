@@ -0,0 +1,209 @@
+// controllers/notification.go
+package controllers
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "time"
+
+    "social-experiment/models"
+    "social-experiment/utils"
+    "social-experiment/websocket"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// notificationPage is one page of a user's notifications, newest first.
+type notificationPage struct {
+    Notifications []models.Notification `json:"notifications"`
+    Unread        int64                 `json:"unread"`
+    Next          string                `json:"next,omitempty"`
+}
+
+// ListNotifications handles retrieving a page of the authenticated user's
+// notifications, newest first, with the number still unread.
+func ListNotifications(db *mongo.Collection, users *mongo.Collection, posts *mongo.Collection) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        limit, cursor, ok := parsePageRequest(c)
+        if !ok {
+            return
+        }
+        if cursor != nil && cursor.Newer {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+            return
+        }
+
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        filter := bson.M{"user_id": userID}
+        if cursor != nil {
+            filter = bson.M{"$and": []bson.M{filter, cursor.Filter()}}
+        }
+        results, err := db.Find(context.Background(), filter,
+            options.Find().SetSort(utils.NewestFirst()).SetLimit(int64(limit+1)),
+        )
+        if err != nil {
+            log.Printf("[ERROR] Error fetching notifications: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching notifications"})
+            return
+        }
+        page := notificationPage{Notifications: []models.Notification{}}
+        if err := results.All(context.Background(), &page.Notifications); err != nil {
+            log.Printf("[ERROR] Error decoding notifications: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching notifications"})
+            return
+        }
+
+        var next *utils.PageCursor
+        if len(page.Notifications) > limit {
+            page.Notifications = page.Notifications[:limit]
+            last := page.Notifications[limit-1]
+            next = &utils.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+        }
+
+        if err := attachNotificationDetails(users, posts, page.Notifications); err != nil {
+            log.Printf("[ERROR] Error fetching notification details: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching notifications"})
+            return
+        }
+
+        page.Unread, err = db.CountDocuments(context.Background(), bson.M{"user_id": userID, "read_at": nil})
+        if err != nil {
+            log.Printf("[ERROR] Error counting unread notifications: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching notifications"})
+            return
+        }
+
+        page.Next, _ = setPageLinks(c, next, nil)
+        c.JSON(http.StatusOK, page)
+    }
+}
+
+// MarkNotificationsRead handles marking the authenticated user's
+// notifications as read: those listed in ids, or all of them.
+func MarkNotificationsRead(db *mongo.Collection) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            IDs []string `json:"ids"`
+        }
+
+        // The body is optional
+        if c.Request.ContentLength != 0 {
+            if err := c.ShouldBindJSON(&req); err != nil {
+                log.Printf("[WARNING] Invalid notifications request: %v", err)
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+                return
+            }
+        }
+
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        filter := bson.M{"user_id": userID, "read_at": nil}
+        if len(req.IDs) > 0 {
+            ids := make([]primitive.ObjectID, 0, len(req.IDs))
+            for _, hex := range req.IDs {
+                id, err := primitive.ObjectIDFromHex(hex)
+                if err != nil {
+                    c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID"})
+                    return
+                }
+                ids = append(ids, id)
+            }
+            filter["_id"] = bson.M{"$in": ids}
+        }
+
+        _, err = db.UpdateMany(context.Background(), filter, bson.M{"$set": bson.M{"read_at": time.Now()}})
+        if err != nil {
+            log.Printf("[ERROR] Error marking notifications read: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating notifications"})
+            return
+        }
+
+        c.Status(http.StatusNoContent)
+    }
+}
+
+// notify tells a user about a post another user made that involves them,
+// saving the notification and pushing it to the user's open connections.
+// The post must carry its author.
+func notify(db *mongo.Collection, hub *websocket.Hub, recipient primitive.ObjectID, notificationType string, post models.Post) {
+    notification := models.Notification{
+        ID:        primitive.NewObjectID(),
+        UserID:    recipient,
+        Type:      notificationType,
+        ActorID:   post.UserID,
+        PostID:    post.ID,
+        CreatedAt: post.CreatedAt,
+    }
+    if _, err := db.InsertOne(context.Background(), notification); err != nil {
+        log.Printf("[ERROR] Error saving %s notification for user %s: %v", notificationType, recipient.Hex(), err)
+        return
+    }
+
+    notification.Actor = post.Author
+    notification.Post = &post
+    hub.SendNotification(notification)
+}
+
+// attachNotificationDetails fills in the actor and post of each notification
+// with one query each.
+func attachNotificationDetails(users *mongo.Collection, posts *mongo.Collection, notifications []models.Notification) error {
+    if len(notifications) == 0 {
+        return nil
+    }
+    actorIDs := make([]primitive.ObjectID, 0, len(notifications))
+    postIDs := make([]primitive.ObjectID, 0, len(notifications))
+    for _, notification := range notifications {
+        actorIDs = append(actorIDs, notification.ActorID)
+        postIDs = append(postIDs, notification.PostID)
+    }
+
+    actors, err := findAuthors(users, actorIDs)
+    if err != nil {
+        return err
+    }
+
+    cursor, err := posts.Find(context.Background(), bson.M{"_id": bson.M{"$in": postIDs}})
+    if err != nil {
+        return err
+    }
+    var found []models.Post
+    if err := cursor.All(context.Background(), &found); err != nil {
+        return err
+    }
+    byID := make(map[primitive.ObjectID]*models.Post, len(found))
+    for i := range found {
+        found[i].Author = actors[found[i].UserID]
+        byID[found[i].ID] = &found[i]
+    }
+
+    for i := range notifications {
+        notifications[i].Actor = actors[notifications[i].ActorID]
+        notifications[i].Post = byID[notifications[i].PostID]
+    }
+    return nil
+}
+
+// EnsureNotificationIndexes creates the indexes notifications are listed and
+// cleaned up by.
+func EnsureNotificationIndexes(db *mongo.Collection) error {
+    _, err := db.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+        {Keys: bson.D{{Key: "post_id", Value: 1}}},
+        {Keys: bson.D{{Key: "actor_id", Value: 1}}},
+    })
+    return err
+}
@@ -0,0 +1,455 @@
+// controllers/oauth.go
+package controllers
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "net/url"
+    "strings"
+    "unicode/utf8"
+
+    "social-experiment/models"
+    "social-experiment/utils"
+    "social-experiment/websocket"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+    // maxClientNameLength caps the name shown to users on the consent screen
+    maxClientNameLength = 100
+    // maxRedirectURIs caps the redirect URIs a client can register
+    maxRedirectURIs = 10
+)
+
+// RegisterOAuthClient registers a third-party application owned by the
+// authenticated user. The secret of a confidential client is only returned in
+// this response.
+func RegisterOAuthClient(oauth *utils.OAuthServer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            Name         string   `json:"name"`
+            RedirectURIs []string `json:"redirect_uris"`
+            Scopes       []string `json:"scopes"`
+            Confidential bool     `json:"confidential"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid OAuth client request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        req.Name = strings.TrimSpace(req.Name)
+        if req.Name == "" || utf8.RuneCountInString(req.Name) > maxClientNameLength {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required and must be at most 100 characters"})
+            return
+        }
+
+        if len(req.RedirectURIs) == 0 || len(req.RedirectURIs) > maxRedirectURIs {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Between 1 and 10 redirect URIs are required"})
+            return
+        }
+        for _, redirectURI := range req.RedirectURIs {
+            if err := utils.ValidateRedirectURI(redirectURI); err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+                return
+            }
+        }
+
+        scopes, err := utils.NormalizeScopes(req.Scopes)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        if len(scopes) == 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "At least one scope is required", "scopes": utils.KnownScopes})
+            return
+        }
+
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        secret, client, err := oauth.RegisterClient(context.Background(), userID, req.Name, req.RedirectURIs, scopes, req.Confidential)
+        if err != nil {
+            log.Printf("[ERROR] Error registering OAuth client: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error registering client"})
+            return
+        }
+
+        response := gin.H{"client": client}
+        if secret != "" {
+            response["client_secret"] = secret
+        }
+        c.JSON(http.StatusCreated, response)
+    }
+}
+
+// ListOAuthClients returns the applications the authenticated user registered.
+func ListOAuthClients(oauth *utils.OAuthServer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        clients, err := oauth.ListClients(context.Background(), userID)
+        if err != nil {
+            log.Printf("[ERROR] Error fetching OAuth clients: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching clients"})
+            return
+        }
+
+        c.JSON(http.StatusOK, clients)
+    }
+}
+
+// DeleteOAuthClient deletes one of the authenticated user's applications,
+// revoking every token issued to it and closing its WebSocket connections.
+func DeleteOAuthClient(oauth *utils.OAuthServer, hub *websocket.Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+        clientID, err := primitive.ObjectIDFromHex(c.Param("id"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+            return
+        }
+
+        grantIDs, deleted, err := oauth.DeleteClient(context.Background(), userID, clientID)
+        if err != nil {
+            log.Printf("[ERROR] Error deleting OAuth client: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting client"})
+            return
+        }
+        if !deleted {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Client not found"})
+            return
+        }
+
+        for _, grantID := range grantIDs {
+            hub.DisconnectSession(grantID)
+        }
+
+        c.Status(http.StatusNoContent)
+    }
+}
+
+// GetOAuthAuthorization validates an authorization request on behalf of the
+// consent screen and describes what the client asks for. consent_required is
+// false when the user already granted every requested scope.
+func GetOAuthAuthorization(oauth *utils.OAuthServer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req utils.OAuthAuthorizationRequest
+        if err := c.ShouldBindQuery(&req); err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        client, scopes, err := oauth.ValidateAuthorization(context.Background(), &req)
+        if err != nil {
+            authorizationError(c, client, &req, err)
+            return
+        }
+
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        consented, err := oauth.HasConsent(context.Background(), userID, client.ID, scopes)
+        if err != nil {
+            log.Printf("[ERROR] Error checking OAuth consent: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing authorization"})
+            return
+        }
+
+        c.JSON(http.StatusOK, gin.H{
+            "client":           gin.H{"client_id": client.ID.Hex(), "name": client.Name},
+            "scopes":           scopes,
+            "consent_required": !consented,
+        })
+    }
+}
+
+// AuthorizeOAuthClient records the user's decision on an authorization request
+// and returns the URL to send the user back to the client with.
+func AuthorizeOAuthClient(oauth *utils.OAuthServer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            utils.OAuthAuthorizationRequest
+            Approve bool `json:"approve"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid authorization request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        client, scopes, err := oauth.ValidateAuthorization(context.Background(), &req.OAuthAuthorizationRequest)
+        if err != nil {
+            authorizationError(c, client, &req.OAuthAuthorizationRequest, err)
+            return
+        }
+
+        params := url.Values{}
+        if req.State != "" {
+            params.Set("state", req.State)
+        }
+        if !req.Approve {
+            params.Set("error", utils.OAuthAccessDenied)
+            params.Set("error_description", "The user denied the request")
+            c.JSON(http.StatusOK, gin.H{"redirect_to": utils.OAuthRedirectURL(req.RedirectURI, params)})
+            return
+        }
+
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        code, err := oauth.Authorize(context.Background(), userID, client, &req.OAuthAuthorizationRequest, scopes)
+        if err != nil {
+            log.Printf("[ERROR] Error authorizing OAuth client: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing authorization"})
+            return
+        }
+
+        params.Set("code", code)
+        c.JSON(http.StatusOK, gin.H{"redirect_to": utils.OAuthRedirectURL(req.RedirectURI, params)})
+    }
+}
+
+// authorizationError reports an invalid authorization request. Once the client
+// and redirect URI are known to be valid, the response also carries the URL
+// that reports the error back to the client.
+func authorizationError(c *gin.Context, client *models.OAuthClient, req *utils.OAuthAuthorizationRequest, err error) {
+    oauthErr, ok := err.(*utils.OAuthError)
+    if !ok {
+        log.Printf("[ERROR] Error validating authorization request: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing authorization"})
+        return
+    }
+
+    response := gin.H{"error": oauthErr.Description, "code": oauthErr.Code}
+    if client != nil {
+        params := url.Values{}
+        params.Set("error", oauthErr.Code)
+        params.Set("error_description", oauthErr.Description)
+        if req.State != "" {
+            params.Set("state", req.State)
+        }
+        response["redirect_to"] = utils.OAuthRedirectURL(req.RedirectURI, params)
+    }
+    c.JSON(http.StatusBadRequest, response)
+}
+
+// OAuthToken is the token endpoint. Clients redeem authorization codes and
+// rotate refresh tokens with form-encoded requests.
+func OAuthToken(oauth *utils.OAuthServer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.Header("Cache-Control", "no-store")
+        c.Header("Pragma", "no-cache")
+
+        client, ok := authenticateOAuthClient(c, oauth)
+        if !ok {
+            return
+        }
+
+        var (
+            tokens *utils.OAuthTokenResponse
+            err    error
+        )
+        switch c.PostForm("grant_type") {
+        case "authorization_code":
+            tokens, err = oauth.ExchangeCode(context.Background(), client, c.PostForm("code"), c.PostForm("redirect_uri"), c.PostForm("code_verifier"))
+        case "refresh_token":
+            tokens, err = oauth.Refresh(context.Background(), client, c.PostForm("refresh_token"))
+        default:
+            err = &utils.OAuthError{Code: utils.OAuthUnsupportedGrantType, Description: "Supported grant types are authorization_code and refresh_token"}
+        }
+        if err != nil {
+            writeOAuthError(c, err)
+            return
+        }
+
+        c.JSON(http.StatusOK, tokens)
+    }
+}
+
+// IntrospectOAuthToken tells a client whether one of its tokens is active (RFC 7662).
+func IntrospectOAuthToken(oauth *utils.OAuthServer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        client, ok := authenticateOAuthClient(c, oauth)
+        if !ok {
+            return
+        }
+
+        token := c.PostForm("token")
+        if token == "" {
+            writeOAuthError(c, &utils.OAuthError{Code: utils.OAuthInvalidRequest, Description: "token is required"})
+            return
+        }
+
+        introspection, err := oauth.Introspect(context.Background(), client, token)
+        if err != nil {
+            writeOAuthError(c, err)
+            return
+        }
+
+        c.JSON(http.StatusOK, introspection)
+    }
+}
+
+// RevokeOAuthToken lets a client revoke one of its tokens (RFC 7009). Revoking
+// a refresh token ends the whole grant. Unknown tokens are not an error.
+func RevokeOAuthToken(oauth *utils.OAuthServer, hub *websocket.Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        client, ok := authenticateOAuthClient(c, oauth)
+        if !ok {
+            return
+        }
+
+        token := c.PostForm("token")
+        if token == "" {
+            writeOAuthError(c, &utils.OAuthError{Code: utils.OAuthInvalidRequest, Description: "token is required"})
+            return
+        }
+
+        revokeAccess := func() (bool, error) {
+            tokenID, revoked, err := oauth.RevokeAccessToken(context.Background(), client, token)
+            if revoked {
+                hub.DisconnectToken(tokenID)
+            }
+            return revoked, err
+        }
+        revokeRefresh := func() (bool, error) {
+            grantID, revoked, err := oauth.RevokeRefreshToken(context.Background(), client, token)
+            if revoked {
+                hub.DisconnectSession(grantID)
+            }
+            return revoked, err
+        }
+
+        // The hint only decides which kind of token is tried first
+        attempts := []func() (bool, error){revokeAccess, revokeRefresh}
+        if c.PostForm("token_type_hint") == "refresh_token" {
+            attempts = []func() (bool, error){revokeRefresh, revokeAccess}
+        }
+        for _, attempt := range attempts {
+            revoked, err := attempt()
+            if err != nil {
+                writeOAuthError(c, err)
+                return
+            }
+            if revoked {
+                break
+            }
+        }
+
+        c.Status(http.StatusOK)
+    }
+}
+
+// ListOAuthGrants returns the applications the authenticated user has authorized.
+func ListOAuthGrants(oauth *utils.OAuthServer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        grants, err := oauth.ListGrants(context.Background(), userID)
+        if err != nil {
+            log.Printf("[ERROR] Error fetching OAuth grants: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching authorized applications"})
+            return
+        }
+
+        c.JSON(http.StatusOK, grants)
+    }
+}
+
+// RevokeOAuthGrant withdraws the authenticated user's consent for an
+// application, revoking its tokens and closing its WebSocket connections.
+func RevokeOAuthGrant(oauth *utils.OAuthServer, hub *websocket.Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+        clientID, err := primitive.ObjectIDFromHex(c.Param("client_id"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid client ID"})
+            return
+        }
+
+        grantID, revoked, err := oauth.RevokeGrant(context.Background(), userID, clientID)
+        if err != nil {
+            log.Printf("[ERROR] Error revoking OAuth grant: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking authorization"})
+            return
+        }
+        if !revoked {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Application is not authorized"})
+            return
+        }
+
+        hub.DisconnectSession(grantID)
+
+        c.Status(http.StatusNoContent)
+    }
+}
+
+// authenticateOAuthClient authenticates the client with HTTP Basic credentials
+// or client_id and client_secret form fields and writes an error response on failure.
+func authenticateOAuthClient(c *gin.Context, oauth *utils.OAuthServer) (*models.OAuthClient, bool) {
+    clientID, secret, basic := c.Request.BasicAuth()
+    if basic {
+        // Credentials are form-encoded before being put into the header (RFC 6749 section 2.3.1)
+        clientID, _ = url.QueryUnescape(clientID)
+        secret, _ = url.QueryUnescape(secret)
+    } else {
+        clientID, secret = c.PostForm("client_id"), c.PostForm("client_secret")
+    }
+
+    client, err := oauth.AuthenticateClient(context.Background(), clientID, secret)
+    if err != nil {
+        if basic {
+            c.Header("WWW-Authenticate", `Basic realm="oauth"`)
+        }
+        writeOAuthError(c, err)
+        return nil, false
+    }
+    return client, true
+}
+
+// writeOAuthError writes an error response in the format OAuth clients expect.
+func writeOAuthError(c *gin.Context, err error) {
+    oauthErr, ok := err.(*utils.OAuthError)
+    if !ok {
+        log.Printf("[ERROR] Error processing OAuth request: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "server_error"})
+        return
+    }
+
+    status := http.StatusBadRequest
+    if oauthErr.Code == utils.OAuthInvalidClient {
+        status = http.StatusUnauthorized
+    }
+    c.JSON(status, gin.H{"error": oauthErr.Code, "error_description": oauthErr.Description})
+}
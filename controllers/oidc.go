@@ -0,0 +1,445 @@
+// controllers/oidc.go
+package controllers
+
+import (
+    "context"
+    "errors"
+    "fmt"
+    "log"
+    "math/rand"
+    "net/http"
+    "regexp"
+    "sort"
+    "strings"
+    "time"
+
+    "social-experiment/models"
+    "social-experiment/utils"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// usernameDisallowed matches characters stripped from provider-suggested usernames
+var usernameDisallowed = regexp.MustCompile(`[^a-zA-Z0-9_]+`)
+
+// errIdentityEmailTaken is returned when a provider identity's email address
+// belongs to an account it may not sign in to on its own.
+var errIdentityEmailTaken = errors.New("email address belongs to another account")
+
+// ListOIDCProviders returns the names of the identity providers users can sign in with.
+func ListOIDCProviders(providers map[string]*utils.OIDCProvider) gin.HandlerFunc {
+    names := make([]string, 0, len(providers))
+    for name := range providers {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+
+    return func(c *gin.Context) {
+        c.JSON(http.StatusOK, gin.H{"providers": names})
+    }
+}
+
+// StartOIDCLogin begins signing in with an identity provider and returns the
+// URL to send the user to.
+func StartOIDCLogin(providers map[string]*utils.OIDCProvider, states *utils.OIDCStateStore) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        startOIDC(c, providers, states, nil)
+    }
+}
+
+// StartOIDCLink begins linking an identity provider to the authenticated
+// user's account and returns the URL to send the user to.
+func StartOIDCLink(providers map[string]*utils.OIDCProvider, states *utils.OIDCStateStore) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+        startOIDC(c, providers, states, &userID)
+    }
+}
+
+func startOIDC(c *gin.Context, providers map[string]*utils.OIDCProvider, states *utils.OIDCStateStore, linkUserID *primitive.ObjectID) {
+    provider, ok := providers[c.Param("provider")]
+    if !ok {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+        return
+    }
+
+    auth, err := states.Create(context.Background(), provider.Name, linkUserID)
+    if err != nil {
+        log.Printf("[ERROR] Error creating OIDC state: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error starting sign-in"})
+        return
+    }
+
+    authorizationURL, err := provider.AuthorizationURL(context.Background(), auth)
+    if err != nil {
+        log.Printf("[ERROR] Error discovering OIDC provider %s: %v", provider.Name, err)
+        c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"authorization_url": authorizationURL, "state": auth.State, "binding": auth.Binding})
+}
+
+// OIDCCallback completes a sign-in or link started with StartOIDCLogin or
+// StartOIDCLink. The frontend passes on the code and state the provider
+// redirected back with, and the binding it kept from the start. Links must be
+// completed on an authenticated route by the user who started them. Sign-ins log into the account linked to the provider
+// identity, link to an account with the same verified email if the provider is
+// trusted with email addresses, or create a new account if the registration
+// mode allows it. Every link is recorded in the audit log.
+func OIDCCallback(db *mongo.Collection, invites *mongo.Collection, usernames *utils.UsernamePolicy, providers map[string]*utils.OIDCProvider, states *utils.OIDCStateStore, issuer *utils.TokenIssuer, audit *utils.AuditLog, mode string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            Code       string `json:"code" binding:"required"`
+            State      string `json:"state" binding:"required"`
+            Binding    string `json:"binding" binding:"required"`
+            InviteCode string `json:"invite_code"`
+            DeviceName string `json:"device_name"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid OIDC callback request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        provider, ok := providers[c.Param("provider")]
+        if !ok {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Unknown identity provider"})
+            return
+        }
+
+        var linkUserID *primitive.ObjectID
+        if c.GetString("userID") != "" {
+            userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+                return
+            }
+            linkUserID = &userID
+        }
+
+        state, err := states.Consume(context.Background(), provider.Name, req.State, req.Binding, linkUserID)
+        if err != nil {
+            if err != utils.ErrOIDCStateInvalid {
+                log.Printf("[ERROR] Error fetching OIDC state: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing sign-in"})
+                return
+            }
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in request expired, please try again"})
+            return
+        }
+
+        identity, err := provider.Exchange(context.Background(), req.Code, state.CodeVerifier, state.Nonce)
+        if err != nil {
+            log.Printf("[WARNING] OIDC sign-in with %s failed: %v", provider.Name, err)
+            if errors.Is(err, utils.ErrOIDCProviderUnavailable) {
+                c.JSON(http.StatusBadGateway, gin.H{"error": "Identity provider is unavailable"})
+                return
+            }
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "Sign-in with identity provider failed"})
+            return
+        }
+
+        if state.UserID != nil {
+            linkIdentity(c, db, audit, *state.UserID, identity)
+            return
+        }
+
+        user, err := findUserByIdentity(db, audit, provider, identity)
+        if err == errIdentityEmailTaken {
+            c.JSON(http.StatusConflict, gin.H{"error": "An account with this email address already exists. Sign in to it and link the identity provider from your settings."})
+            return
+        }
+        if err != nil && err != mongo.ErrNoDocuments {
+            log.Printf("[ERROR] Error fetching user: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing sign-in"})
+            return
+        }
+        if err == mongo.ErrNoDocuments {
+            user, ok = createOIDCUser(c, db, invites, usernames, identity, req.InviteCode, mode)
+            if !ok {
+                return
+            }
+        }
+
+        // Accounts with two-factor authentication must complete /login/2fa
+        if user.TOTPEnabled {
+            challenge, err := issuer.IssueChallenge(user.ID)
+            if err != nil {
+                log.Printf("[ERROR] Error generating challenge token: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+                return
+            }
+            c.JSON(http.StatusOK, gin.H{"two_factor_required": true, "challenge_token": challenge})
+            return
+        }
+
+        if !cancelAccountDeletion(c, db, user) {
+            return
+        }
+
+        tokens, err := issuer.Issue(context.Background(), user.ID, sessionInfo(c, req.DeviceName))
+        if err != nil {
+            log.Printf("[ERROR] Error generating token: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+            return
+        }
+
+        c.JSON(http.StatusOK, tokens)
+    }
+}
+
+// UnlinkIdentity removes a provider from the authenticated user's account. The
+// last sign-in method of an account without a password cannot be removed.
+func UnlinkIdentity(db *mongo.Collection) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        user, ok := currentUser(c, db)
+        if !ok {
+            return
+        }
+
+        provider := c.Param("provider")
+        linked := false
+        for _, identity := range user.Identities {
+            if identity.Provider == provider {
+                linked = true
+            }
+        }
+        if !linked {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Identity provider is not linked"})
+            return
+        }
+        if user.Password == "" && len(user.Identities) == 1 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Set a password before removing your only sign-in method"})
+            return
+        }
+
+        _, err := db.UpdateOne(context.Background(),
+            bson.M{"_id": user.ID},
+            bson.M{"$pull": bson.M{"identities": bson.M{"provider": provider}}},
+        )
+        if err != nil {
+            log.Printf("[ERROR] Error unlinking identity: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error unlinking identity provider"})
+            return
+        }
+
+        c.Status(http.StatusNoContent)
+    }
+}
+
+// findUserByIdentity returns the user linked to the provider identity or, when
+// the provider vouches for the email address and is trusted with email
+// addresses, the user with the same verified email, which is then linked.
+// Untrusted providers get errIdentityEmailTaken for such an account instead.
+func findUserByIdentity(db *mongo.Collection, audit *utils.AuditLog, provider *utils.OIDCProvider, identity *utils.OIDCIdentity) (*models.User, error) {
+    var user models.User
+    err := db.FindOne(context.Background(), bson.M{
+        "identities": bson.M{"$elemMatch": bson.M{"provider": identity.Provider, "subject": identity.Subject}},
+    }).Decode(&user)
+    if err != mongo.ErrNoDocuments {
+        return &user, err
+    }
+
+    if !identity.EmailVerified || identity.Email == "" {
+        return nil, mongo.ErrNoDocuments
+    }
+    email, err := utils.NormalizeEmail(identity.Email)
+    if err != nil {
+        return nil, mongo.ErrNoDocuments
+    }
+
+    err = db.FindOne(context.Background(), bson.M{"email": email, "email_verified": true}).Decode(&user)
+    if err != nil {
+        return nil, err
+    }
+    if !provider.TrustsEmail() {
+        return nil, errIdentityEmailTaken
+    }
+    _, err = db.UpdateOne(context.Background(),
+        bson.M{"_id": user.ID},
+        bson.M{"$push": bson.M{"identities": newIdentity(identity)}},
+    )
+    if err != nil {
+        return nil, err
+    }
+    log.Printf("[INFO] Linked %s identity to user %s by verified email", identity.Provider, user.Username)
+    recordIdentityLinked(audit, user.ID, identity, "verified_email")
+    return &user, nil
+}
+
+// linkIdentity attaches the provider identity to the user who started the link.
+func linkIdentity(c *gin.Context, db *mongo.Collection, audit *utils.AuditLog, userID primitive.ObjectID, identity *utils.OIDCIdentity) {
+    count, err := db.CountDocuments(context.Background(), bson.M{
+        "identities": bson.M{"$elemMatch": bson.M{"provider": identity.Provider, "subject": identity.Subject}},
+    })
+    if err != nil {
+        log.Printf("[ERROR] Database error: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+        return
+    }
+    if count > 0 {
+        c.JSON(http.StatusConflict, gin.H{"error": "This account is already linked to a user"})
+        return
+    }
+
+    // Replace any earlier link to the same provider
+    _, err = db.UpdateOne(context.Background(),
+        bson.M{"_id": userID},
+        bson.M{"$pull": bson.M{"identities": bson.M{"provider": identity.Provider}}},
+    )
+    if err == nil {
+        _, err = db.UpdateOne(context.Background(),
+            bson.M{"_id": userID},
+            bson.M{"$push": bson.M{"identities": newIdentity(identity)}},
+        )
+    }
+    if err != nil {
+        log.Printf("[ERROR] Error linking identity: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error linking identity provider"})
+        return
+    }
+    recordIdentityLinked(audit, userID, identity, "user")
+
+    c.JSON(http.StatusOK, gin.H{"message": "Identity provider linked", "provider": identity.Provider})
+}
+
+// recordIdentityLinked writes an audit entry for a provider identity linked to
+// the user, either by the user or by a matching verified email.
+func recordIdentityLinked(audit *utils.AuditLog, userID primitive.ObjectID, identity *utils.OIDCIdentity, method string) {
+    err := audit.Record(context.Background(), utils.AuditIdentityLinked, userID, bson.M{
+        "provider": identity.Provider,
+        "subject":  identity.Subject,
+        "method":   method,
+    })
+    if err != nil {
+        log.Printf("[ERROR] Error recording identity link for user %s: %v", userID.Hex(), err)
+    }
+}
+
+// createOIDCUser registers a new account for a provider identity, subject to
+// the registration mode. Provider-verified email addresses are trusted.
+func createOIDCUser(c *gin.Context, db *mongo.Collection, invites *mongo.Collection, usernames *utils.UsernamePolicy, identity *utils.OIDCIdentity, inviteCode string, mode string) (*models.User, bool) {
+    switch mode {
+    case utils.RegistrationClosed:
+        c.JSON(http.StatusForbidden, gin.H{"error": "Registration is closed"})
+        return nil, false
+    case utils.RegistrationVerifyEmail:
+        if !identity.EmailVerified || identity.Email == "" {
+            c.JSON(http.StatusForbidden, gin.H{"error": "A verified email address is required"})
+            return nil, false
+        }
+    case utils.RegistrationInvite:
+        if inviteCode == "" {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Invite code is required"})
+            return nil, false
+        }
+    }
+
+    user := models.User{
+        Identities: []models.Identity{newIdentity(identity)},
+        CreatedAt:  time.Now().Format(time.RFC3339),
+    }
+
+    // Keep the provider's email unless another account already verified it
+    if email, err := utils.NormalizeEmail(identity.Email); err == nil && identity.EmailVerified {
+        count, err := db.CountDocuments(context.Background(), bson.M{"email": email, "email_verified": true})
+        if err == nil && count == 0 {
+            user.Email = email
+            user.EmailVerified = true
+        }
+    }
+
+    username, err := availableUsername(db, usernames, identity)
+    if err != nil {
+        log.Printf("[ERROR] Error choosing username: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating user"})
+        return nil, false
+    }
+    user.Username = username
+    user.UsernameKey = utils.UsernameKey(username)
+    user.UsernameSkeleton = utils.UsernameSkeleton(username)
+
+    var invite *models.Invite
+    if mode == utils.RegistrationInvite {
+        invite, err = redeemInvite(invites, inviteCode)
+        if err != nil {
+            if err != errInviteInvalid {
+                log.Printf("[ERROR] Error redeeming invite: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing invite"})
+                return nil, false
+            }
+            c.JSON(http.StatusForbidden, gin.H{"error": "Invalid or expired invite code"})
+            return nil, false
+        }
+    }
+
+    result, err := db.InsertOne(context.Background(), user)
+    if mongo.IsDuplicateKeyError(err) && user.Email != "" {
+        // Another account may have verified the address since it was checked
+        user.Email = ""
+        user.EmailVerified = false
+        result, err = db.InsertOne(context.Background(), user)
+    }
+    if err != nil {
+        if invite != nil {
+            releaseInvite(invites, invite.ID)
+        }
+        log.Printf("[ERROR] Error creating user: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating user"})
+        return nil, false
+    }
+    user.ID = result.InsertedID.(primitive.ObjectID)
+
+    log.Printf("[INFO] Created user %s from %s identity", user.Username, identity.Provider)
+    return &user, true
+}
+
+// availableUsername derives an unused username from the provider's suggestion
+// or the email address, adding a numeric suffix when it is taken or reserved.
+func availableUsername(db *mongo.Collection, usernames *utils.UsernamePolicy, identity *utils.OIDCIdentity) (string, error) {
+    base := identity.PreferredUsername
+    if base == "" {
+        base = strings.SplitN(identity.Email, "@", 2)[0]
+    }
+    base = usernameDisallowed.ReplaceAllString(base, "")
+    if len(base) > 20 {
+        base = base[:20]
+    }
+    base = strings.Trim(base, "_")
+    if len(base) < 3 {
+        base = "user"
+    }
+
+    candidate := base
+    for attempt := 0; attempt < 10; attempt++ {
+        if _, err := usernames.Validate(candidate); err == nil {
+            taken, err := usernameTaken(db, candidate, primitive.NilObjectID)
+            if err != nil {
+                return "", err
+            }
+            if !taken {
+                return candidate, nil
+            }
+        }
+        candidate = fmt.Sprintf("%s%d", base, 1000+rand.Intn(9000))
+    }
+    return "", errors.New("no available username found")
+}
+
+func newIdentity(identity *utils.OIDCIdentity) models.Identity {
+    return models.Identity{
+        Provider: identity.Provider,
+        Subject:  identity.Subject,
+        Email:    identity.Email,
+        LinkedAt: time.Now(),
+    }
+}
@@ -0,0 +1,327 @@
+// controllers/oidc_test.go
+package controllers
+
+import (
+    "bytes"
+    "context"
+    "crypto/rand"
+    "crypto/rsa"
+    "encoding/base64"
+    "encoding/json"
+    "math/big"
+    "net/http"
+    "net/http/httptest"
+    "net/url"
+    "sync"
+    "testing"
+    "time"
+
+    "social-experiment/models"
+    "social-experiment/utils"
+
+    "github.com/dgrijalva/jwt-go"
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// mockOIDCProvider is an identity provider that asserts a fixed identity with
+// a verified email address for every code it was told about.
+type mockOIDCProvider struct {
+    server   *httptest.Server
+    key      *rsa.PrivateKey
+    clientID string
+    subject  string
+    email    string
+
+    mu     sync.Mutex
+    nonces map[string]string
+}
+
+func newMockOIDCProvider(t *testing.T, subject, email string) *mockOIDCProvider {
+    t.Helper()
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatal(err)
+    }
+    p := &mockOIDCProvider{key: key, clientID: "social-experiment", subject: subject, email: email, nonces: make(map[string]string)}
+
+    mux := http.NewServeMux()
+    mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+        json.NewEncoder(w).Encode(map[string]string{
+            "issuer":                 p.server.URL,
+            "authorization_endpoint": p.server.URL + "/authorize",
+            "token_endpoint":         p.server.URL + "/token",
+            "jwks_uri":               p.server.URL + "/jwks",
+        })
+    })
+    mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+        json.NewEncoder(w).Encode(map[string]interface{}{
+            "keys": []map[string]string{{
+                "kty": "RSA",
+                "alg": "RS256",
+                "kid": "test",
+                "n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+                "e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+            }},
+        })
+    })
+    mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+        r.ParseForm()
+        p.mu.Lock()
+        nonce, ok := p.nonces[r.PostForm.Get("code")]
+        p.mu.Unlock()
+        if !ok {
+            w.WriteHeader(http.StatusBadRequest)
+            json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+            return
+        }
+
+        idToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+            "iss":            p.server.URL,
+            "sub":            p.subject,
+            "aud":            p.clientID,
+            "exp":            time.Now().Add(time.Minute).Unix(),
+            "iat":            time.Now().Unix(),
+            "nonce":          nonce,
+            "email":          p.email,
+            "email_verified": true,
+        })
+        idToken.Header["kid"] = "test"
+        signed, err := idToken.SignedString(key)
+        if err != nil {
+            w.WriteHeader(http.StatusInternalServerError)
+            return
+        }
+        json.NewEncoder(w).Encode(map[string]string{"id_token": signed})
+    })
+    p.server = httptest.NewServer(mux)
+    t.Cleanup(p.server.Close)
+    return p
+}
+
+// approve returns a code for the sign-in the authorization URL asks for.
+func (p *mockOIDCProvider) approve(t *testing.T, authorizationURL string) string {
+    t.Helper()
+    parsed, err := url.Parse(authorizationURL)
+    if err != nil {
+        t.Fatal(err)
+    }
+    code := primitive.NewObjectID().Hex()
+    p.mu.Lock()
+    p.nonces[code] = parsed.Query().Get("nonce")
+    p.mu.Unlock()
+    return code
+}
+
+func TestOIDCCallbackEmailLinking(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+
+    for _, tt := range []struct {
+        name    string
+        trusted bool
+        status  int
+        linked  bool
+    }{
+        {"untrusted provider", false, http.StatusConflict, false},
+        {"trusted provider", true, http.StatusOK, true},
+    } {
+        t.Run(tt.name, func(t *testing.T) {
+            db := testDatabase(t)
+            provider := newMockOIDCProvider(t, "idp-subject", "alice@example.com")
+
+            config := utils.Config{
+                JWTSecret:       "test-secret",
+                AppBaseURL:      "http://localhost:4200",
+                AccessTokenTTL:  time.Minute,
+                RefreshTokenTTL: time.Hour,
+                OIDCProviders: []utils.OIDCProviderConfig{{
+                    Name:       "mock",
+                    Issuer:     provider.server.URL,
+                    ClientID:   provider.clientID,
+                    Scopes:     []string{"openid", "email"},
+                    TrustEmail: tt.trusted,
+                }},
+            }
+            keys, err := utils.LoadKeyRing(config)
+            if err != nil {
+                t.Fatal(err)
+            }
+            users := db.Collection("users")
+            auditEvents := db.Collection("audit_log")
+            issuer := utils.NewTokenIssuer(keys, config.AccessTokenTTL, utils.NewRefreshTokenStore(db.Collection("refresh_tokens"), config.RefreshTokenTTL), utils.NewSessionStore(db.Collection("sessions"), config.RefreshTokenTTL), users)
+            providers := utils.NewOIDCProviders(config)
+            states := utils.NewOIDCStateStore(db.Collection("oidc_states"))
+
+            userID := primitive.NewObjectID()
+            _, err = users.InsertOne(context.Background(), bson.M{"_id": userID, "username": "alice", "email": "alice@example.com", "email_verified": true})
+            if err != nil {
+                t.Fatal(err)
+            }
+
+            router := gin.New()
+            router.POST("/auth/oidc/:provider/start", StartOIDCLogin(providers, states))
+            router.POST("/auth/oidc/:provider/callback", OIDCCallback(users, db.Collection("invites"), utils.NewUsernamePolicy(config), providers, states, issuer, utils.NewAuditLog(auditEvents), utils.RegistrationOpen))
+
+            w := httptest.NewRecorder()
+            router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/auth/oidc/mock/start", nil))
+            if w.Code != http.StatusOK {
+                t.Fatalf("start: status %d: %s", w.Code, w.Body.String())
+            }
+            var start struct {
+                AuthorizationURL string `json:"authorization_url"`
+                State            string `json:"state"`
+                Binding          string `json:"binding"`
+            }
+            if err := json.Unmarshal(w.Body.Bytes(), &start); err != nil {
+                t.Fatal(err)
+            }
+
+            body, _ := json.Marshal(gin.H{"code": provider.approve(t, start.AuthorizationURL), "state": start.State, "binding": start.Binding})
+            req := httptest.NewRequest(http.MethodPost, "/auth/oidc/mock/callback", bytes.NewReader(body))
+            req.Header.Set("Content-Type", "application/json")
+            w = httptest.NewRecorder()
+            router.ServeHTTP(w, req)
+            if w.Code != tt.status {
+                t.Fatalf("callback: status %d, want %d: %s", w.Code, tt.status, w.Body.String())
+            }
+
+            var user models.User
+            if err := users.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user); err != nil {
+                t.Fatal(err)
+            }
+            if linked := len(user.Identities) == 1 && user.Identities[0].Subject == "idp-subject"; linked != tt.linked {
+                t.Errorf("identity linked = %v, want %v", linked, tt.linked)
+            }
+            count, err := users.CountDocuments(context.Background(), bson.M{})
+            if err != nil {
+                t.Fatal(err)
+            }
+            if count != 1 {
+                t.Errorf("%d users exist, want 1", count)
+            }
+
+            audited, err := auditEvents.CountDocuments(context.Background(), bson.M{"event": utils.AuditIdentityLinked, "user_id": userID})
+            if err != nil {
+                t.Fatal(err)
+            }
+            if (audited == 1) != tt.linked {
+                t.Errorf("%d identity link audit entries, linked = %v", audited, tt.linked)
+            }
+        })
+    }
+}
+
+func TestOIDCCallbackBoundToStarter(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    db := testDatabase(t)
+    provider := newMockOIDCProvider(t, "idp-subject", "alice@example.com")
+
+    config := utils.Config{
+        JWTSecret:       "test-secret",
+        AppBaseURL:      "http://localhost:4200",
+        AccessTokenTTL:  time.Minute,
+        RefreshTokenTTL: time.Hour,
+        OIDCProviders: []utils.OIDCProviderConfig{{
+            Name:     "mock",
+            Issuer:   provider.server.URL,
+            ClientID: provider.clientID,
+            Scopes:   []string{"openid", "email"},
+        }},
+    }
+    keys, err := utils.LoadKeyRing(config)
+    if err != nil {
+        t.Fatal(err)
+    }
+    users := db.Collection("users")
+    issuer := utils.NewTokenIssuer(keys, config.AccessTokenTTL, utils.NewRefreshTokenStore(db.Collection("refresh_tokens"), config.RefreshTokenTTL), utils.NewSessionStore(db.Collection("sessions"), config.RefreshTokenTTL), users)
+    providers := utils.NewOIDCProviders(config)
+    states := utils.NewOIDCStateStore(db.Collection("oidc_states"))
+
+    aliceID := primitive.NewObjectID()
+    malloryID := primitive.NewObjectID()
+    _, err = users.InsertMany(context.Background(), []interface{}{
+        bson.M{"_id": aliceID, "username": "alice"},
+        bson.M{"_id": malloryID, "username": "mallory"},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // The X-User header stands in for the authentication middleware
+    authenticated := func(c *gin.Context) {
+        if userID := c.GetHeader("X-User"); userID != "" {
+            c.Set("userID", userID)
+        }
+    }
+    callback := OIDCCallback(users, db.Collection("invites"), utils.NewUsernamePolicy(config), providers, states, issuer, utils.NewAuditLog(db.Collection("audit_log")), utils.RegistrationOpen)
+    router := gin.New()
+    router.POST("/auth/oidc/:provider/start", StartOIDCLogin(providers, states))
+    router.POST("/auth/oidc/:provider/callback", callback)
+    router.POST("/me/identities/:provider", authenticated, StartOIDCLink(providers, states))
+    router.POST("/me/identities/:provider/callback", authenticated, callback)
+
+    start := func(path string, userID primitive.ObjectID) (code, state, binding string) {
+        req := httptest.NewRequest(http.MethodPost, path, nil)
+        if !userID.IsZero() {
+            req.Header.Set("X-User", userID.Hex())
+        }
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, req)
+        if w.Code != http.StatusOK {
+            t.Fatalf("start: status %d: %s", w.Code, w.Body.String())
+        }
+        var res struct {
+            AuthorizationURL string `json:"authorization_url"`
+            State            string `json:"state"`
+            Binding          string `json:"binding"`
+        }
+        if err := json.Unmarshal(w.Body.Bytes(), &res); err != nil {
+            t.Fatal(err)
+        }
+        return provider.approve(t, res.AuthorizationURL), res.State, res.Binding
+    }
+    complete := func(path string, userID primitive.ObjectID, code, state, binding string) int {
+        body, _ := json.Marshal(gin.H{"code": code, "state": state, "binding": binding})
+        req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+        req.Header.Set("Content-Type", "application/json")
+        if !userID.IsZero() {
+            req.Header.Set("X-User", userID.Hex())
+        }
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, req)
+        return w.Code
+    }
+
+    // A sign-in started by one browser cannot be completed by another
+    code, state, _ := start("/auth/oidc/mock/start", primitive.NilObjectID)
+    if status := complete("/auth/oidc/mock/callback", primitive.NilObjectID, code, state, "another browser"); status != http.StatusBadRequest {
+        t.Errorf("sign-in without the binding: status %d, want %d", status, http.StatusBadRequest)
+    }
+
+    // A link can only be completed by the user who started it
+    code, state, binding := start("/me/identities/mock", aliceID)
+    for _, tt := range []struct {
+        name   string
+        path   string
+        userID primitive.ObjectID
+    }{
+        {"unauthenticated", "/auth/oidc/mock/callback", primitive.NilObjectID},
+        {"another user", "/me/identities/mock/callback", malloryID},
+    } {
+        if status := complete(tt.path, tt.userID, code, state, binding); status != http.StatusBadRequest {
+            t.Errorf("link completed by %s: status %d, want %d", tt.name, status, http.StatusBadRequest)
+        }
+    }
+    if status := complete("/me/identities/mock/callback", aliceID, code, state, binding); status != http.StatusOK {
+        t.Errorf("link completed by the user who started it: status %d, want %d", status, http.StatusOK)
+    }
+
+    linked, err := users.CountDocuments(context.Background(), bson.M{"identities.subject": "idp-subject"})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if linked != 1 {
+        t.Errorf("identity linked to %d accounts, want 1", linked)
+    }
+}
@@ -0,0 +1,121 @@
+// controllers/pagination.go
+package controllers
+
+import (
+    "context"
+    "fmt"
+    "net/http"
+    "strings"
+
+    "social-experiment/models"
+    "social-experiment/utils"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// postPage is one page of a list of posts with the cursors of its neighbours.
+// Next leads to older posts; Prev leads to newer ones and is given even if
+// there are none yet, so clients can poll it.
+type postPage struct {
+    Posts []models.Post `json:"posts"`
+    Next  string        `json:"next,omitempty"`
+    Prev  string        `json:"prev,omitempty"`
+}
+
+// parsePageRequest reads the limit and cursor parameters, responding with 400
+// and returning false if they are invalid.
+func parsePageRequest(c *gin.Context) (int, *utils.PageCursor, bool) {
+    limit, err := utils.ParsePageSize(c.Query("limit"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+        return 0, nil, false
+    }
+
+    var cursor *utils.PageCursor
+    if raw := c.Query("cursor"); raw != "" {
+        cursor, err = utils.ParsePageCursor(raw)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+            return 0, nil, false
+        }
+    }
+    return limit, cursor, true
+}
+
+// findPostPage reads the page of posts matching all conditions at the cursor,
+// newest first, and returns the cursors of the pages before and after it.
+func findPostPage(db *mongo.Collection, conditions []bson.M, cursor *utils.PageCursor, limit int) ([]models.Post, *utils.PageCursor, *utils.PageCursor, error) {
+    sort := utils.NewestFirst()
+    if cursor != nil {
+        conditions = append(conditions, cursor.Filter())
+        sort = cursor.Sort()
+    }
+    filter := bson.M{}
+    if len(conditions) > 0 {
+        filter = bson.M{"$and": conditions}
+    }
+
+    // Read one extra post to learn whether another page follows
+    results, err := db.Find(context.Background(), filter, options.Find().SetSort(sort).SetLimit(int64(limit+1)))
+    if err != nil {
+        return nil, nil, nil, err
+    }
+    posts := []models.Post{}
+    if err := results.All(context.Background(), &posts); err != nil {
+        return nil, nil, nil, err
+    }
+
+    more := len(posts) > limit
+    if more {
+        posts = posts[:limit]
+    }
+    newer := cursor != nil && cursor.Newer
+    if newer {
+        for i, j := 0, len(posts)-1; i < j; i, j = i+1, j-1 {
+            posts[i], posts[j] = posts[j], posts[i]
+        }
+    }
+
+    if len(posts) == 0 {
+        // Nothing newer yet: poll from the same position
+        if newer {
+            return posts, nil, cursor, nil
+        }
+        return posts, nil, nil, nil
+    }
+
+    first, last := posts[0], posts[len(posts)-1]
+    prev := &utils.PageCursor{CreatedAt: first.CreatedAt, ID: first.ID, Newer: true}
+    var next *utils.PageCursor
+    if more || newer {
+        next = &utils.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+    }
+    return posts, next, prev, nil
+}
+
+// setPageLinks sets Link headers to the pages at the given cursors, keeping
+// the other query parameters, and returns the encoded cursors.
+func setPageLinks(c *gin.Context, next, prev *utils.PageCursor) (string, string) {
+    var links []string
+    encoded := make(map[string]string)
+    for _, link := range []struct {
+        rel    string
+        cursor *utils.PageCursor
+    }{{"next", next}, {"prev", prev}} {
+        if link.cursor == nil {
+            continue
+        }
+        encoded[link.rel] = link.cursor.Encode()
+
+        query := c.Request.URL.Query()
+        query.Set("cursor", encoded[link.rel])
+        links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, c.Request.URL.Path, query.Encode(), link.rel))
+    }
+    if len(links) > 0 {
+        c.Header("Link", strings.Join(links, ", "))
+    }
+    return encoded["next"], encoded["prev"]
+}
@@ -0,0 +1,234 @@
+// controllers/password.go
+package controllers
+
+import (
+    "context"
+    "log"
+    "net/http"
+
+    "social-experiment/models"
+    "social-experiment/utils"
+    "social-experiment/websocket"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// ForgotPassword emails a password reset link to the account with the given
+// verified address. The response is identical whether or not the account exists.
+func ForgotPassword(db *mongo.Collection, accountMailer *utils.AccountMailer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            Email string `json:"email" binding:"required"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid forgot password request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        email, err := utils.NormalizeEmail(req.Email)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email address"})
+            return
+        }
+
+        // Look up and mail in the background so response timing does not reveal accounts
+        go func() {
+            var user models.User
+            err := db.FindOne(context.Background(), bson.M{"email": email, "email_verified": true}).Decode(&user)
+            if err != nil {
+                if err != mongo.ErrNoDocuments {
+                    log.Printf("[ERROR] Error fetching user: %v", err)
+                }
+                return
+            }
+            if err := accountMailer.SendPasswordReset(context.Background(), user); err != nil {
+                log.Printf("[ERROR] Error sending password reset email: %v", err)
+            }
+        }()
+
+        c.JSON(http.StatusAccepted, gin.H{"message": "If an account with that email exists, a reset link has been sent"})
+    }
+}
+
+// ResetPassword redeems a password reset token, sets the new password and
+// revokes every existing session and personal access token of the account.
+func ResetPassword(db *mongo.Collection, policy *utils.PasswordPolicy, hasher *utils.PasswordHasher, tokens *utils.ActionTokenStore, revocations *utils.RevocationList, issuer *utils.TokenIssuer, personalTokens *utils.PersonalAccessTokenStore, hub *websocket.Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            Token    string `json:"token" binding:"required"`
+            Password string `json:"password" binding:"required"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid password reset request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        // Check the new password before consuming the token so a rejected
+        // password does not burn the reset link
+        record, err := tokens.Lookup(context.Background(), utils.PurposePasswordReset, req.Token)
+        if err != nil {
+            if err != utils.ErrActionTokenInvalid {
+                log.Printf("[ERROR] Error looking up reset token: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing request"})
+                return
+            }
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+            return
+        }
+
+        var user models.User
+        if err := db.FindOne(context.Background(), bson.M{"_id": record.UserID}).Decode(&user); err != nil {
+            if err != mongo.ErrNoDocuments {
+                log.Printf("[ERROR] Error fetching user: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing request"})
+                return
+            }
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+            return
+        }
+
+        if !checkPasswordPolicy(c, policy, user.Username, req.Password) {
+            return
+        }
+
+        if _, err := tokens.Consume(context.Background(), utils.PurposePasswordReset, req.Token); err != nil {
+            if err != utils.ErrActionTokenInvalid {
+                log.Printf("[ERROR] Error redeeming reset token: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing request"})
+                return
+            }
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+            return
+        }
+
+        hashedPassword, err := hasher.Hash(req.Password)
+        if err != nil {
+            log.Printf("[ERROR] Error hashing password: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing password"})
+            return
+        }
+
+        // Only reset if the address the link was sent to still belongs to the account
+        result, err := db.UpdateOne(context.Background(),
+            bson.M{"_id": record.UserID, "email": record.Email},
+            bson.M{"$set": bson.M{"password": hashedPassword}},
+        )
+        if err != nil {
+            log.Printf("[ERROR] Error updating password: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating password"})
+            return
+        }
+        if result.MatchedCount == 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+            return
+        }
+
+        if err := revokeUserTokens(record.UserID, revocations, issuer, personalTokens, hub); err != nil {
+            log.Printf("[ERROR] Error revoking sessions after password reset: %v", err)
+        }
+
+        c.JSON(http.StatusOK, gin.H{"message": "Password has been reset"})
+    }
+}
+
+// ChangePassword sets a new password for the authenticated user after checking
+// the current one, which is throttled like a login. Every other session is
+// signed out, personal access tokens are revoked and the caller receives a
+// fresh token pair.
+func ChangePassword(db *mongo.Collection, policy *utils.PasswordPolicy, hasher *utils.PasswordHasher, throttle *utils.LoginThrottle, issuer *utils.TokenIssuer, revocations *utils.RevocationList, personalTokens *utils.PersonalAccessTokenStore, hub *websocket.Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            CurrentPassword string `json:"current_password" binding:"required"`
+            NewPassword     string `json:"new_password" binding:"required"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid password change request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        user, ok := currentUser(c, db)
+        if !ok {
+            return
+        }
+
+        if user.Password == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Account has no password, use password reset to set one"})
+            return
+        }
+
+        // Wrong passwords count towards the same lockout as failed logins
+        if !reserveLoginAttempt(c, throttle, user.Username) {
+            return
+        }
+        valid, _, err := hasher.Verify(req.CurrentPassword, user.Password)
+        if err != nil {
+            log.Printf("[ERROR] Error verifying password for user %s: %v", user.Username, err)
+        }
+        if !valid {
+            log.Printf("[WARNING] Wrong current password on password change for user: %s", user.Username)
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+            return
+        }
+        if err := throttle.RecordSuccess(context.Background(), user.Username, c.ClientIP()); err != nil {
+            log.Printf("[ERROR] Error clearing login failures: %v", err)
+        }
+
+        if !checkPasswordPolicy(c, policy, user.Username, req.NewPassword) {
+            return
+        }
+
+        hashedPassword, err := hasher.Hash(req.NewPassword)
+        if err != nil {
+            log.Printf("[ERROR] Error hashing password: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing password"})
+            return
+        }
+
+        _, err = db.UpdateOne(context.Background(),
+            bson.M{"_id": user.ID},
+            bson.M{"$set": bson.M{"password": hashedPassword}},
+        )
+        if err != nil {
+            log.Printf("[ERROR] Error updating password: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating password"})
+            return
+        }
+
+        if err := revokeUserTokens(user.ID, revocations, issuer, personalTokens, hub); err != nil {
+            log.Printf("[ERROR] Error revoking sessions after password change: %v", err)
+        }
+
+        tokens, err := issuer.Issue(context.Background(), user.ID, sessionInfo(c, ""))
+        if err != nil {
+            log.Printf("[ERROR] Error generating token: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+            return
+        }
+
+        c.JSON(http.StatusOK, tokens)
+    }
+}
+
+// checkPasswordPolicy validates a new password, writing an error response with
+// a machine-readable code when it is rejected.
+func checkPasswordPolicy(c *gin.Context, policy *utils.PasswordPolicy, username, password string) bool {
+    err := policy.Validate(username, password)
+    if err == nil {
+        return true
+    }
+    if policyErr, ok := err.(*utils.PasswordPolicyError); ok {
+        c.JSON(http.StatusBadRequest, gin.H{"error": policyErr.Message, "code": policyErr.Code})
+    } else {
+        log.Printf("[ERROR] Error checking password policy: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing password"})
+    }
+    return false
+}
@@ -0,0 +1,142 @@
+// controllers/password_test.go
+package controllers
+
+import (
+    "bytes"
+    "context"
+    "encoding/json"
+    "net/http"
+    "net/http/httptest"
+    "os"
+    "testing"
+    "time"
+
+    "social-experiment/middleware"
+    "social-experiment/utils"
+    "social-experiment/websocket"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testDatabase connects to the MongoDB server named by MONGO_TEST_URI and
+// returns a fresh database that is dropped after the test. Tests are skipped
+// without one.
+func testDatabase(t *testing.T) *mongo.Database {
+    t.Helper()
+    uri := os.Getenv("MONGO_TEST_URI")
+    if uri == "" {
+        t.Skip("MONGO_TEST_URI not set")
+    }
+
+    client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(uri))
+    if err != nil {
+        t.Fatal(err)
+    }
+    db := client.Database("social-experiment-test-" + primitive.NewObjectID().Hex())
+    t.Cleanup(func() {
+        db.Drop(context.Background())
+        client.Disconnect(context.Background())
+    })
+    return db
+}
+
+func TestChangePasswordReturnsUsableToken(t *testing.T) {
+    gin.SetMode(gin.TestMode)
+    db := testDatabase(t)
+
+    config := utils.Config{
+        JWTSecret:             "test-secret",
+        AccessTokenTTL:        time.Minute,
+        RefreshTokenTTL:       time.Hour,
+        LoginMaxFailures:      5,
+        LoginIPMaxFailures:    50,
+        LoginLockoutDuration:  time.Minute,
+        LoginBackoffBase:      time.Second,
+        PasswordMinLength:     8,
+        PasswordHashAlgorithm: "bcrypt",
+        Argon2Memory:          64,
+        Argon2Time:            1,
+        Argon2Parallelism:     1,
+        BcryptCost:            4,
+    }
+    keys, err := utils.LoadKeyRing(config)
+    if err != nil {
+        t.Fatal(err)
+    }
+    hasher, err := utils.NewPasswordHasher(config)
+    if err != nil {
+        t.Fatal(err)
+    }
+    policy, err := utils.NewPasswordPolicy(config)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    users := db.Collection("users")
+    sessions := utils.NewSessionStore(db.Collection("sessions"), config.RefreshTokenTTL)
+    issuer := utils.NewTokenIssuer(keys, config.AccessTokenTTL, utils.NewRefreshTokenStore(db.Collection("refresh_tokens"), config.RefreshTokenTTL), sessions, users)
+    revocations := utils.NewRevocationList(db.Collection("revoked_tokens"), config.AccessTokenTTL)
+    personalTokens := utils.NewPersonalAccessTokenStore(db.Collection("personal_access_tokens"))
+    auth := utils.NewAuthenticator(keys, revocations, sessions, personalTokens, utils.NewWebSocketTicketStore(db.Collection("ws_tickets")))
+    hub := websocket.NewHub(auth, nil)
+    go hub.Run()
+
+    hashed, err := hasher.Hash("old password")
+    if err != nil {
+        t.Fatal(err)
+    }
+    userID := primitive.NewObjectID()
+    if _, err := users.InsertOne(context.Background(), bson.M{"_id": userID, "username": "alice", "password": hashed}); err != nil {
+        t.Fatal(err)
+    }
+    tokens, err := issuer.Issue(context.Background(), userID, utils.SessionInfo{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    personalToken, _, err := personalTokens.Create(context.Background(), userID, "script", []string{utils.ScopePostsRead}, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    router := gin.New()
+    router.POST("/password/change", middleware.AuthMiddleware(auth), ChangePassword(users, policy, hasher, utils.NewLoginThrottle(db.Collection("login_attempts"), config), issuer, revocations, personalTokens, hub))
+    router.GET("/protected", middleware.AuthMiddleware(auth, utils.ScopePostsRead), func(c *gin.Context) {
+        c.Status(http.StatusNoContent)
+    })
+
+    body, _ := json.Marshal(gin.H{"current_password": "old password", "new_password": "a new passphrase"})
+    req := httptest.NewRequest(http.MethodPost, "/password/change", bytes.NewReader(body))
+    req.Header.Set("Content-Type", "application/json")
+    req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+    w := httptest.NewRecorder()
+    router.ServeHTTP(w, req)
+    if w.Code != http.StatusOK {
+        t.Fatalf("change password: status %d: %s", w.Code, w.Body.String())
+    }
+    var changed utils.TokenPair
+    if err := json.Unmarshal(w.Body.Bytes(), &changed); err != nil {
+        t.Fatal(err)
+    }
+
+    for _, tt := range []struct {
+        name   string
+        token  string
+        status int
+    }{
+        {"token returned by the change", changed.AccessToken, http.StatusNoContent},
+        {"token from before the change", tokens.AccessToken, http.StatusUnauthorized},
+        {"personal access token from before the change", personalToken, http.StatusUnauthorized},
+    } {
+        req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+        req.Header.Set("Authorization", "Bearer "+tt.token)
+        w := httptest.NewRecorder()
+        router.ServeHTTP(w, req)
+        if w.Code != tt.status {
+            t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+        }
+    }
+}
@@ -0,0 +1,132 @@
+// controllers/personal_access_token.go
+package controllers
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "strings"
+    "time"
+    "unicode/utf8"
+
+    "social-experiment/utils"
+    "social-experiment/websocket"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxTokenNameLength caps the name given to a personal access token
+const maxTokenNameLength = 100
+
+// CreatePersonalAccessToken creates a scoped token for the authenticated user.
+// The token is only returned in this response.
+func CreatePersonalAccessToken(tokens *utils.PersonalAccessTokenStore) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            Name      string   `json:"name"`
+            Scopes    []string `json:"scopes"`
+            ExpiresIn string   `json:"expires_in"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid token request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        req.Name = strings.TrimSpace(req.Name)
+        if req.Name == "" || utf8.RuneCountInString(req.Name) > maxTokenNameLength {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Name is required and must be at most 100 characters"})
+            return
+        }
+
+        scopes, err := utils.NormalizeScopes(req.Scopes)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        if len(scopes) == 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "At least one scope is required", "scopes": utils.KnownScopes})
+            return
+        }
+
+        var expiresAt *time.Time
+        if req.ExpiresIn != "" {
+            ttl, err := time.ParseDuration(req.ExpiresIn)
+            if err != nil || ttl <= 0 {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "expires_in must be a positive duration such as \"720h\""})
+                return
+            }
+            t := time.Now().Add(ttl)
+            expiresAt = &t
+        }
+
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        token, record, err := tokens.Create(context.Background(), userID, req.Name, scopes, expiresAt)
+        if err != nil {
+            log.Printf("[ERROR] Error creating personal access token: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating token"})
+            return
+        }
+
+        c.JSON(http.StatusCreated, gin.H{"token": token, "personal_access_token": record})
+    }
+}
+
+// ListPersonalAccessTokens returns the authenticated user's tokens, newest first.
+func ListPersonalAccessTokens(tokens *utils.PersonalAccessTokenStore) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        list, err := tokens.List(context.Background(), userID)
+        if err != nil {
+            log.Printf("[ERROR] Error fetching personal access tokens: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching tokens"})
+            return
+        }
+
+        c.JSON(http.StatusOK, list)
+    }
+}
+
+// RevokePersonalAccessToken revokes one of the authenticated user's tokens and
+// closes WebSocket connections opened with it.
+func RevokePersonalAccessToken(tokens *utils.PersonalAccessTokenStore, hub *websocket.Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+        tokenID, err := primitive.ObjectIDFromHex(c.Param("id"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+            return
+        }
+
+        revoked, err := tokens.Revoke(context.Background(), userID, tokenID)
+        if err != nil {
+            log.Printf("[ERROR] Error revoking personal access token: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking token"})
+            return
+        }
+        if !revoked {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+            return
+        }
+
+        hub.DisconnectToken(tokenID.Hex())
+
+        c.Status(http.StatusNoContent)
+    }
+}
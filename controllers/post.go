@@ -5,6 +5,7 @@ import (
     "context"
     "log"
     "net/http"
+    "strconv"
     "strings"
     "time"
 
@@ -19,8 +20,11 @@ import (
     "go.mongodb.org/mongo-driver/mongo/options" // Added import
 )
 
-// CreatePost handles creating a new post
-func CreatePost(db *mongo.Collection, hub *websocket.Hub) gin.HandlerFunc {
+// CreatePost handles creating a new post, a reply when in_reply_to names the
+// post it answers, or a quote post when quote_of names the post it embeds.
+// The authors of those posts are notified. When requireVerifiedEmail is set,
+// only users who have confirmed their email address may post.
+func CreatePost(db *mongo.Collection, users *mongo.Collection, notifications *mongo.Collection, hub *websocket.Hub, requireVerifiedEmail bool) gin.HandlerFunc {
     return func(c *gin.Context) {
         // Retrieve userID from context
         userID, exists := c.Get("userID")
@@ -31,7 +35,9 @@ func CreatePost(db *mongo.Collection, hub *websocket.Hub) gin.HandlerFunc {
 
         // Bind JSON input to request struct
         var req struct {
-            Content string `json:"content" binding:"required"`
+            Content   string `json:"content" binding:"required"`
+            InReplyTo string `json:"in_reply_to"`
+            QuoteOf   string `json:"quote_of"`
         }
 
         if err := c.ShouldBindJSON(&req); err != nil {
@@ -41,14 +47,11 @@ func CreatePost(db *mongo.Collection, hub *websocket.Hub) gin.HandlerFunc {
         }
 
         // Input validation and sanitization
-        req.Content = strings.TrimSpace(req.Content)
-        if req.Content == "" {
-            c.JSON(http.StatusBadRequest, gin.H{"error": "Post content cannot be empty"})
+        safeContent, ok := validatePostContent(c, req.Content)
+        if !ok {
             return
         }
 
-        safeContent := utils.SanitizeInput(req.Content)
-
         // Convert userID from string to primitive.ObjectID
         objectID, err := primitive.ObjectIDFromHex(userID.(string))
         if err != nil {
@@ -59,7 +62,7 @@ func CreatePost(db *mongo.Collection, hub *websocket.Hub) gin.HandlerFunc {
 
         // Retrieve user from database
         var user models.User
-        err = db.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&user)
+        err = users.FindOne(context.Background(), bson.M{"_id": objectID}).Decode(&user)
         if err != nil {
             if err == mongo.ErrNoDocuments {
                 c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
@@ -70,6 +73,11 @@ func CreatePost(db *mongo.Collection, hub *websocket.Hub) gin.HandlerFunc {
             return
         }
 
+        if requireVerifiedEmail && !user.EmailVerified {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address before posting"})
+            return
+        }
+
         // Create a new Post instance with a new ObjectID
         post := models.Post{
             ID:        primitive.NewObjectID(),
@@ -77,6 +85,45 @@ func CreatePost(db *mongo.Collection, hub *websocket.Hub) gin.HandlerFunc {
             Username:  user.Username,
             Content:   safeContent,
             CreatedAt: time.Now(),
+            Author: &models.Author{
+                ID:          user.ID,
+                Username:    user.Username,
+                DisplayName: user.DisplayName,
+                AvatarURL:   user.AvatarURL,
+            },
+        }
+        post.ConversationID = post.ID
+
+        // Place a reply in the conversation of the post it answers
+        var parent, quoted *models.Post
+        if req.InReplyTo != "" {
+            parent, ok = findTargetPost(c, db, req.InReplyTo, "in_reply_to", "reply to")
+            if !ok {
+                return
+            }
+
+            post.InReplyTo = &parent.ID
+            post.ConversationID = parent.ID
+            if !parent.ConversationID.IsZero() {
+                post.ConversationID = parent.ConversationID
+            }
+            post.Ancestors = append(append([]primitive.ObjectID{}, parent.Ancestors...), parent.ID)
+            post.Depth = parent.Depth + 1
+        }
+
+        // Embed the quoted post
+        if req.QuoteOf != "" {
+            quoted, ok = findTargetPost(c, db, req.QuoteOf, "quote_of", "quote")
+            if !ok {
+                return
+            }
+            originals := []models.Post{*quoted}
+            if err := attachAuthors(users, originals); err != nil {
+                log.Printf("[ERROR] Error fetching post author: %v", err)
+            }
+
+            post.QuoteOf = &quoted.ID
+            post.Original = &originals[0]
         }
 
         // Insert the post into the database
@@ -87,6 +134,31 @@ func CreatePost(db *mongo.Collection, hub *websocket.Hub) gin.HandlerFunc {
             return
         }
 
+        if parent != nil {
+            _, err = db.UpdateOne(context.Background(),
+                bson.M{"_id": parent.ID},
+                bson.M{"$inc": bson.M{"reply_count": 1}},
+            )
+            if err != nil {
+                log.Printf("[ERROR] Error counting reply to post %s: %v", parent.ID.Hex(), err)
+            }
+            if !parent.UserID.IsZero() && parent.UserID != user.ID {
+                notify(notifications, hub, parent.UserID, models.NotificationReply, post)
+            }
+        }
+        if quoted != nil {
+            _, err = db.UpdateOne(context.Background(),
+                bson.M{"_id": quoted.ID},
+                bson.M{"$inc": bson.M{"quote_count": 1}},
+            )
+            if err != nil {
+                log.Printf("[ERROR] Error counting quote of post %s: %v", quoted.ID.Hex(), err)
+            }
+            if !quoted.UserID.IsZero() && quoted.UserID != user.ID && (parent == nil || parent.UserID != quoted.UserID) {
+                notify(notifications, hub, quoted.UserID, models.NotificationQuote, post)
+            }
+        }
+
         // Broadcast the new post to WebSocket clients
         hub.BroadcastPost(post)
 
@@ -95,40 +167,486 @@ func CreatePost(db *mongo.Collection, hub *websocket.Hub) gin.HandlerFunc {
     }
 }
 
-// GetPosts handles retrieving all posts
-func GetPosts(db *mongo.Collection) gin.HandlerFunc {
+// GetPosts handles retrieving a page of posts, newest first, each with a
+// summary of its author. Deleted posts are left out. since_id and until
+// restrict the list to posts after the given post and up to the given time,
+// so clients can catch up on what they missed while disconnected.
+func GetPosts(db *mongo.Collection, users *mongo.Collection, reactions *mongo.Collection) gin.HandlerFunc {
     return func(c *gin.Context) {
-        // Define find options to sort posts by CreatedAt in descending order
-        findOptions := options.Find().SetSort(bson.D{{"created_at", -1}})
+        limit, cursor, ok := parsePageRequest(c)
+        if !ok {
+            return
+        }
+
+        conditions := []bson.M{{"deleted_at": nil}}
+        if sinceID := c.Query("since_id"); sinceID != "" {
+            id, err := primitive.ObjectIDFromHex(sinceID)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since_id"})
+                return
+            }
 
-        // Execute the find query
-        cursor, err := db.Find(context.Background(), bson.M{}, findOptions)
+            // Posts deleted since fall back to the time in their ID
+            since := models.Post{ID: id, CreatedAt: id.Timestamp()}
+            err = db.FindOne(context.Background(),
+                bson.M{"_id": id},
+                options.FindOne().SetProjection(bson.M{"created_at": 1}),
+            ).Decode(&since)
+            if err != nil && err != mongo.ErrNoDocuments {
+                log.Printf("[ERROR] Error fetching post: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching posts"})
+                return
+            }
+            conditions = append(conditions, utils.NewerThan(since.CreatedAt, since.ID))
+        }
+        if until := c.Query("until"); until != "" {
+            t, err := time.Parse(time.RFC3339, until)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid until"})
+                return
+            }
+            conditions = append(conditions, bson.M{"created_at": bson.M{"$lte": t}})
+        }
+
+        posts, next, prev, err := findPostPage(db, conditions, cursor, limit)
         if err != nil {
             log.Printf("[ERROR] Error fetching posts: %v", err)
             c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching posts"})
             return
         }
-        defer cursor.Close(context.Background())
 
-        // Iterate through the cursor and decode posts
-        var posts []models.Post
-        for cursor.Next(context.Background()) {
-            var post models.Post
-            if err := cursor.Decode(&post); err != nil {
-                log.Printf("[ERROR] Error decoding post: %v", err)
-                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error decoding posts"})
+        // Look up the reposted and quoted posts, the authors and the user's
+        // reactions in one query each
+        if err := attachPostDetails(db, users, reactions, c.GetString("userID"), posts); err != nil {
+            log.Printf("[ERROR] Error fetching post details: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching posts"})
+            return
+        }
+
+        page := postPage{Posts: posts}
+        page.Next, page.Prev = setPageLinks(c, next, prev)
+        c.JSON(http.StatusOK, page)
+    }
+}
+
+// GetPost handles retrieving a single post with a summary of its author.
+// Deleted posts are returned as tombstones.
+func GetPost(db *mongo.Collection, users *mongo.Collection, reactions *mongo.Collection) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        post, ok := findPost(c, db)
+        if !ok {
+            return
+        }
+
+        posts := []models.Post{*post}
+        if err := attachPostDetails(db, users, reactions, c.GetString("userID"), posts); err != nil {
+            log.Printf("[ERROR] Error fetching post details: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching post"})
+            return
+        }
+
+        c.JSON(http.StatusOK, posts[0])
+    }
+}
+
+// UpdatePost handles editing the content of a post. Only its author and
+// moderators may edit it. The content it replaces is kept in the post's
+// revision history.
+func UpdatePost(db *mongo.Collection, revisions *mongo.Collection, users *mongo.Collection, hub *websocket.Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            Content string `json:"content" binding:"required"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid post update request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        safeContent, ok := validatePostContent(c, req.Content)
+        if !ok {
+            return
+        }
+
+        post, ok := findEditablePost(c, db)
+        if !ok {
+            return
+        }
+        if post.RepostOf != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Reposts cannot be edited"})
+            return
+        }
+
+        edited := safeContent != post.Content
+        if edited {
+            // Swap the content atomically, reading the version it replaces
+            now := time.Now()
+            err := db.FindOneAndUpdate(context.Background(),
+                bson.M{"_id": post.ID, "deleted_at": nil},
+                bson.M{"$set": bson.M{"content": safeContent, "edited_at": now}},
+                options.FindOneAndUpdate().SetReturnDocument(options.Before),
+            ).Decode(post)
+            if err == mongo.ErrNoDocuments {
+                c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
                 return
             }
-            posts = append(posts, post)
+            if err != nil {
+                log.Printf("[ERROR] Error updating post: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating post"})
+                return
+            }
+
+            revision := models.PostRevision{
+                PostID:    post.ID,
+                Content:   post.Content,
+                CreatedAt: post.CreatedAt,
+            }
+            if post.EditedAt != nil {
+                revision.CreatedAt = *post.EditedAt
+            }
+            if _, err := revisions.InsertOne(context.Background(), revision); err != nil {
+                log.Printf("[ERROR] Error saving revision of post %s: %v", post.ID.Hex(), err)
+            }
+
+            post.Content = safeContent
+            post.EditedAt = &now
+            log.Printf("[INFO] Post %s edited by user %s", post.ID.Hex(), c.GetString("userID"))
+        }
+
+        // Everyone receives the update, so it leaves out the editor's reactions
+        posts := []models.Post{*post}
+        if err := attachPostDetails(db, users, nil, "", posts); err != nil {
+            log.Printf("[ERROR] Error fetching post details: %v", err)
+        }
+        if edited {
+            hub.BroadcastPostUpdated(posts[0])
         }
 
-        if err := cursor.Err(); err != nil {
-            log.Printf("[ERROR] Cursor error: %v", err)
-            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing posts"})
+        c.JSON(http.StatusOK, posts[0])
+    }
+}
+
+// DeletePost handles deleting a post. Only its author and moderators may
+// delete it. The post is replaced by a tombstone, and its revision history,
+// reactions and the notifications about it are removed with its content.
+// Deleting a repost undoes it.
+func DeletePost(db *mongo.Collection, revisions *mongo.Collection, reactions *mongo.Collection, notifications *mongo.Collection, hub *websocket.Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        post, ok := findEditablePost(c, db)
+        if !ok {
             return
         }
+        if post.RepostOf != nil {
+            if err := removeRepost(db, notifications, hub, post); err != nil {
+                log.Printf("[ERROR] Error undoing repost: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting post"})
+                return
+            }
+            c.Status(http.StatusNoContent)
+            return
+        }
+
+        now := time.Now()
+        result, err := db.UpdateOne(context.Background(),
+            bson.M{"_id": post.ID, "deleted_at": nil},
+            bson.M{
+                "$set":   bson.M{"deleted_at": now},
+                "$unset": bson.M{"content": "", "edited_at": "", "reactions": ""},
+            },
+        )
+        if err != nil {
+            log.Printf("[ERROR] Error deleting post: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting post"})
+            return
+        }
+        if result.MatchedCount == 0 {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+            return
+        }
+
+        if _, err := revisions.DeleteMany(context.Background(), bson.M{"post_id": post.ID}); err != nil {
+            log.Printf("[ERROR] Error deleting revisions of post %s: %v", post.ID.Hex(), err)
+        }
+        if _, err := reactions.DeleteMany(context.Background(), bson.M{"post_id": post.ID}); err != nil {
+            log.Printf("[ERROR] Error deleting reactions to post %s: %v", post.ID.Hex(), err)
+        }
+        if _, err := notifications.DeleteMany(context.Background(), bson.M{"post_id": post.ID}); err != nil {
+            log.Printf("[ERROR] Error deleting notifications about post %s: %v", post.ID.Hex(), err)
+        }
+
+        log.Printf("[INFO] Post %s deleted by user %s", post.ID.Hex(), c.GetString("userID"))
+        hub.BroadcastPostDeleted(models.Post{
+            ID:             post.ID,
+            UserID:         post.UserID,
+            Username:       post.Username,
+            CreatedAt:      post.CreatedAt,
+            DeletedAt:      &now,
+            InReplyTo:      post.InReplyTo,
+            ConversationID: post.ConversationID,
+            ReplyCount:     post.ReplyCount,
+        })
+
+        c.Status(http.StatusNoContent)
+    }
+}
+
+// GetPostHistory handles listing the versions of a post, oldest first and
+// ending with the current one.
+func GetPostHistory(db *mongo.Collection, revisions *mongo.Collection) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        post, ok := findPost(c, db)
+        if !ok {
+            return
+        }
+        if post.DeletedAt != nil {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+            return
+        }
+
+        cursor, err := revisions.Find(context.Background(),
+            bson.M{"post_id": post.ID},
+            options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}),
+        )
+        if err != nil {
+            log.Printf("[ERROR] Error fetching post revisions: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching post history"})
+            return
+        }
+        history := []models.PostRevision{}
+        if err := cursor.All(context.Background(), &history); err != nil {
+            log.Printf("[ERROR] Error decoding post revisions: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching post history"})
+            return
+        }
+
+        current := models.PostRevision{Content: post.Content, CreatedAt: post.CreatedAt}
+        if post.EditedAt != nil {
+            current.CreatedAt = *post.EditedAt
+        }
+        history = append(history, current)
+
+        c.JSON(http.StatusOK, gin.H{"revisions": history})
+    }
+}
+
+// Limits of the reply tree returned with a thread
+const (
+    defaultThreadDepth = 3
+    maxThreadDepth     = 10
+    maxThreadReplies   = 500
+)
+
+// threadNode is a post in a reply tree with the replies below it.
+type threadNode struct {
+    models.Post
+    Replies []*threadNode `json:"replies"`
+}
+
+// GetPostThread handles retrieving a post in its conversation: the posts it
+// replies to, starting with the first of the conversation, and a page of its
+// direct replies, oldest first, with their own replies nested down to depth
+// levels below the post. Deleted posts appear as tombstones so the tree stays
+// whole. A reply listing fewer replies than its reply_count has more below
+// the depth limit, which its own thread returns.
+func GetPostThread(db *mongo.Collection, users *mongo.Collection, reactions *mongo.Collection) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        limit, cursor, ok := parsePageRequest(c)
+        if !ok {
+            return
+        }
+        depth := defaultThreadDepth
+        if raw := c.Query("depth"); raw != "" {
+            var err error
+            depth, err = strconv.Atoi(raw)
+            if err != nil || depth < 1 {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid depth"})
+                return
+            }
+            if depth > maxThreadDepth {
+                depth = maxThreadDepth
+            }
+        }
+
+        post, ok := findPost(c, db)
+        if !ok {
+            return
+        }
+
+        ancestors := []models.Post{}
+        if len(post.Ancestors) > 0 {
+            results, err := db.Find(context.Background(),
+                bson.M{"_id": bson.M{"$in": post.Ancestors}},
+                options.Find().SetSort(bson.D{{Key: "depth", Value: 1}}),
+            )
+            if err == nil {
+                err = results.All(context.Background(), &ancestors)
+            }
+            if err != nil {
+                log.Printf("[ERROR] Error fetching ancestors of post %s: %v", post.ID.Hex(), err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching thread"})
+                return
+            }
+        }
+
+        // Read a page of direct replies, oldest first, and one more to learn
+        // whether another page follows
+        filter := bson.M{"in_reply_to": post.ID}
+        if cursor != nil {
+            filter = bson.M{"$and": []bson.M{filter, utils.NewerThan(cursor.CreatedAt, cursor.ID)}}
+        }
+        oldestFirst := bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}
+        replies := []models.Post{}
+        results, err := db.Find(context.Background(), filter, options.Find().SetSort(oldestFirst).SetLimit(int64(limit+1)))
+        if err == nil {
+            err = results.All(context.Background(), &replies)
+        }
+        if err != nil {
+            log.Printf("[ERROR] Error fetching replies to post %s: %v", post.ID.Hex(), err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching thread"})
+            return
+        }
+        var next *utils.PageCursor
+        if len(replies) > limit {
+            replies = replies[:limit]
+            last := replies[limit-1]
+            next = &utils.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID, Newer: true}
+        }
+
+        // Read the replies below the page in one query
+        descendants := []models.Post{}
+        if depth > 1 && len(replies) > 0 {
+            replyIDs := make([]primitive.ObjectID, 0, len(replies))
+            for _, reply := range replies {
+                replyIDs = append(replyIDs, reply.ID)
+            }
+            results, err := db.Find(context.Background(),
+                bson.M{"ancestors": bson.M{"$in": replyIDs}, "depth": bson.M{"$lte": post.Depth + depth}},
+                options.Find().SetSort(oldestFirst).SetLimit(maxThreadReplies),
+            )
+            if err == nil {
+                err = results.All(context.Background(), &descendants)
+            }
+            if err != nil {
+                log.Printf("[ERROR] Error fetching replies below post %s: %v", post.ID.Hex(), err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching thread"})
+                return
+            }
+        }
+
+        // Look up the quoted posts, the authors and the user's reactions for
+        // the whole thread in one query each
+        all := append(append(append(append([]models.Post{}, ancestors...), *post), replies...), descendants...)
+        if err := attachPostDetails(db, users, reactions, c.GetString("userID"), all); err != nil {
+            log.Printf("[ERROR] Error fetching post details: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching thread"})
+            return
+        }
+        ancestors = all[:len(ancestors)]
+        *post = all[len(ancestors)]
+        all = all[len(ancestors)+1:]
+
+        // Nest every reply under its parent. Replies whose parent is missing,
+        // because it was erased or cut off, are left out
+        nodes := make(map[primitive.ObjectID]*threadNode, len(all))
+        for i := range all {
+            nodes[all[i].ID] = &threadNode{Post: all[i], Replies: []*threadNode{}}
+        }
+        top := make([]*threadNode, 0, len(replies))
+        for _, reply := range all[:len(replies)] {
+            top = append(top, nodes[reply.ID])
+        }
+        for _, descendant := range all[len(replies):] {
+            if parent := nodes[*descendant.InReplyTo]; parent != nil {
+                parent.Replies = append(parent.Replies, nodes[descendant.ID])
+            }
+        }
+
+        nextCursor, _ := setPageLinks(c, next, nil)
+        response := gin.H{"ancestors": ancestors, "post": post, "replies": top}
+        if nextCursor != "" {
+            response["next"] = nextCursor
+        }
+        c.JSON(http.StatusOK, response)
+    }
+}
+
+// validatePostContent trims and sanitizes post content, responding with 400
+// and returning false if it is empty.
+func validatePostContent(c *gin.Context, content string) (string, bool) {
+    content = strings.TrimSpace(content)
+    if content == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Post content cannot be empty"})
+        return "", false
+    }
+    return utils.SanitizeInput(content), true
+}
+
+// findPost fetches the post named in the URL, responding with an error and
+// returning false if there is none.
+func findPost(c *gin.Context, db *mongo.Collection) (*models.Post, bool) {
+    postID, err := primitive.ObjectIDFromHex(c.Param("id"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+        return nil, false
+    }
+
+    var post models.Post
+    err = db.FindOne(context.Background(), bson.M{"_id": postID}).Decode(&post)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+        return nil, false
+    }
+    if err != nil {
+        log.Printf("[ERROR] Error fetching post: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching post"})
+        return nil, false
+    }
+    return &post, true
+}
+
+// findEditablePost fetches the post named in the URL if it has not been
+// deleted and the user wrote it or may moderate posts, responding with an
+// error and returning false otherwise.
+func findEditablePost(c *gin.Context, db *mongo.Collection) (*models.Post, bool) {
+    post, ok := findPost(c, db)
+    if !ok {
+        return nil, false
+    }
+    if post.DeletedAt != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+        return nil, false
+    }
+
+    claims := c.MustGet("claims").(*utils.Claims)
+    if post.UserID.Hex() != claims.UserID && !claims.HasPermission(utils.PermissionModeratePosts) {
+        c.JSON(http.StatusForbidden, gin.H{"error": "You can only change your own posts"})
+        return nil, false
+    }
+    return post, true
+}
 
-        // Respond with the list of posts
-        c.JSON(http.StatusOK, posts)
+// EnsurePostIndexes creates the indexes posts are listed and threaded by, the
+// unique index allowing one repost of a post per user, and the index
+// revisions are looked up by.
+func EnsurePostIndexes(db *mongo.Collection, revisions *mongo.Collection) error {
+    _, err := db.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+        {Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+        {Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+        {Keys: bson.D{{Key: "in_reply_to", Value: 1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+        {Keys: bson.D{{Key: "ancestors", Value: 1}, {Key: "created_at", Value: 1}}},
+        {
+            Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "repost_of", Value: 1}},
+            Options: options.Index().
+                SetUnique(true).
+                SetPartialFilterExpression(bson.M{"repost_of": bson.M{"$exists": true}}),
+        },
+    })
+    if err != nil {
+        return err
     }
+    _, err = revisions.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+        Keys: bson.D{{Key: "post_id", Value: 1}, {Key: "created_at", Value: 1}},
+    })
+    return err
 }
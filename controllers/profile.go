@@ -0,0 +1,172 @@
+// controllers/profile.go
+package controllers
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "net/url"
+
+    "social-experiment/models"
+    "social-experiment/utils"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// GetUserProfile returns the public profile of a user. Accounts scheduled for
+// deletion are hidden. A username given up recently redirects to the account
+// that held it.
+func GetUserProfile(db *mongo.Collection) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        user, err := findUserByUsername(db, c.Param("username"), bson.M{"deletion_scheduled_at": nil})
+        if err == mongo.ErrNoDocuments {
+            renamed, err := findRenamedUser(db, c.Param("username"))
+            if err != nil {
+                log.Printf("[ERROR] Error fetching renamed user: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching profile"})
+                return
+            }
+            if renamed == nil {
+                c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+                return
+            }
+            c.Header("Location", "/users/"+url.PathEscape(renamed.Username))
+            c.JSON(http.StatusTemporaryRedirect, gin.H{"error": "User has been renamed", "username": renamed.Username})
+            return
+        }
+        if err != nil {
+            log.Printf("[ERROR] Error fetching user: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching profile"})
+            return
+        }
+
+        c.JSON(http.StatusOK, publicProfile(user))
+    }
+}
+
+// UpdateProfile changes the authenticated user's display name, bio, avatar,
+// website or location and returns the updated account.
+func UpdateProfile(db *mongo.Collection) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req utils.ProfileUpdate
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid profile update request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        set, unset, err := req.Changes()
+        if err != nil {
+            profileErr := err.(*utils.ProfileError)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + profileErr.Field + ": " + profileErr.Message, "field": profileErr.Field})
+            return
+        }
+        if len(set) == 0 && len(unset) == 0 {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "No profile fields to update"})
+            return
+        }
+
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        update := bson.M{}
+        if len(set) > 0 {
+            update["$set"] = set
+        }
+        if len(unset) > 0 {
+            update["$unset"] = unset
+        }
+
+        var user models.User
+        err = db.FindOneAndUpdate(context.Background(),
+            bson.M{"_id": userID},
+            update,
+            options.FindOneAndUpdate().SetReturnDocument(options.After),
+        ).Decode(&user)
+        if err == mongo.ErrNoDocuments {
+            c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+            return
+        }
+        if err != nil {
+            log.Printf("[ERROR] Error updating profile: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating profile"})
+            return
+        }
+
+        log.Printf("[INFO] Profile updated: %s", user.Username)
+        c.JSON(http.StatusOK, user)
+    }
+}
+
+// publicProfile returns the parts of the account anyone may see.
+func publicProfile(user *models.User) models.Profile {
+    return models.Profile{
+        ID:          user.ID,
+        Username:    user.Username,
+        DisplayName: user.DisplayName,
+        Bio:         user.Bio,
+        AvatarURL:   user.AvatarURL,
+        Website:     user.Website,
+        Location:    user.Location,
+        CreatedAt:   user.CreatedAt,
+    }
+}
+
+// attachAuthors fills in the author summary of each post with a single query.
+// Posts of erased accounts have no author.
+func attachAuthors(users *mongo.Collection, posts []models.Post) error {
+    userIDs := make([]primitive.ObjectID, 0, len(posts))
+    for _, post := range posts {
+        userIDs = append(userIDs, post.UserID)
+    }
+
+    authors, err := findAuthors(users, userIDs)
+    if err != nil {
+        return err
+    }
+    for i := range posts {
+        posts[i].Author = authors[posts[i].UserID]
+    }
+    return nil
+}
+
+// findAuthors looks up the author summaries of the given users with a single
+// query. Erased accounts are left out.
+func findAuthors(users *mongo.Collection, userIDs []primitive.ObjectID) (map[primitive.ObjectID]*models.Author, error) {
+    seen := make(map[primitive.ObjectID]bool)
+    ids := []primitive.ObjectID{}
+    for _, id := range userIDs {
+        if !id.IsZero() && !seen[id] {
+            seen[id] = true
+            ids = append(ids, id)
+        }
+    }
+    byID := make(map[primitive.ObjectID]*models.Author, len(ids))
+    if len(ids) == 0 {
+        return byID, nil
+    }
+
+    cursor, err := users.Find(context.Background(),
+        bson.M{"_id": bson.M{"$in": ids}},
+        options.Find().SetProjection(bson.M{"username": 1, "display_name": 1, "avatar_url": 1}),
+    )
+    if err != nil {
+        return nil, err
+    }
+    var authors []models.Author
+    if err := cursor.All(context.Background(), &authors); err != nil {
+        return nil, err
+    }
+
+    for i := range authors {
+        byID[authors[i].ID] = &authors[i]
+    }
+    return byID, nil
+}
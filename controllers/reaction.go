@@ -0,0 +1,265 @@
+// controllers/reaction.go
+package controllers
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "time"
+
+    "social-experiment/models"
+    "social-experiment/utils"
+    "social-experiment/websocket"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// reactionPage is one page of the reactions to a post, newest first.
+type reactionPage struct {
+    Reactions []models.Reaction `json:"reactions"`
+    Next      string            `json:"next,omitempty"`
+}
+
+// AddReaction handles reacting to a post with an emoji. Reacting twice with
+// the same emoji changes nothing.
+func AddReaction(db *mongo.Collection, reactions *mongo.Collection, hub *websocket.Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        post, userID, emoji, ok := parseReactionRequest(c, db)
+        if !ok {
+            return
+        }
+
+        _, err := reactions.InsertOne(context.Background(), models.Reaction{
+            PostID:    post.ID,
+            UserID:    userID,
+            Emoji:     emoji,
+            CreatedAt: time.Now(),
+        })
+        if mongo.IsDuplicateKeyError(err) {
+            c.Status(http.StatusNoContent)
+            return
+        }
+        if err != nil {
+            log.Printf("[ERROR] Error adding reaction: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding reaction"})
+            return
+        }
+
+        updateReactionCount(db, hub, post.ID, emoji, 1)
+        c.Status(http.StatusNoContent)
+    }
+}
+
+// RemoveReaction handles taking back a reaction to a post. Removing a
+// reaction that does not exist changes nothing.
+func RemoveReaction(db *mongo.Collection, reactions *mongo.Collection, hub *websocket.Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        post, userID, emoji, ok := parseReactionRequest(c, db)
+        if !ok {
+            return
+        }
+
+        result, err := reactions.DeleteOne(context.Background(), bson.M{"post_id": post.ID, "user_id": userID, "emoji": emoji})
+        if err != nil {
+            log.Printf("[ERROR] Error removing reaction: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing reaction"})
+            return
+        }
+
+        if result.DeletedCount > 0 {
+            updateReactionCount(db, hub, post.ID, emoji, -1)
+        }
+        c.Status(http.StatusNoContent)
+    }
+}
+
+// ListReactions handles retrieving a page of the reactions to a post, newest
+// first, with the users who reacted. emoji restricts the list to one emoji.
+func ListReactions(db *mongo.Collection, reactions *mongo.Collection, users *mongo.Collection) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        limit, cursor, ok := parsePageRequest(c)
+        if !ok {
+            return
+        }
+        if cursor != nil && cursor.Newer {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+            return
+        }
+
+        post, ok := findPost(c, db)
+        if !ok {
+            return
+        }
+
+        filter := bson.M{"post_id": post.ID}
+        if raw := c.Query("emoji"); raw != "" {
+            emoji, err := utils.ParseReaction(raw)
+            if err != nil {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown reaction"})
+                return
+            }
+            filter["emoji"] = emoji
+        }
+        if cursor != nil {
+            filter = bson.M{"$and": []bson.M{filter, cursor.Filter()}}
+        }
+
+        results, err := reactions.Find(context.Background(), filter,
+            options.Find().SetSort(utils.NewestFirst()).SetLimit(int64(limit+1)),
+        )
+        if err != nil {
+            log.Printf("[ERROR] Error fetching reactions: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching reactions"})
+            return
+        }
+        page := reactionPage{Reactions: []models.Reaction{}}
+        if err := results.All(context.Background(), &page.Reactions); err != nil {
+            log.Printf("[ERROR] Error decoding reactions: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching reactions"})
+            return
+        }
+
+        var next *utils.PageCursor
+        if len(page.Reactions) > limit {
+            page.Reactions = page.Reactions[:limit]
+            last := page.Reactions[limit-1]
+            next = &utils.PageCursor{CreatedAt: last.CreatedAt, ID: last.ID}
+        }
+
+        // Look up the users of the page in one query
+        userIDs := make([]primitive.ObjectID, 0, len(page.Reactions))
+        for _, reaction := range page.Reactions {
+            userIDs = append(userIDs, reaction.UserID)
+        }
+        authors, err := findAuthors(users, userIDs)
+        if err != nil {
+            log.Printf("[ERROR] Error fetching reaction users: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching reactions"})
+            return
+        }
+        for i := range page.Reactions {
+            page.Reactions[i].User = authors[page.Reactions[i].UserID]
+        }
+
+        page.Next, _ = setPageLinks(c, next, nil)
+        c.JSON(http.StatusOK, page)
+    }
+}
+
+// parseReactionRequest reads the post and emoji of a reaction request and the
+// requesting user, responding with an error and returning false if the post
+// does not exist or the emoji is not a reaction.
+func parseReactionRequest(c *gin.Context, db *mongo.Collection) (*models.Post, primitive.ObjectID, string, bool) {
+    emoji, err := utils.ParseReaction(c.Param("emoji"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown reaction"})
+        return nil, primitive.NilObjectID, "", false
+    }
+
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+        return nil, primitive.NilObjectID, "", false
+    }
+
+    post, ok := findPost(c, db)
+    if !ok {
+        return nil, primitive.NilObjectID, "", false
+    }
+    if post.DeletedAt != nil {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+        return nil, primitive.NilObjectID, "", false
+    }
+    if post.RepostOf != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot react to a repost; use the original post"})
+        return nil, primitive.NilObjectID, "", false
+    }
+    return post, userID, emoji, true
+}
+
+// updateReactionCount adjusts the count of an emoji on a post, dropping counts
+// that reach zero, and queues the new counts for connected clients.
+func updateReactionCount(db *mongo.Collection, hub *websocket.Hub, postID primitive.ObjectID, emoji string, delta int) {
+    field := "reactions." + emoji
+    var post models.Post
+    err := db.FindOneAndUpdate(context.Background(),
+        bson.M{"_id": postID},
+        bson.M{"$inc": bson.M{field: delta}},
+        options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"reactions": 1}),
+    ).Decode(&post)
+    if err != nil {
+        log.Printf("[ERROR] Error counting reactions to post %s: %v", postID.Hex(), err)
+        return
+    }
+
+    if post.Reactions[emoji] <= 0 {
+        err = db.FindOneAndUpdate(context.Background(),
+            bson.M{"_id": postID, field: bson.M{"$lte": 0}},
+            bson.M{"$unset": bson.M{field: ""}},
+            options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"reactions": 1}),
+        ).Decode(&post)
+        if err != nil && err != mongo.ErrNoDocuments {
+            log.Printf("[ERROR] Error counting reactions to post %s: %v", postID.Hex(), err)
+            return
+        }
+    }
+
+    hub.BroadcastReactions(postID.Hex(), post.Reactions)
+}
+
+// attachReactedByMe lists on each post the emoji the user reacted to it with,
+// using a single query.
+func attachReactedByMe(reactions *mongo.Collection, userID string, posts []models.Post) error {
+    id, err := primitive.ObjectIDFromHex(userID)
+    if err != nil || len(posts) == 0 {
+        return nil
+    }
+    postIDs := make([]primitive.ObjectID, 0, len(posts))
+    for _, post := range posts {
+        if len(post.Reactions) > 0 {
+            postIDs = append(postIDs, post.ID)
+        }
+    }
+    if len(postIDs) == 0 {
+        return nil
+    }
+
+    cursor, err := reactions.Find(context.Background(),
+        bson.M{"user_id": id, "post_id": bson.M{"$in": postIDs}},
+        options.Find().SetProjection(bson.M{"post_id": 1, "emoji": 1}),
+    )
+    if err != nil {
+        return err
+    }
+    var mine []models.Reaction
+    if err := cursor.All(context.Background(), &mine); err != nil {
+        return err
+    }
+
+    byPost := make(map[primitive.ObjectID][]string)
+    for _, reaction := range mine {
+        byPost[reaction.PostID] = append(byPost[reaction.PostID], reaction.Emoji)
+    }
+    for i := range posts {
+        posts[i].ReactedByMe = byPost[posts[i].ID]
+    }
+    return nil
+}
+
+// EnsureReactionIndexes creates the unique index that makes each reaction
+// count once and the indexes reactions are listed by.
+func EnsureReactionIndexes(db *mongo.Collection) error {
+    _, err := db.Indexes().CreateMany(context.Background(), []mongo.IndexModel{
+        {
+            Keys:    bson.D{{Key: "post_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "emoji", Value: 1}},
+            Options: options.Index().SetUnique(true),
+        },
+        {Keys: bson.D{{Key: "post_id", Value: 1}, {Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}},
+        {Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "post_id", Value: 1}}},
+    })
+    return err
+}
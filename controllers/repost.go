@@ -0,0 +1,257 @@
+// controllers/repost.go
+package controllers
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "time"
+
+    "social-experiment/models"
+    "social-experiment/websocket"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// RepostPost handles sharing a post to the feed. Each user reposts a post at
+// most once; reposting again returns the existing repost.
+func RepostPost(db *mongo.Collection, users *mongo.Collection, notifications *mongo.Collection, hub *websocket.Hub, requireVerifiedEmail bool) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        var user models.User
+        err = users.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user)
+        if err == mongo.ErrNoDocuments {
+            c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+            return
+        }
+        if err != nil {
+            log.Printf("[ERROR] Error fetching user: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing request"})
+            return
+        }
+        if requireVerifiedEmail && !user.EmailVerified {
+            c.JSON(http.StatusForbidden, gin.H{"error": "Please verify your email address before posting"})
+            return
+        }
+
+        original, ok := findTargetPost(c, db, c.Param("id"), "post ID", "repost")
+        if !ok {
+            return
+        }
+        originals := []models.Post{*original}
+        if err := attachAuthors(users, originals); err != nil {
+            log.Printf("[ERROR] Error fetching post author: %v", err)
+        }
+
+        repost := models.Post{
+            ID:        primitive.NewObjectID(),
+            UserID:    user.ID,
+            Username:  user.Username,
+            CreatedAt: time.Now(),
+            RepostOf:  &original.ID,
+            Original:  &originals[0],
+            Author: &models.Author{
+                ID:          user.ID,
+                Username:    user.Username,
+                DisplayName: user.DisplayName,
+                AvatarURL:   user.AvatarURL,
+            },
+        }
+
+        // The unique index keeps concurrent requests from reposting twice
+        _, err = db.InsertOne(context.Background(), repost)
+        if mongo.IsDuplicateKeyError(err) {
+            var existing models.Post
+            err = db.FindOne(context.Background(), bson.M{"user_id": user.ID, "repost_of": original.ID}).Decode(&existing)
+            if err != nil {
+                log.Printf("[ERROR] Error fetching repost: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reposting"})
+                return
+            }
+            existing.Original = repost.Original
+            existing.Author = repost.Author
+            c.JSON(http.StatusOK, existing)
+            return
+        }
+        if err != nil {
+            log.Printf("[ERROR] Error creating repost: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error reposting"})
+            return
+        }
+
+        _, err = db.UpdateOne(context.Background(),
+            bson.M{"_id": original.ID},
+            bson.M{"$inc": bson.M{"repost_count": 1}},
+        )
+        if err != nil {
+            log.Printf("[ERROR] Error counting repost of post %s: %v", original.ID.Hex(), err)
+        }
+        if !original.UserID.IsZero() && original.UserID != user.ID {
+            notify(notifications, hub, original.UserID, models.NotificationRepost, repost)
+        }
+
+        hub.BroadcastPost(repost)
+        c.JSON(http.StatusOK, repost)
+    }
+}
+
+// UndoRepost handles taking back the user's repost of a post. Undoing a
+// repost that does not exist changes nothing.
+func UndoRepost(db *mongo.Collection, notifications *mongo.Collection, hub *websocket.Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+        originalID, err := primitive.ObjectIDFromHex(c.Param("id"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+            return
+        }
+
+        var repost models.Post
+        err = db.FindOne(context.Background(), bson.M{"user_id": userID, "repost_of": originalID}).Decode(&repost)
+        if err == mongo.ErrNoDocuments {
+            c.Status(http.StatusNoContent)
+            return
+        }
+        if err != nil {
+            log.Printf("[ERROR] Error fetching repost: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error undoing repost"})
+            return
+        }
+
+        if err := removeRepost(db, notifications, hub, &repost); err != nil {
+            log.Printf("[ERROR] Error undoing repost: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error undoing repost"})
+            return
+        }
+        c.Status(http.StatusNoContent)
+    }
+}
+
+// removeRepost deletes a repost, which has no content to keep a tombstone
+// for, and uncounts it on the original.
+func removeRepost(db *mongo.Collection, notifications *mongo.Collection, hub *websocket.Hub, repost *models.Post) error {
+    result, err := db.DeleteOne(context.Background(), bson.M{"_id": repost.ID})
+    if err != nil || result.DeletedCount == 0 {
+        return err
+    }
+
+    _, err = db.UpdateOne(context.Background(),
+        bson.M{"_id": *repost.RepostOf},
+        bson.M{"$inc": bson.M{"repost_count": -1}},
+    )
+    if err != nil {
+        log.Printf("[ERROR] Error uncounting repost of post %s: %v", repost.RepostOf.Hex(), err)
+    }
+    if _, err := notifications.DeleteMany(context.Background(), bson.M{"post_id": repost.ID}); err != nil {
+        log.Printf("[ERROR] Error deleting notifications about repost %s: %v", repost.ID.Hex(), err)
+    }
+
+    now := time.Now()
+    hub.BroadcastPostDeleted(models.Post{
+        ID:        repost.ID,
+        UserID:    repost.UserID,
+        Username:  repost.Username,
+        CreatedAt: repost.CreatedAt,
+        DeletedAt: &now,
+        RepostOf:  repost.RepostOf,
+    })
+    log.Printf("[INFO] Repost %s of post %s removed", repost.ID.Hex(), repost.RepostOf.Hex())
+    return nil
+}
+
+// attachPostDetails fills in everything responses show with each post: the
+// post it reposts or quotes, the authors, and the emoji the user reacted
+// with, using one query each however many posts there are. Deleted originals
+// are embedded as their tombstones. reactions is nil for responses sent to
+// everyone.
+func attachPostDetails(db *mongo.Collection, users *mongo.Collection, reactions *mongo.Collection, userID string, posts []models.Post) error {
+    seen := make(map[primitive.ObjectID]bool)
+    originalIDs := []primitive.ObjectID{}
+    for _, post := range posts {
+        for _, id := range []*primitive.ObjectID{post.RepostOf, post.QuoteOf} {
+            if id != nil && !seen[*id] {
+                seen[*id] = true
+                originalIDs = append(originalIDs, *id)
+            }
+        }
+    }
+
+    originals := []models.Post{}
+    if len(originalIDs) > 0 {
+        cursor, err := db.Find(context.Background(), bson.M{"_id": bson.M{"$in": originalIDs}})
+        if err != nil {
+            return err
+        }
+        if err := cursor.All(context.Background(), &originals); err != nil {
+            return err
+        }
+    }
+
+    all := append(append([]models.Post{}, posts...), originals...)
+    if err := attachAuthors(users, all); err != nil {
+        return err
+    }
+    if reactions != nil {
+        if err := attachReactedByMe(reactions, userID, all); err != nil {
+            return err
+        }
+    }
+    copy(posts, all[:len(posts)])
+
+    byID := make(map[primitive.ObjectID]*models.Post, len(originals))
+    for i := len(posts); i < len(all); i++ {
+        byID[all[i].ID] = &all[i]
+    }
+    for i := range posts {
+        if posts[i].RepostOf != nil {
+            posts[i].Original = byID[*posts[i].RepostOf]
+        } else if posts[i].QuoteOf != nil {
+            posts[i].Original = byID[*posts[i].QuoteOf]
+        }
+    }
+    return nil
+}
+
+// findTargetPost fetches the post with the given ID that a new post refers
+// to, responding with an error and returning false if it is missing, deleted
+// or a repost. field names the ID in errors and action what is done to it.
+func findTargetPost(c *gin.Context, db *mongo.Collection, id, field, action string) (*models.Post, bool) {
+    postID, err := primitive.ObjectIDFromHex(id)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + field})
+        return nil, false
+    }
+
+    var post models.Post
+    err = db.FindOne(context.Background(), bson.M{"_id": postID}).Decode(&post)
+    if err == mongo.ErrNoDocuments {
+        c.JSON(http.StatusNotFound, gin.H{"error": "Post to " + action + " not found"})
+        return nil, false
+    }
+    if err != nil {
+        log.Printf("[ERROR] Error fetching post: %v", err)
+        c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching post"})
+        return nil, false
+    }
+    if post.DeletedAt != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot " + action + " a deleted post"})
+        return nil, false
+    }
+    if post.RepostOf != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot " + action + " a repost; use the original post"})
+        return nil, false
+    }
+    return &post, true
+}
@@ -0,0 +1,104 @@
+// controllers/role.go
+package controllers
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "sort"
+
+    "social-experiment/utils"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// SetUserRoles replaces the roles of a user. The user's current access tokens
+// are revoked so the change takes effect on their next token refresh.
+func SetUserRoles(db *mongo.Collection, revocations *utils.RevocationList) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            Roles []string `json:"roles" binding:"required"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid roles request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        seen := make(map[string]bool)
+        roles := []string{}
+        for _, role := range req.Roles {
+            if !utils.IsKnownRole(role) {
+                c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + role})
+                return
+            }
+            if !seen[role] {
+                seen[role] = true
+                roles = append(roles, role)
+            }
+        }
+        sort.Strings(roles)
+
+        user, err := findUserByUsername(db, c.Param("username"), nil)
+        if err == mongo.ErrNoDocuments {
+            c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+            return
+        }
+        if err != nil {
+            log.Printf("[ERROR] Error fetching user: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating roles"})
+            return
+        }
+
+        // Admins cannot lock themselves out of role management
+        if user.ID.Hex() == c.GetString("userID") && !utils.RolesHavePermission(roles, utils.PermissionManageRoles) {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot remove your own permission to manage roles"})
+            return
+        }
+
+        _, err = db.UpdateOne(context.Background(),
+            bson.M{"_id": user.ID},
+            bson.M{"$set": bson.M{"roles": roles}},
+        )
+        if err != nil {
+            log.Printf("[ERROR] Error updating roles: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating roles"})
+            return
+        }
+
+        if err := revocations.RevokeUser(context.Background(), user.ID.Hex()); err != nil {
+            log.Printf("[ERROR] Error revoking access tokens after role change: %v", err)
+        }
+
+        log.Printf("[INFO] Roles of user %s set to %v (by UserID: %s)", user.Username, roles, c.GetString("userID"))
+        c.JSON(http.StatusOK, gin.H{"username": user.Username, "roles": roles})
+    }
+}
+
+// BootstrapAdmins grants the admin role to the listed existing users so the
+// first administrators can be created from configuration.
+func BootstrapAdmins(db *mongo.Collection, usernames []string) {
+    for _, username := range usernames {
+        if username == "" {
+            continue
+        }
+        result, err := db.UpdateOne(context.Background(),
+            bson.M{"username": username},
+            bson.M{"$addToSet": bson.M{"roles": utils.RoleAdmin}},
+        )
+        if err != nil {
+            log.Printf("[ERROR] Error granting admin role to %s: %v", username, err)
+            continue
+        }
+        if result.MatchedCount == 0 {
+            log.Printf("[WARNING] Admin user %s does not exist yet; restart after registering it", username)
+            continue
+        }
+        if result.ModifiedCount == 1 {
+            log.Printf("[INFO] Granted admin role to %s", username)
+        }
+    }
+}
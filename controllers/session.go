@@ -0,0 +1,112 @@
+// controllers/session.go
+package controllers
+
+import (
+    "context"
+    "log"
+    "net/http"
+    "strings"
+
+    "social-experiment/utils"
+    "social-experiment/websocket"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxDeviceLabelLength caps client-supplied device names
+const maxDeviceLabelLength = 64
+
+// ListSessions returns the devices the user is signed in on, marking the one
+// making the request as current.
+func ListSessions(sessions *utils.SessionStore) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        claims := c.MustGet("claims").(*utils.Claims)
+
+        userID, err := primitive.ObjectIDFromHex(claims.UserID)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        list, err := sessions.List(context.Background(), userID)
+        if err != nil {
+            log.Printf("[ERROR] Error fetching sessions: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching sessions"})
+            return
+        }
+
+        response := make([]gin.H, 0, len(list))
+        for _, session := range list {
+            response = append(response, gin.H{
+                "id":           session.ID.Hex(),
+                "device_label": session.DeviceLabel,
+                "user_agent":   session.UserAgent,
+                "ip":           session.IP,
+                "created_at":   session.CreatedAt,
+                "last_seen_at": session.LastSeenAt,
+                "current":      session.ID.Hex() == claims.SessionID,
+            })
+        }
+
+        c.JSON(http.StatusOK, response)
+    }
+}
+
+// RevokeSession signs one of the user's devices out: its refresh tokens and
+// access tokens stop working and its WebSocket connections are closed.
+func RevokeSession(revocations *utils.RevocationList, issuer *utils.TokenIssuer, hub *websocket.Hub) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+        sessionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+            return
+        }
+
+        revoked, err := endSession(userID, sessionID, revocations, issuer, hub)
+        if err != nil {
+            log.Printf("[ERROR] Error revoking session: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking session"})
+            return
+        }
+        if !revoked {
+            c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+            return
+        }
+
+        c.Status(http.StatusNoContent)
+    }
+}
+
+// endSession revokes a session with its refresh and access tokens and closes
+// its WebSocket connections. It returns false if the user has no such session.
+func endSession(userID, sessionID primitive.ObjectID, revocations *utils.RevocationList, issuer *utils.TokenIssuer, hub *websocket.Hub) (bool, error) {
+    revoked, err := issuer.RevokeSession(context.Background(), userID, sessionID)
+    if err != nil || !revoked {
+        return revoked, err
+    }
+    if err := revocations.RevokeSession(context.Background(), sessionID.Hex()); err != nil {
+        return true, err
+    }
+    hub.DisconnectSession(sessionID.Hex())
+    return true, nil
+}
+
+// sessionInfo describes the requesting device for a new session, preferring
+// a name supplied by the client over one derived from the User-Agent.
+func sessionInfo(c *gin.Context, deviceName string) utils.SessionInfo {
+    deviceName = strings.TrimSpace(deviceName)
+    if runes := []rune(deviceName); len(runes) > maxDeviceLabelLength {
+        deviceName = string(runes[:maxDeviceLabelLength])
+    }
+    return utils.SessionInfo{
+        DeviceLabel: deviceName,
+        UserAgent:   c.Request.UserAgent(),
+        IP:          c.ClientIP(),
+    }
+}
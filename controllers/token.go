@@ -0,0 +1,54 @@
+// controllers/token.go
+package controllers
+
+import (
+    "context"
+    "log"
+    "net/http"
+
+    "social-experiment/utils"
+
+    "github.com/gin-gonic/gin"
+)
+
+// RefreshToken exchanges a refresh token for a new access/refresh token pair.
+// The presented refresh token is consumed; replaying it revokes its whole family.
+func RefreshToken(issuer *utils.TokenIssuer) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            RefreshToken string `json:"refresh_token" binding:"required"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid refresh request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        tokens, err := issuer.Refresh(context.Background(), req.RefreshToken)
+        switch err {
+        case nil:
+        case utils.ErrRefreshTokenReused:
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token reuse detected, please log in again"})
+            return
+        case utils.ErrRefreshTokenInvalid:
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired refresh token"})
+            return
+        default:
+            log.Printf("[ERROR] Error refreshing token: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error refreshing token"})
+            return
+        }
+
+        c.JSON(http.StatusOK, tokens)
+    }
+}
+
+// JWKS publishes the public keys that verify our access tokens so other
+// services can validate them without sharing a secret.
+func JWKS(keys *utils.KeyRing) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        c.Header("Cache-Control", "public, max-age=300")
+        c.JSON(http.StatusOK, keys.JWKS())
+    }
+}
@@ -0,0 +1,319 @@
+// controllers/two_factor.go
+package controllers
+
+import (
+    "context"
+    "encoding/base64"
+    "log"
+    "net/http"
+    "time"
+
+    "social-experiment/models"
+    "social-experiment/utils"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+)
+
+// recoveryCodeCount is the number of one-time recovery codes issued on enrollment
+const recoveryCodeCount = 10
+
+// SetupTwoFactor starts TOTP enrollment by generating a pending secret and
+// returning it as an otpauth URI and QR code. It is activated by ConfirmTwoFactor.
+func SetupTwoFactor(db *mongo.Collection, totpIssuer string) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        user, ok := currentUser(c, db)
+        if !ok {
+            return
+        }
+        if user.TOTPEnabled {
+            c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+            return
+        }
+
+        secret, err := utils.GenerateTOTPSecret()
+        if err != nil {
+            log.Printf("[ERROR] Error generating TOTP secret: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error setting up two-factor authentication"})
+            return
+        }
+
+        uri := utils.TOTPURI(totpIssuer, user.Username, secret)
+        qrCode, err := utils.TOTPQRCode(uri)
+        if err != nil {
+            log.Printf("[ERROR] Error rendering TOTP QR code: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error setting up two-factor authentication"})
+            return
+        }
+
+        _, err = db.UpdateOne(context.Background(),
+            bson.M{"_id": user.ID},
+            bson.M{"$set": bson.M{"totp_pending_secret": secret}},
+        )
+        if err != nil {
+            log.Printf("[ERROR] Error saving TOTP secret: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error setting up two-factor authentication"})
+            return
+        }
+
+        c.JSON(http.StatusOK, gin.H{
+            "secret":      secret,
+            "otpauth_uri": uri,
+            "qr_png":      "data:image/png;base64," + base64.StdEncoding.EncodeToString(qrCode),
+        })
+    }
+}
+
+// ConfirmTwoFactor activates the pending TOTP secret once the user proves their
+// authenticator produces valid codes, and returns one-time recovery codes.
+func ConfirmTwoFactor(db *mongo.Collection) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            Code string `json:"code" binding:"required"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid 2FA confirm request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        user, ok := currentUser(c, db)
+        if !ok {
+            return
+        }
+        if user.TOTPEnabled {
+            c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+            return
+        }
+        if user.TOTPPending == "" {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor setup has not been started"})
+            return
+        }
+
+        step, valid := utils.ValidateTOTP(user.TOTPPending, req.Code, time.Now(), 0)
+        if !valid {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid code"})
+            return
+        }
+
+        codes, hashes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+        if err != nil {
+            log.Printf("[ERROR] Error generating recovery codes: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error enabling two-factor authentication"})
+            return
+        }
+
+        _, err = db.UpdateOne(context.Background(),
+            bson.M{"_id": user.ID, "totp_pending_secret": user.TOTPPending},
+            bson.M{
+                "$set": bson.M{
+                    "totp_enabled":   true,
+                    "totp_secret":    user.TOTPPending,
+                    "totp_last_step": step,
+                    "recovery_codes": hashes,
+                },
+                "$unset": bson.M{"totp_pending_secret": ""},
+            },
+        )
+        if err != nil {
+            log.Printf("[ERROR] Error enabling 2FA: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error enabling two-factor authentication"})
+            return
+        }
+
+        c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+    }
+}
+
+// DisableTwoFactor turns off TOTP after checking a current code or recovery code.
+func DisableTwoFactor(db *mongo.Collection) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            Code         string `json:"code"`
+            RecoveryCode string `json:"recovery_code"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid 2FA disable request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        user, ok := currentUser(c, db)
+        if !ok {
+            return
+        }
+        if !user.TOTPEnabled {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+            return
+        }
+
+        valid, err := checkSecondFactor(db, user, req.Code, req.RecoveryCode)
+        if err != nil {
+            log.Printf("[ERROR] Error checking 2FA code: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing request"})
+            return
+        }
+        if !valid {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+            return
+        }
+
+        _, err = db.UpdateOne(context.Background(),
+            bson.M{"_id": user.ID},
+            bson.M{
+                "$set":   bson.M{"totp_enabled": false, "totp_last_step": 0},
+                "$unset": bson.M{"totp_secret": "", "recovery_codes": ""},
+            },
+        )
+        if err != nil {
+            log.Printf("[ERROR] Error disabling 2FA: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error disabling two-factor authentication"})
+            return
+        }
+
+        c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+    }
+}
+
+// LoginTwoFactor completes a two-factor login by exchanging the challenge token
+// from Login plus a TOTP or recovery code for access and refresh tokens.
+func LoginTwoFactor(db *mongo.Collection, issuer *utils.TokenIssuer, revocations *utils.RevocationList, throttle *utils.LoginThrottle) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            ChallengeToken string `json:"challenge_token" binding:"required"`
+            Code           string `json:"code"`
+            RecoveryCode   string `json:"recovery_code"`
+            DeviceName     string `json:"device_name"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid 2FA login request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        claims, err := issuer.VerifyChallenge(req.ChallengeToken)
+        if err != nil {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+            return
+        }
+        revoked, err := revocations.IsRevoked(context.Background(), claims)
+        if err != nil || revoked {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+            return
+        }
+
+        userID, err := primitive.ObjectIDFromHex(claims.UserID)
+        if err != nil {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+            return
+        }
+
+        var user models.User
+        if err := db.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user); err != nil {
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired challenge"})
+            return
+        }
+
+        // Wrong codes count towards the same lockout as wrong passwords
+        if !reserveLoginAttempt(c, throttle, user.Username) {
+            return
+        }
+
+        valid, err := checkSecondFactor(db, &user, req.Code, req.RecoveryCode)
+        if err != nil {
+            log.Printf("[ERROR] Error checking 2FA code: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing request"})
+            return
+        }
+        if !valid {
+            log.Printf("[WARNING] Invalid 2FA code for user: %s", user.Username)
+            c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid code"})
+            return
+        }
+
+        if err := throttle.RecordSuccess(context.Background(), user.Username, c.ClientIP()); err != nil {
+            log.Printf("[ERROR] Error clearing login failures: %v", err)
+        }
+
+        // The challenge is single-use
+        if err := revocations.RevokeToken(context.Background(), claims); err != nil {
+            log.Printf("[ERROR] Error revoking 2FA challenge: %v", err)
+        }
+
+        if !cancelAccountDeletion(c, db, &user) {
+            return
+        }
+
+        tokens, err := issuer.Issue(context.Background(), user.ID, sessionInfo(c, req.DeviceName))
+        if err != nil {
+            log.Printf("[ERROR] Error generating token: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error generating token"})
+            return
+        }
+
+        c.JSON(http.StatusOK, tokens)
+    }
+}
+
+// checkSecondFactor verifies a TOTP code or consumes a recovery code. Accepted
+// TOTP steps are recorded atomically so the same code cannot be used twice.
+func checkSecondFactor(db *mongo.Collection, user *models.User, code, recoveryCode string) (bool, error) {
+    if !user.TOTPEnabled {
+        return false, nil
+    }
+
+    if code != "" {
+        step, valid := utils.ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep)
+        if !valid {
+            return false, nil
+        }
+        result, err := db.UpdateOne(context.Background(),
+            bson.M{"_id": user.ID, "totp_last_step": bson.M{"$lt": step}},
+            bson.M{"$set": bson.M{"totp_last_step": step}},
+        )
+        if err != nil {
+            return false, err
+        }
+        return result.ModifiedCount == 1, nil
+    }
+
+    if recoveryCode != "" {
+        hash := utils.HashRecoveryCode(recoveryCode)
+        result, err := db.UpdateOne(context.Background(),
+            bson.M{"_id": user.ID, "recovery_codes": hash},
+            bson.M{"$pull": bson.M{"recovery_codes": hash}},
+        )
+        if err != nil {
+            return false, err
+        }
+        return result.ModifiedCount == 1, nil
+    }
+
+    return false, nil
+}
+
+// currentUser loads the authenticated user, writing an error response on failure.
+func currentUser(c *gin.Context, db *mongo.Collection) (*models.User, bool) {
+    userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+        return nil, false
+    }
+
+    var user models.User
+    if err := db.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user); err != nil {
+        if err == mongo.ErrNoDocuments {
+            c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+        } else {
+            log.Printf("[ERROR] Error fetching user: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing request"})
+        }
+        return nil, false
+    }
+    return &user, true
+}
@@ -0,0 +1,268 @@
+// controllers/username.go
+package controllers
+
+import (
+    "context"
+    "fmt"
+    "log"
+    "math"
+    "net/http"
+    "strconv"
+    "time"
+
+    "social-experiment/models"
+    "social-experiment/utils"
+
+    "github.com/gin-gonic/gin"
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+    "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ChangeUsername renames the authenticated user's account, at most once per
+// cooldown. The old handle stays reserved for the user and redirects to the
+// account for the reservation period. Existing posts are moved to the new name.
+func ChangeUsername(db *mongo.Collection, posts *mongo.Collection, usernames *utils.UsernamePolicy, cooldown, reservation time.Duration) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        var req struct {
+            Username string `json:"username"`
+        }
+
+        if err := c.ShouldBindJSON(&req); err != nil {
+            log.Printf("[WARNING] Invalid username change request: %v", err)
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+            return
+        }
+
+        username, ok := checkUsername(c, usernames, req.Username)
+        if !ok {
+            return
+        }
+
+        userID, err := primitive.ObjectIDFromHex(c.GetString("userID"))
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+            return
+        }
+
+        var user models.User
+        if err := db.FindOne(context.Background(), bson.M{"_id": userID}).Decode(&user); err != nil {
+            if err == mongo.ErrNoDocuments {
+                c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+            } else {
+                log.Printf("[ERROR] Error fetching user: %v", err)
+                c.JSON(http.StatusInternalServerError, gin.H{"error": "Error processing request"})
+            }
+            return
+        }
+
+        if username == user.Username {
+            c.JSON(http.StatusBadRequest, gin.H{"error": "This is already your username"})
+            return
+        }
+
+        now := time.Now()
+        if user.UsernameChangedAt != nil {
+            if wait := user.UsernameChangedAt.Add(cooldown).Sub(now); wait > 0 {
+                c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+                c.JSON(http.StatusTooManyRequests, gin.H{"error": "You changed your username recently. Please try again later."})
+                return
+            }
+        }
+
+        taken, err := usernameTaken(db, username, user.ID)
+        if err != nil {
+            log.Printf("[ERROR] Database error: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+            return
+        }
+        if taken {
+            c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+            return
+        }
+
+        oldUsername := user.Username
+
+        skeleton := utils.UsernameSkeleton(username)
+
+        // Reserve the old handle, dropping lapsed reservations and the one
+        // being taken back
+        previous := []models.PreviousUsername{}
+        for _, entry := range user.PreviousUsernames {
+            if entry.ReservedUntil.After(now) && entry.Skeleton != skeleton {
+                previous = append(previous, entry)
+            }
+        }
+        previous = append(previous, models.PreviousUsername{
+            Username:      oldUsername,
+            Skeleton:      utils.UsernameSkeleton(oldUsername),
+            ChangedAt:     now,
+            ReservedUntil: now.Add(reservation),
+        })
+
+        // The old username in the filter guards against concurrent renames
+        err = db.FindOneAndUpdate(context.Background(),
+            bson.M{"_id": user.ID, "username": oldUsername},
+            bson.M{"$set": bson.M{
+                "username":            username,
+                "username_key":        utils.UsernameKey(username),
+                "username_skeleton":   skeleton,
+                "username_changed_at": now,
+                "previous_usernames":  previous,
+            }},
+            options.FindOneAndUpdate().SetReturnDocument(options.After),
+        ).Decode(&user)
+        if err == mongo.ErrNoDocuments {
+            c.JSON(http.StatusConflict, gin.H{"error": "Your username was changed meanwhile"})
+            return
+        }
+        if mongo.IsDuplicateKeyError(err) {
+            c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+            return
+        }
+        if err != nil {
+            log.Printf("[ERROR] Error changing username: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error changing username"})
+            return
+        }
+
+        // Posts also show the author's current username, so a failure here
+        // only leaves stale copies behind
+        if _, err := posts.UpdateMany(context.Background(),
+            bson.M{"user_id": user.ID},
+            bson.M{"$set": bson.M{"username": username}},
+        ); err != nil {
+            log.Printf("[ERROR] Error renaming posts of user %s: %v", user.ID.Hex(), err)
+        }
+
+        log.Printf("[INFO] Username changed: %s -> %s", oldUsername, username)
+        c.JSON(http.StatusOK, user)
+    }
+}
+
+// checkUsername validates a requested username, responding with 400 and
+// returning false if it cannot be used.
+func checkUsername(c *gin.Context, usernames *utils.UsernamePolicy, username string) (string, bool) {
+    username, err := usernames.Validate(username)
+    switch err {
+    case nil:
+        return username, true
+    case utils.ErrUsernameRequired:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Username is required"})
+    case utils.ErrUsernameLength:
+        c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Username must be %d to %d characters long", utils.MinUsernameLength, utils.MaxUsernameLength)})
+    case utils.ErrUsernameCharacters:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Username may only contain letters, digits, '_', '.' and '-', and must start and end with a letter or digit"})
+    case utils.ErrUsernameMixedScripts:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Username cannot mix letters from different alphabets"})
+    case utils.ErrUsernameReserved:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "This username is reserved"})
+    default:
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid username"})
+    }
+    return "", false
+}
+
+// usernameTaken reports whether another account uses the username or one that
+// looks like it, or still holds such a name as a previous handle.
+func usernameTaken(db *mongo.Collection, username string, userID primitive.ObjectID) (bool, error) {
+    skeleton := utils.UsernameSkeleton(username)
+    count, err := db.CountDocuments(context.Background(), bson.M{
+        "_id": bson.M{"$ne": userID},
+        "$or": []bson.M{
+            {"username_skeleton": skeleton},
+            {"username_key": utils.UsernameKey(username)},
+            {"previous_usernames": bson.M{"$elemMatch": bson.M{
+                "skeleton":       skeleton,
+                "reserved_until": bson.M{"$gt": time.Now()},
+            }}},
+        },
+    }, options.Count().SetLimit(1))
+    if err != nil {
+        return false, err
+    }
+    return count > 0, nil
+}
+
+// findUserByUsername looks a user up by username regardless of case and
+// Unicode normalization, also matching the extra filter conditions. An exact
+// match wins, as accounts created before usernames were normalized may differ
+// only in case. It returns mongo.ErrNoDocuments if there is no such user.
+func findUserByUsername(db *mongo.Collection, username string, filter bson.M) (*models.User, error) {
+    var user models.User
+    for _, condition := range []bson.M{{"username": username}, {"username_key": utils.UsernameKey(username)}} {
+        for key, value := range filter {
+            condition[key] = value
+        }
+        err := db.FindOne(context.Background(), condition).Decode(&user)
+        if err == nil {
+            return &user, nil
+        }
+        if err != mongo.ErrNoDocuments {
+            return nil, err
+        }
+    }
+    return nil, mongo.ErrNoDocuments
+}
+
+// findRenamedUser returns the account that gave up the username, or one that
+// looks like it, within its reservation period, if any.
+func findRenamedUser(db *mongo.Collection, username string) (*models.User, error) {
+    var user models.User
+    err := db.FindOne(context.Background(), bson.M{
+        "previous_usernames": bson.M{"$elemMatch": bson.M{
+            "skeleton":       utils.UsernameSkeleton(username),
+            "reserved_until": bson.M{"$gt": time.Now()},
+        }},
+        "deletion_scheduled_at": nil,
+    }).Decode(&user)
+    if err == mongo.ErrNoDocuments {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, err
+    }
+    return &user, nil
+}
+
+// BackfillUsernameKeys stores the lookup key and skeleton of accounts created
+// before usernames were normalized. Accounts whose skeleton collides with
+// another account keep working but get no skeleton, leaving the unique index
+// to the first of them.
+func BackfillUsernameKeys(db *mongo.Collection) {
+    cursor, err := db.Find(context.Background(), bson.M{"username_key": bson.M{"$exists": false}})
+    if err != nil {
+        log.Printf("[ERROR] Error fetching users to normalize: %v", err)
+        return
+    }
+    defer cursor.Close(context.Background())
+
+    for cursor.Next(context.Background()) {
+        var user models.User
+        if err := cursor.Decode(&user); err != nil {
+            log.Printf("[ERROR] Error decoding user: %v", err)
+            return
+        }
+
+        set := bson.M{"username_key": utils.UsernameKey(user.Username)}
+        skeleton := utils.UsernameSkeleton(user.Username)
+        count, err := db.CountDocuments(context.Background(), bson.M{"username_skeleton": skeleton}, options.Count().SetLimit(1))
+        if err != nil {
+            log.Printf("[ERROR] Database error: %v", err)
+            return
+        }
+        if count == 0 {
+            set["username_skeleton"] = skeleton
+        } else {
+            log.Printf("[WARNING] Username %s looks like another account's; it cannot be reserved", user.Username)
+        }
+        for i, entry := range user.PreviousUsernames {
+            set[fmt.Sprintf("previous_usernames.%d.skeleton", i)] = utils.UsernameSkeleton(entry.Username)
+        }
+
+        if _, err := db.UpdateOne(context.Background(), bson.M{"_id": user.ID}, bson.M{"$set": set}); err != nil {
+            log.Printf("[ERROR] Error normalizing username %s: %v", user.Username, err)
+        }
+    }
+}
@@ -0,0 +1,30 @@
+// controllers/ws_ticket.go
+package controllers
+
+import (
+    "context"
+    "log"
+    "net/http"
+
+    "social-experiment/utils"
+
+    "github.com/gin-gonic/gin"
+)
+
+// IssueWebSocketTicket returns a single-use ticket that lets the page it was
+// requested from open one WebSocket connection as the authenticated user.
+func IssueWebSocketTicket(tickets *utils.WebSocketTicketStore) gin.HandlerFunc {
+    return func(c *gin.Context) {
+        claims := c.MustGet("claims").(*utils.Claims)
+
+        ticket, err := tickets.Issue(context.Background(), claims, c.GetHeader("Origin"))
+        if err != nil {
+            log.Printf("[ERROR] Error issuing WebSocket ticket: %v", err)
+            c.JSON(http.StatusInternalServerError, gin.H{"error": "Error issuing ticket"})
+            return
+        }
+
+        c.Header("Cache-Control", "no-store")
+        c.JSON(http.StatusOK, gin.H{"ticket": ticket, "expires_in": int64(utils.WebSocketTicketTTL.Seconds())})
+    }
+}
@@ -3,12 +3,20 @@ import { NgModule } from '@angular/core';
 import { RouterModule, Routes } from '@angular/router';
 import { LoginComponent } from './components/auth/login/login.component';
 import { RegisterComponent } from './components/auth/register/register.component';
+import { OidcCallbackComponent } from './components/auth/oidc-callback/oidc-callback.component';
+import { OauthConsentComponent } from './components/auth/oauth-consent/oauth-consent.component';
 import { FeedComponent } from './components/feed/feed.component';
 import { AuthGuard } from './guards/auth.guard';
 
 const routes: Routes = [
   { path: 'login', component: LoginComponent },
   { path: 'register', component: RegisterComponent },
+  { path: 'oidc/callback', component: OidcCallbackComponent },
+  {
+    path: 'oauth/authorize',
+    component: OauthConsentComponent,
+    canActivate: [AuthGuard],
+  },
   {
     path: '',
     component: FeedComponent,
@@ -15,6 +15,8 @@ import { MatCardModule } from '@angular/material/card';
 import { AppComponent } from './app.component';
 import { LoginComponent } from './components/auth/login/login.component';
 import { RegisterComponent } from './components/auth/register/register.component';
+import { OidcCallbackComponent } from './components/auth/oidc-callback/oidc-callback.component';
+import { OauthConsentComponent } from './components/auth/oauth-consent/oauth-consent.component';
 import { FeedComponent } from './components/feed/feed.component';
 import { PostFormComponent } from './components/feed/post-form/post-form.component';
 import { PostListComponent } from './components/feed/post-list/post-list.component';
@@ -36,6 +38,8 @@ import { AppRoutingModule } from './app-routing.module';
     AppComponent,
     LoginComponent,
     RegisterComponent,
+    OidcCallbackComponent,
+    OauthConsentComponent,
     FeedComponent,
     PostFormComponent,
     PostListComponent,
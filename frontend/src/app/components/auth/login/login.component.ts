@@ -1,8 +1,8 @@
 // /frontend/src/app/components/auth/login/login.component.ts
-import { Component } from '@angular/core';
+import { Component, OnInit } from '@angular/core';
 import { FormBuilder, FormGroup, Validators } from '@angular/forms';
 import { AuthService } from '../../../services/auth.service';
-import { Router } from '@angular/router';
+import { ActivatedRoute, Router } from '@angular/router';
 
 @Component({
   selector: 'app-login',
@@ -26,6 +26,16 @@ import { Router } from '@angular/router';
           </mat-error>
         </mat-form-field>
 
+        <mat-form-field class="full-width" *ngIf="challengeToken">
+          <mat-label>Authentication code</mat-label>
+          <input
+            matInput
+            formControlName="code"
+            autocomplete="one-time-code"
+            inputmode="numeric"
+          />
+        </mat-form-field>
+
         <button
           mat-raised-button
           color="primary"
@@ -39,6 +49,16 @@ import { Router } from '@angular/router';
           {{ error }}
         </div>
       </form>
+
+      <div *ngIf="providers.length && !challengeToken" class="providers">
+        <button
+          mat-stroked-button
+          *ngFor="let provider of providers"
+          (click)="loginWith(provider)"
+        >
+          Sign in with {{ provider }}
+        </button>
+      </div>
     </mat-card>
   `,
   styles: [
@@ -57,31 +77,96 @@ import { Router } from '@angular/router';
         color: red;
         margin-top: 10px;
       }
+
+      .providers {
+        display: flex;
+        flex-direction: column;
+        gap: 8px;
+        margin-top: 20px;
+      }
     `,
   ],
 })
-export class LoginComponent {
+export class LoginComponent implements OnInit {
   loginForm: FormGroup;
   error: string = '';
+  challengeToken: string = '';
+  providers: string[] = [];
 
   constructor(
     private fb: FormBuilder,
     private auth: AuthService,
-    private router: Router
+    private router: Router,
+    private route: ActivatedRoute
   ) {
     this.loginForm = this.fb.group({
       username: ['', Validators.required],
       password: ['', Validators.required],
+      code: [''],
+    });
+
+    // Sign-ins through an identity provider may still need the second factor
+    const challengeToken = history.state?.challengeToken;
+    if (challengeToken) {
+      this.challengeToken = challengeToken;
+      this.loginForm.get('username')?.clearValidators();
+      this.loginForm.get('password')?.clearValidators();
+      this.loginForm.get('username')?.updateValueAndValidity();
+      this.loginForm.get('password')?.updateValueAndValidity();
+    }
+  }
+
+  ngOnInit() {
+    this.auth.oidcProviders().subscribe({
+      next: (res) => (this.providers = res.providers || []),
+      error: () => (this.providers = []),
     });
   }
 
+  loginWith(provider: string) {
+    this.auth.startOidc(provider).subscribe({
+      next: (res) => {
+        window.location.href = res.authorization_url;
+      },
+      error: (err) => {
+        this.error = 'Identity provider is unavailable';
+        console.error('Login error:', err);
+      },
+    });
+  }
+
+  // returnUrl only ever points inside the app
+  private returnUrl(): string {
+    const url = this.route.snapshot.queryParamMap.get('returnUrl') || '/';
+    return url.startsWith('/') && !url.startsWith('//') ? url : '/';
+  }
+
   async onSubmit() {
     if (this.loginForm.invalid) return;
 
+    if (this.challengeToken) {
+      this.auth
+        .loginTwoFactor(this.challengeToken, this.loginForm.value.code)
+        .subscribe({
+          next: () => {
+            this.router.navigateByUrl(this.returnUrl());
+          },
+          error: (err) => {
+            this.error = 'Invalid authentication code';
+            console.error('Login error:', err);
+          },
+        });
+      return;
+    }
+
     const { username, password } = this.loginForm.value;
     this.auth.login(username, password).subscribe({
       next: (res) => {
-        this.router.navigate(['/']);
+        if (res.two_factor_required) {
+          this.challengeToken = res.challenge_token;
+          return;
+        }
+        this.router.navigateByUrl(this.returnUrl());
       },
       error: (err) => {
         this.error = 'Invalid credentials';
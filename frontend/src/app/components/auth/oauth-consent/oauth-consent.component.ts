@@ -0,0 +1,100 @@
+// /frontend/src/app/components/auth/oauth-consent/oauth-consent.component.ts
+import { Component, OnInit } from '@angular/core';
+import { ActivatedRoute } from '@angular/router';
+import { AuthService } from '../../../services/auth.service';
+
+// Human-readable descriptions of the scopes an application can ask for
+const scopeDescriptions: { [scope: string]: string } = {
+  'posts:read': 'Read posts',
+  'posts:write': 'Create posts on your behalf',
+  'profile:read': 'View profiles',
+  'profile:write': 'Edit your profile',
+  'ws:subscribe': 'Receive live updates',
+};
+
+@Component({
+  selector: 'app-oauth-consent',
+  template: `
+    <mat-card>
+      <div *ngIf="client && consentRequired">
+        <h2>Authorize {{ client.name }}</h2>
+        <p>{{ client.name }} would like to:</p>
+        <ul>
+          <li *ngFor="let scope of scopes">{{ describe(scope) }}</li>
+        </ul>
+        <button mat-raised-button color="primary" (click)="decide(true)">
+          Allow
+        </button>
+        <button mat-button (click)="decide(false)">Deny</button>
+      </div>
+      <p *ngIf="!error && !consentRequired">Redirecting...</p>
+      <div *ngIf="error" class="error">
+        {{ error }}
+      </div>
+    </mat-card>
+  `,
+  styles: [
+    `
+      mat-card {
+        max-width: 400px;
+        margin: 50px auto;
+        padding: 20px;
+      }
+
+      button {
+        margin-right: 10px;
+      }
+
+      .error {
+        color: red;
+      }
+    `,
+  ],
+})
+export class OauthConsentComponent implements OnInit {
+  client: any = null;
+  scopes: string[] = [];
+  consentRequired = false;
+  error: string = '';
+  private params: any = {};
+
+  constructor(private route: ActivatedRoute, private auth: AuthService) {}
+
+  ngOnInit() {
+    this.params = this.route.snapshot.queryParams;
+    this.auth.oauthAuthorization(this.params).subscribe({
+      next: (res) => {
+        this.client = res.client;
+        this.scopes = res.scopes;
+        this.consentRequired = res.consent_required;
+        // Applications the user already authorized are sent back right away
+        if (!this.consentRequired) {
+          this.decide(true);
+        }
+      },
+      error: (err) => this.fail(err),
+    });
+  }
+
+  describe(scope: string): string {
+    return scopeDescriptions[scope] || scope;
+  }
+
+  decide(approve: boolean) {
+    this.auth.authorizeOauth(this.params, approve).subscribe({
+      next: (res) => {
+        window.location.href = res.redirect_to;
+      },
+      error: (err) => this.fail(err),
+    });
+  }
+
+  private fail(err: any) {
+    if (err.error?.redirect_to) {
+      window.location.href = err.error.redirect_to;
+      return;
+    }
+    this.error = err.error?.error || 'Authorization failed';
+    console.error('OAuth authorization error:', err);
+  }
+}
@@ -0,0 +1,65 @@
+// /frontend/src/app/components/auth/oidc-callback/oidc-callback.component.ts
+import { Component, OnInit } from '@angular/core';
+import { ActivatedRoute, Router } from '@angular/router';
+import { AuthService } from '../../../services/auth.service';
+
+@Component({
+  selector: 'app-oidc-callback',
+  template: `
+    <mat-card>
+      <p *ngIf="!error">Signing you in...</p>
+      <div *ngIf="error" class="error">
+        {{ error }}
+        <p><a routerLink="/login">Back to login</a></p>
+      </div>
+    </mat-card>
+  `,
+  styles: [
+    `
+      mat-card {
+        max-width: 400px;
+        margin: 50px auto;
+        padding: 20px;
+      }
+
+      .error {
+        color: red;
+      }
+    `,
+  ],
+})
+export class OidcCallbackComponent implements OnInit {
+  error: string = '';
+
+  constructor(
+    private route: ActivatedRoute,
+    private auth: AuthService,
+    private router: Router
+  ) {}
+
+  ngOnInit() {
+    const params = this.route.snapshot.queryParamMap;
+    const code = params.get('code');
+    const state = params.get('state');
+    if (!code || !state) {
+      this.error = params.get('error_description') || 'Sign-in was cancelled';
+      return;
+    }
+
+    this.auth.completeOidc(code, state).subscribe({
+      next: (res) => {
+        if (res.two_factor_required) {
+          this.router.navigate(['/login'], {
+            state: { challengeToken: res.challenge_token },
+          });
+          return;
+        }
+        this.router.navigate(['/']);
+      },
+      error: (err) => {
+        this.error = err.error?.error || 'Sign-in failed';
+        console.error('OIDC sign-in error:', err);
+      },
+    });
+  }
+}
@@ -84,7 +84,8 @@ export class RegisterComponent {
         this.router.navigate(['/']);
       },
       error: (err) => {
-        this.error = 'Registration failed';
+        // Password policy rejections carry a code and a user-facing message
+        this.error = err.error?.code ? err.error.error : 'Registration failed';
         console.error('Registration error:', err);
       },
     });
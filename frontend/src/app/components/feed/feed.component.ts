@@ -1,6 +1,6 @@
 // /frontend/src/app/components/feed/feed.component.ts
 import { Component, OnInit } from '@angular/core';
-import { Post } from '../../models/post.model';
+import { Post, PostEvent, PostPage } from '../../models/post.model';
 import { WebSocketService } from '../../services/websocket.service';
 import { HttpClient } from '@angular/common/http';
 import { AuthService } from '../../services/auth.service';
@@ -10,10 +10,20 @@ import { AuthService } from '../../services/auth.service';
   template: `
     <app-post-form (newPost)="addPost($event)"></app-post-form>
     <app-post-list [posts]="posts"></app-post-list>
+    <button
+      *ngIf="next"
+      mat-button
+      (click)="loadMore()"
+      [disabled]="loading"
+    >
+      Load more
+    </button>
   `,
 })
 export class FeedComponent implements OnInit {
   posts: Post[] = [];
+  next?: string;
+  loading = false;
 
   constructor(
     private wsService: WebSocketService,
@@ -24,15 +34,72 @@ export class FeedComponent implements OnInit {
   ngOnInit() {
     this.fetchPosts();
 
-    this.wsService.getNewPosts().subscribe((post: Post) => {
-      this.posts.unshift(post);
+    this.wsService.getPostEvents().subscribe((event: PostEvent) => {
+      const reactions = event.reactions;
+      if (event.type === 'post.reactions' && reactions) {
+        this.updatePost(reactions.post_id, (post) => ({
+          ...post,
+          reactions: reactions.counts,
+        }));
+        return;
+      }
+
+      const changed = event.post;
+      if (!changed) return;
+
+      switch (event.type) {
+        case 'post.created':
+          this.addPost(changed);
+          // Keep the counts of the post it answers, reposts or quotes current
+          if (changed.in_reply_to) {
+            this.updatePost(changed.in_reply_to, (post) => ({
+              ...post,
+              reply_count: post.reply_count + 1,
+            }));
+          }
+          if (changed.repost_of) {
+            this.updatePost(changed.repost_of, (post) => ({
+              ...post,
+              repost_count: post.repost_count + 1,
+            }));
+          }
+          if (changed.quote_of) {
+            this.updatePost(changed.quote_of, (post) => ({
+              ...post,
+              quote_count: post.quote_count + 1,
+            }));
+          }
+          break;
+        case 'post.updated':
+          this.updatePost(changed.id, (post) => ({
+            ...changed,
+            reacted_by_me: post.reacted_by_me,
+          }));
+          break;
+        case 'post.deleted':
+          this.posts = this.posts.filter((post) => post.id !== changed.id);
+          if (changed.repost_of) {
+            this.updatePost(changed.repost_of, (post) => ({
+              ...post,
+              repost_count: Math.max(post.repost_count - 1, 0),
+            }));
+          }
+          // Reposts and quotes of the post now show its tombstone
+          this.updatePost(changed.id, () => changed);
+          break;
+      }
+    });
+
+    this.wsService.getReconnects().subscribe(() => {
+      this.fetchMissedPosts();
     });
   }
 
   fetchPosts() {
-    this.http.get<Post[]>('http://localhost:8080/posts').subscribe({
+    this.http.get<PostPage>('http://localhost:8080/posts').subscribe({
       next: (data) => {
-        this.posts = data;
+        this.posts = data.posts;
+        this.next = data.next;
       },
       error: (err) => {
         console.error('Error fetching posts:', err);
@@ -40,7 +107,75 @@ export class FeedComponent implements OnInit {
     });
   }
 
+  loadMore() {
+    if (!this.next) return;
+    this.loading = true;
+
+    this.http
+      .get<PostPage>('http://localhost:8080/posts', {
+        params: { cursor: this.next },
+      })
+      .subscribe({
+        next: (data) => {
+          this.loading = false;
+          this.posts.push(...data.posts.filter((post) => !this.has(post)));
+          this.next = data.next;
+        },
+        error: (err) => {
+          this.loading = false;
+          console.error('Error fetching posts:', err);
+        },
+      });
+  }
+
+  // Fetches the posts created while the WebSocket was down, up to a page;
+  // if more were missed, the feed starts over
+  fetchMissedPosts() {
+    if (this.posts.length === 0) {
+      this.fetchPosts();
+      return;
+    }
+
+    this.http
+      .get<PostPage>('http://localhost:8080/posts', {
+        params: { since_id: this.posts[0].id },
+      })
+      .subscribe({
+        next: (data) => {
+          if (data.next && !data.posts.some((post) => this.has(post))) {
+            this.posts = data.posts;
+            this.next = data.next;
+            return;
+          }
+          this.posts.unshift(...data.posts.filter((post) => !this.has(post)));
+        },
+        error: (err) => {
+          console.error('Error fetching missed posts:', err);
+        },
+      });
+  }
+
   addPost(post: Post) {
-    this.posts.unshift(post);
+    if (!this.has(post)) {
+      this.posts.unshift(post);
+    }
+  }
+
+  // Applies a change to the post wherever the feed shows it, including
+  // inside reposts and quote posts
+  private updatePost(id: string, change: (post: Post) => Post) {
+    this.posts = this.posts.map((post) => {
+      if (post.id === id) {
+        return change(post);
+      }
+      if (post.original?.id === id) {
+        return { ...post, original: change(post.original) };
+      }
+      return post;
+    });
+  }
+
+  private has(post: Post): boolean {
+    return this.posts.some((p) => p.id === post.id);
   }
 }
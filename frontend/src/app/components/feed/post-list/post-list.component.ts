@@ -1,21 +1,74 @@
 // /frontend/src/app/components/feed/post-list/post-list.component.ts
 import { Component, Input } from '@angular/core';
+import { HttpClient } from '@angular/common/http';
 import { Post } from '../../../models/post.model';
 
+// Mirrors the reactions the backend accepts
+const REACTIONS = ['❤️', '👍', '👎', '😂', '😮', '😢', '🎉', '🙏'];
+
 @Component({
   selector: 'app-post-list',
   template: `
-    <div *ngFor="let post of posts" class="post-card">
-      <mat-card>
+    <div *ngFor="let item of posts" class="post-card">
+      <small *ngIf="item.repost_of" class="reposted-by">
+        🔁 {{ item.author?.display_name || item.author?.username || item.username }}
+        reposted
+      </small>
+      <mat-card *ngIf="shown(item) as post">
         <mat-card-header>
-          <mat-card-title>{{ post.username }}</mat-card-title>
+          <img
+            *ngIf="post.author?.avatar_url"
+            mat-card-avatar
+            [src]="post.author?.avatar_url"
+            alt=""
+          />
+          <mat-card-title>
+            {{ post.author?.display_name || post.author?.username || post.username }}
+          </mat-card-title>
           <mat-card-subtitle>
+            @{{ post.author?.username || post.username }} ·
             {{ post.created_at | date: 'short' }}
+            <span *ngIf="post.edited_at" [title]="post.edited_at | date: 'short'">
+              · edited
+            </span>
           </mat-card-subtitle>
         </mat-card-header>
         <mat-card-content>
-          <p>{{ post.content }}</p>
+          <p *ngIf="!post.deleted_at && !post.repost_of">{{ post.content }}</p>
+          <p *ngIf="post.deleted_at || post.repost_of" class="unavailable">
+            This post is no longer available.
+          </p>
+          <div *ngIf="post.quote_of" class="quote">
+            <ng-container *ngIf="post.original as quoted; else unavailable">
+              <strong>
+                {{ quoted.author?.display_name || quoted.author?.username || quoted.username }}
+              </strong>
+              <p *ngIf="!quoted.deleted_at">{{ quoted.content }}</p>
+              <p *ngIf="quoted.deleted_at" class="unavailable">
+                This post has been deleted.
+              </p>
+            </ng-container>
+            <ng-template #unavailable>
+              <p class="unavailable">This post is no longer available.</p>
+            </ng-template>
+          </div>
+          <small *ngIf="post.reply_count">
+            {{ post.reply_count }} {{ post.reply_count === 1 ? 'reply' : 'replies' }}
+          </small>
         </mat-card-content>
+        <mat-card-actions *ngIf="!post.deleted_at && !post.repost_of">
+          <button
+            *ngFor="let emoji of reactions"
+            mat-button
+            [color]="hasReacted(post, emoji) ? 'primary' : undefined"
+            (click)="toggleReaction(post, emoji)"
+          >
+            {{ emoji }} {{ count(post, emoji) || '' }}
+          </button>
+          <button mat-button (click)="repost(post)">
+            🔁 {{ post.repost_count || '' }}
+          </button>
+        </mat-card-actions>
       </mat-card>
     </div>
   `,
@@ -24,9 +77,66 @@ import { Post } from '../../../models/post.model';
       .post-card {
         margin-bottom: 15px;
       }
+      .quote {
+        border-left: 3px solid #ccc;
+        padding-left: 10px;
+      }
+      .unavailable {
+        font-style: italic;
+        color: #777;
+      }
     `,
   ],
 })
 export class PostListComponent {
   @Input() posts: Post[] = [];
+  reactions = REACTIONS;
+
+  constructor(private http: HttpClient) {}
+
+  // A repost shows the post it shares; one whose original is gone shows
+  // itself as unavailable
+  shown(item: Post): Post {
+    return item.repost_of && item.original ? item.original : item;
+  }
+
+  // Reposting is idempotent, so repeated clicks keep a single repost
+  repost(post: Post) {
+    this.http
+      .put<Post>(`http://localhost:8080/posts/${post.id}/repost`, {})
+      .subscribe({
+        error: (err) => {
+          console.error('Error reposting:', err);
+        },
+      });
+  }
+
+  count(post: Post, emoji: string): number {
+    return post.reactions ? post.reactions[emoji] || 0 : 0;
+  }
+
+  hasReacted(post: Post, emoji: string): boolean {
+    return post.reacted_by_me?.includes(emoji) ?? false;
+  }
+
+  // Reacting is idempotent, so the counts are updated right away and
+  // corrected by the next reaction event
+  toggleReaction(post: Post, emoji: string) {
+    const reacted = this.hasReacted(post, emoji);
+    const url = `http://localhost:8080/posts/${post.id}/reactions/${encodeURIComponent(emoji)}`;
+    const request = reacted ? this.http.delete(url) : this.http.put(url, {});
+
+    const counts = { ...post.reactions };
+    counts[emoji] = Math.max((counts[emoji] || 0) + (reacted ? -1 : 1), 0);
+    post.reactions = counts;
+    post.reacted_by_me = reacted
+      ? (post.reacted_by_me || []).filter((e) => e !== emoji)
+      : [...(post.reacted_by_me || []), emoji];
+
+    request.subscribe({
+      error: (err) => {
+        console.error('Error updating reaction:', err);
+      },
+    });
+  }
 }
@@ -1,6 +1,11 @@
 // /frontend/src/app/guards/auth.guard.ts
 import { Injectable } from '@angular/core';
-import { CanActivate, Router } from '@angular/router';
+import {
+  ActivatedRouteSnapshot,
+  CanActivate,
+  Router,
+  RouterStateSnapshot,
+} from '@angular/router';
 import { Observable, tap } from 'rxjs';
 import { AuthService } from '../services/auth.service';
 
@@ -10,11 +15,17 @@ import { AuthService } from '../services/auth.service';
 export class AuthGuard implements CanActivate {
   constructor(private auth: AuthService, private router: Router) {}
 
-  canActivate(): Observable<boolean> {
+  canActivate(
+    route: ActivatedRouteSnapshot,
+    state: RouterStateSnapshot
+  ): Observable<boolean> {
     return this.auth.authState.pipe(
       tap((loggedIn) => {
         if (!loggedIn) {
-          this.router.navigate(['/login']);
+          // Come back to the requested page, e.g. an OAuth consent screen
+          this.router.navigate(['/login'], {
+            queryParams: state.url === '/' ? {} : { returnUrl: state.url },
+          });
         }
       })
     );
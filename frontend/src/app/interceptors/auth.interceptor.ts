@@ -1,12 +1,13 @@
 // /frontend/src/app/interceptors/auth.interceptor.ts
 import { Injectable } from '@angular/core';
 import {
+  HttpErrorResponse,
   HttpEvent,
   HttpHandler,
   HttpInterceptor,
   HttpRequest,
 } from '@angular/common/http';
-import { Observable } from 'rxjs';
+import { catchError, Observable, switchMap, throwError } from 'rxjs';
 import { AuthService } from '../services/auth.service';
 
 @Injectable()
@@ -20,12 +21,34 @@ export class AuthInterceptor implements HttpInterceptor {
     const token = this.auth.getToken();
 
     if (token) {
-      const cloned = req.clone({
-        headers: req.headers.set('Authorization', token),
-      });
-      return next.handle(cloned);
+      return next.handle(this.withToken(req, token)).pipe(
+        catchError((err) => {
+          // Access tokens are short-lived; refresh once and retry the request
+          if (
+            err instanceof HttpErrorResponse &&
+            err.status === 401 &&
+            this.auth.getRefreshToken() &&
+            !req.url.endsWith('/token/refresh')
+          ) {
+            return this.auth.refresh().pipe(
+              switchMap((res: any) => next.handle(this.withToken(req, res.token))),
+              catchError((refreshErr) => {
+                this.auth.clearTokens();
+                return throwError(() => refreshErr);
+              })
+            );
+          }
+          return throwError(() => err);
+        })
+      );
     }
 
     return next.handle(req);
   }
+
+  private withToken(req: HttpRequest<any>, token: string): HttpRequest<any> {
+    return req.clone({
+      headers: req.headers.set('Authorization', token),
+    });
+  }
 }
@@ -1,8 +1,61 @@
 // frontend/src/app/models/post.model.ts
+export interface Author {
+  id: string;
+  username: string;
+  display_name?: string;
+  avatar_url?: string;
+}
+
 export interface Post {
   id: string;
   user_id: string;
   username: string;
   content: string;
   created_at: string;
+  edited_at?: string;
+  deleted_at?: string;
+  in_reply_to?: string;
+  conversation_id?: string;
+  reply_count: number;
+  repost_of?: string;
+  quote_of?: string;
+  repost_count: number;
+  quote_count: number;
+  original?: Post;
+  reactions?: Record<string, number>;
+  reacted_by_me?: string[];
+  author?: Author;
+}
+
+export interface Notification {
+  id: string;
+  type: 'reply' | 'repost' | 'quote';
+  post_id: string;
+  created_at: string;
+  read_at?: string;
+  actor?: Author;
+  post?: Post;
+}
+
+export interface ReactionCounts {
+  post_id: string;
+  counts: Record<string, number>;
+}
+
+export interface PostEvent {
+  type:
+    | 'post.created'
+    | 'post.updated'
+    | 'post.deleted'
+    | 'post.reactions'
+    | 'notification';
+  post?: Post;
+  reactions?: ReactionCounts;
+  notification?: Notification;
+}
+
+export interface PostPage {
+  posts: Post[];
+  next?: string;
+  prev?: string;
 }
@@ -2,5 +2,10 @@
 export interface User {
   id: string;
   username: string;
+  display_name?: string;
+  bio?: string;
+  avatar_url?: string;
+  website?: string;
+  location?: string;
   created_at: string;
 }
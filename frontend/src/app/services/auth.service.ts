@@ -8,6 +8,7 @@ import { BehaviorSubject, Observable, tap } from 'rxjs';
 })
 export class AuthService {
   private tokenKey = 'token';
+  private refreshTokenKey = 'refresh_token';
   private authSubject = new BehaviorSubject<boolean>(this.hasToken());
 
   authState = this.authSubject.asObservable();
@@ -18,12 +19,7 @@ export class AuthService {
     return this.http
       .post('http://localhost:8080/register', { username, password })
       .pipe(
-        tap((res: any) => {
-          if (res.token) {
-            localStorage.setItem(this.tokenKey, res.token);
-            this.authSubject.next(true);
-          }
-        })
+        tap((res: any) => this.storeTokens(res))
       );
   }
 
@@ -31,17 +27,82 @@ export class AuthService {
     return this.http
       .post('http://localhost:8080/login', { username, password })
       .pipe(
-        tap((res: any) => {
-          if (res.token) {
-            localStorage.setItem(this.tokenKey, res.token);
-            this.authSubject.next(true);
-          }
-        })
+        tap((res: any) => this.storeTokens(res))
       );
   }
 
+  loginTwoFactor(challengeToken: string, code: string): Observable<any> {
+    return this.http
+      .post('http://localhost:8080/login/2fa', {
+        challenge_token: challengeToken,
+        code,
+      })
+      .pipe(tap((res: any) => this.storeTokens(res)));
+  }
+
+  oidcProviders(): Observable<any> {
+    return this.http.get('http://localhost:8080/auth/oidc');
+  }
+
+  startOidc(provider: string): Observable<any> {
+    // The callback needs to know which provider to complete the sign-in with
+    sessionStorage.setItem('oidc_provider', provider);
+    return this.http
+      .post(`http://localhost:8080/auth/oidc/${provider}/start`, {})
+      .pipe(
+        // Only this browser can complete the sign-in it started
+        tap((res: any) => sessionStorage.setItem('oidc_binding', res.binding))
+      );
+  }
+
+  completeOidc(code: string, state: string): Observable<any> {
+    const provider = sessionStorage.getItem('oidc_provider');
+    const binding = sessionStorage.getItem('oidc_binding');
+    sessionStorage.removeItem('oidc_provider');
+    sessionStorage.removeItem('oidc_binding');
+    return this.http
+      .post(`http://localhost:8080/auth/oidc/${provider}/callback`, {
+        code,
+        state,
+        binding,
+      })
+      .pipe(tap((res: any) => this.storeTokens(res)));
+  }
+
+  oauthAuthorization(params: any): Observable<any> {
+    return this.http.get('http://localhost:8080/oauth/authorize', { params });
+  }
+
+  authorizeOauth(params: any, approve: boolean): Observable<any> {
+    return this.http.post('http://localhost:8080/oauth/authorize', {
+      ...params,
+      approve,
+    });
+  }
+
+  refresh(): Observable<any> {
+    return this.http
+      .post('http://localhost:8080/token/refresh', {
+        refresh_token: this.getRefreshToken(),
+      })
+      .pipe(tap((res: any) => this.storeTokens(res)));
+  }
+
   logout() {
+    // Revoke the tokens server-side; local state is cleared regardless of the outcome
+    if (this.getToken()) {
+      this.http
+        .post('http://localhost:8080/logout', {
+          refresh_token: this.getRefreshToken(),
+        })
+        .subscribe({ error: () => {} });
+    }
+    this.clearTokens();
+  }
+
+  clearTokens() {
     localStorage.removeItem(this.tokenKey);
+    localStorage.removeItem(this.refreshTokenKey);
     this.authSubject.next(false);
   }
 
@@ -49,6 +110,20 @@ export class AuthService {
     return localStorage.getItem(this.tokenKey);
   }
 
+  getRefreshToken(): string | null {
+    return localStorage.getItem(this.refreshTokenKey);
+  }
+
+  private storeTokens(res: any) {
+    if (res.token) {
+      localStorage.setItem(this.tokenKey, res.token);
+      if (res.refresh_token) {
+        localStorage.setItem(this.refreshTokenKey, res.refresh_token);
+      }
+      this.authSubject.next(true);
+    }
+  }
+
   private hasToken(): boolean {
     return !!localStorage.getItem(this.tokenKey);
   }
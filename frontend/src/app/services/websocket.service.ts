@@ -1,51 +1,110 @@
 // /frontend/src/app/services/websocket.service.ts
 import { Injectable } from '@angular/core';
+import { HttpClient } from '@angular/common/http';
 import { Observable, Subject, webSocket, WebSocketSubject } from 'rxjs';
-import { Post } from '../models/post.model';
+import { PostEvent } from '../models/post.model';
+import { AuthService } from './auth.service';
 
 @Injectable({
   providedIn: 'root',
 })
 export class WebSocketService {
-  private socket$: WebSocketSubject<any>;
-  private postSubject = new Subject<Post>();
+  private socket$?: WebSocketSubject<any>;
+  private eventSubject = new Subject<PostEvent>();
+  private reconnectedSubject = new Subject<void>();
+  private wasConnected = false;
+  private loggedIn = false;
+  private connecting = false;
 
-  constructor() {
-    this.connect();
+  constructor(private http: HttpClient, private auth: AuthService) {
+    this.auth.authState.subscribe((loggedIn) => {
+      this.loggedIn = loggedIn;
+      if (loggedIn) {
+        this.connect();
+      } else {
+        this.close();
+      }
+    });
   }
 
   private connect() {
-    this.socket$ = webSocket('ws://localhost:8080/ws');
+    if (this.socket$ || this.connecting) return;
+    this.connecting = true;
+
+    // Browsers cannot send the Authorization header with the upgrade request,
+    // so every connection uses a fresh single-use ticket instead
+    this.http.post<any>('http://localhost:8080/ws/ticket', {}).subscribe({
+      next: (res) => {
+        this.connecting = false;
+        if (this.loggedIn) {
+          this.open(res.ticket);
+        }
+      },
+      error: (err) => {
+        this.connecting = false;
+        console.error('WebSocket ticket error:', err);
+        this.reconnect();
+      },
+    });
+  }
+
+  private open(ticket: string) {
+    this.socket$ = webSocket({
+      url: 'ws://localhost:8080/ws',
+      protocol: ['ticket', ticket],
+      openObserver: {
+        next: () => {
+          // Posts sent while disconnected were missed
+          if (this.wasConnected) {
+            this.reconnectedSubject.next();
+          }
+          this.wasConnected = true;
+        },
+      },
+    });
 
     this.socket$.subscribe(
       (msg) => {
-        const post: Post = msg;
-        this.postSubject.next(post);
+        const event: PostEvent = msg;
+        this.eventSubject.next(event);
       },
       (err) => {
         console.error('WebSocket error:', err);
-        setTimeout(() => {
-          this.connect();
-        }, 3000); // Reconnect after 3 seconds
+        this.reconnect();
       },
       () => {
         console.warn('WebSocket connection closed');
-        setTimeout(() => {
-          this.connect();
-        }, 3000); // Reconnect after 3 seconds
+        this.reconnect();
       }
     );
   }
 
-  getNewPosts(): Observable<Post> {
-    return this.postSubject.asObservable();
+  private reconnect() {
+    this.socket$ = undefined;
+    setTimeout(() => {
+      if (this.loggedIn) {
+        this.connect();
+      }
+    }, 3000); // Reconnect after 3 seconds
+  }
+
+  getPostEvents(): Observable<PostEvent> {
+    return this.eventSubject.asObservable();
+  }
+
+  // Emits whenever the connection is restored after being lost
+  getReconnects(): Observable<void> {
+    return this.reconnectedSubject.asObservable();
   }
 
   sendMessage(msg: any) {
-    this.socket$.next(msg);
+    this.socket$?.next(msg);
   }
 
   close() {
-    this.socket$.complete();
+    this.wasConnected = false;
+    const socket$ = this.socket$;
+    this.socket$ = undefined;
+    socket$?.complete();
   }
 }
@@ -16,6 +16,7 @@ import (
 
     "github.com/gin-gonic/gin"
     "go.mongodb.org/mongo-driver/mongo"
+    "go.mongodb.org/mongo-driver/mongo/gridfs"
     "go.mongodb.org/mongo-driver/mongo/options"
 )
 
@@ -37,11 +38,151 @@ func main() {
 
     userCollection := mongoClient.Database("social-experiment").Collection("users")
     postCollection := mongoClient.Database("social-experiment").Collection("posts")
+    postRevisionCollection := mongoClient.Database("social-experiment").Collection("post_revisions")
+    notificationCollection := mongoClient.Database("social-experiment").Collection("notifications")
+    reactionCollection := mongoClient.Database("social-experiment").Collection("reactions")
+    refreshTokenCollection := mongoClient.Database("social-experiment").Collection("refresh_tokens")
+    revokedTokenCollection := mongoClient.Database("social-experiment").Collection("revoked_tokens")
+    actionTokenCollection := mongoClient.Database("social-experiment").Collection("action_tokens")
+    inviteCollection := mongoClient.Database("social-experiment").Collection("invites")
+    loginAttemptCollection := mongoClient.Database("social-experiment").Collection("login_attempts")
+    sessionCollection := mongoClient.Database("social-experiment").Collection("sessions")
+    personalTokenCollection := mongoClient.Database("social-experiment").Collection("personal_access_tokens")
+    oidcStateCollection := mongoClient.Database("social-experiment").Collection("oidc_states")
+    wsTicketCollection := mongoClient.Database("social-experiment").Collection("ws_tickets")
+    auditCollection := mongoClient.Database("social-experiment").Collection("audit_log")
+    oauthClientCollection := mongoClient.Database("social-experiment").Collection("oauth_clients")
+    oauthGrantCollection := mongoClient.Database("social-experiment").Collection("oauth_grants")
+    oauthCodeCollection := mongoClient.Database("social-experiment").Collection("oauth_codes")
+    oauthRefreshTokenCollection := mongoClient.Database("social-experiment").Collection("oauth_refresh_tokens")
+    dataExportCollection := mongoClient.Database("social-experiment").Collection("data_exports")
 
-    // Initialize WebSocket Hub with JWT Secret
-    hub := websocket.NewHub(config.JWTSecret)
+    controllers.BackfillUsernameKeys(userCollection)
+    if err := controllers.EnsureUserIndexes(userCollection); err != nil {
+        log.Printf("[ERROR] Failed to create user indexes: %v", err)
+    }
+    if err := controllers.EnsureInviteIndexes(inviteCollection); err != nil {
+        log.Printf("[ERROR] Failed to create invite indexes: %v", err)
+    }
+    if err := controllers.EnsurePostIndexes(postCollection, postRevisionCollection); err != nil {
+        log.Printf("[ERROR] Failed to create post indexes: %v", err)
+    }
+    if err := controllers.EnsureNotificationIndexes(notificationCollection); err != nil {
+        log.Printf("[ERROR] Failed to create notification indexes: %v", err)
+    }
+    if err := controllers.EnsureReactionIndexes(reactionCollection); err != nil {
+        log.Printf("[ERROR] Failed to create reaction indexes: %v", err)
+    }
+
+    // Grant the admin role to the users listed in ADMIN_USERS
+    controllers.BootstrapAdmins(userCollection, config.AdminUsers)
+
+    // Load JWT signing and verification keys
+    keyRing, err := utils.LoadKeyRing(config)
+    if err != nil {
+        log.Fatalf("[ERROR] Failed to load JWT keys: %v", err)
+    }
+
+    // Initialize token issuance with device sessions and rotating refresh tokens
+    sessions := utils.NewSessionStore(sessionCollection, config.RefreshTokenTTL)
+    if err := sessions.EnsureIndexes(context.Background()); err != nil {
+        log.Printf("[ERROR] Failed to create session indexes: %v", err)
+    }
+    refreshTokens := utils.NewRefreshTokenStore(refreshTokenCollection, config.RefreshTokenTTL)
+    if err := refreshTokens.EnsureIndexes(context.Background()); err != nil {
+        log.Printf("[ERROR] Failed to create refresh token indexes: %v", err)
+    }
+    tokenIssuer := utils.NewTokenIssuer(keyRing, config.AccessTokenTTL, refreshTokens, sessions, userCollection)
+
+    // Initialize token validation backed by the revocation list, personal access tokens and WebSocket tickets
+    revocations := utils.NewRevocationList(revokedTokenCollection, config.AccessTokenTTL)
+    if err := revocations.EnsureIndexes(context.Background()); err != nil {
+        log.Printf("[ERROR] Failed to create revocation indexes: %v", err)
+    }
+    personalTokens := utils.NewPersonalAccessTokenStore(personalTokenCollection)
+    if err := personalTokens.EnsureIndexes(context.Background()); err != nil {
+        log.Printf("[ERROR] Failed to create personal access token indexes: %v", err)
+    }
+    wsTickets := utils.NewWebSocketTicketStore(wsTicketCollection)
+    if err := wsTickets.EnsureIndexes(context.Background()); err != nil {
+        log.Printf("[ERROR] Failed to create WebSocket ticket indexes: %v", err)
+    }
+    authenticator := utils.NewAuthenticator(keyRing, revocations, sessions, personalTokens, wsTickets)
+
+    // Initialize the OAuth authorization server for third-party clients
+    oauthRefreshTokens := utils.NewRefreshTokenStore(oauthRefreshTokenCollection, config.RefreshTokenTTL)
+    if err := oauthRefreshTokens.EnsureIndexes(context.Background()); err != nil {
+        log.Printf("[ERROR] Failed to create OAuth refresh token indexes: %v", err)
+    }
+    oauthServer := utils.NewOAuthServer(keyRing, config.AccessTokenTTL, oauthClientCollection, oauthGrantCollection, oauthCodeCollection, oauthRefreshTokens, revocations)
+    if err := oauthServer.EnsureIndexes(context.Background()); err != nil {
+        log.Printf("[ERROR] Failed to create OAuth indexes: %v", err)
+    }
+
+    // Initialize brute-force protection for logins
+    loginThrottle := utils.NewLoginThrottle(loginAttemptCollection, config)
+    if err := loginThrottle.EnsureIndexes(context.Background()); err != nil {
+        log.Printf("[ERROR] Failed to create login attempt indexes: %v", err)
+    }
+
+    // Initialize email delivery for verification and password reset links
+    actionTokens := utils.NewActionTokenStore(actionTokenCollection)
+    if err := actionTokens.EnsureIndexes(context.Background()); err != nil {
+        log.Printf("[ERROR] Failed to create action token indexes: %v", err)
+    }
+    accountMailer := utils.NewAccountMailer(utils.NewMailer(config), actionTokens, config)
+
+    // Initialize the reserved username list
+    usernamePolicy := utils.NewUsernamePolicy(config)
+
+    // Initialize password hashing, the password policy and breached password list
+    passwordPolicy, err := utils.NewPasswordPolicy(config)
+    if err != nil {
+        log.Fatalf("[ERROR] Failed to load password policy: %v", err)
+    }
+
+    passwordHasher, err := utils.NewPasswordHasher(config)
+    if err != nil {
+        log.Fatalf("[ERROR] Failed to configure password hashing: %v", err)
+    }
+
+    // Initialize sign-in through external identity providers
+    oidcProviders := utils.NewOIDCProviders(config)
+    oidcStates := utils.NewOIDCStateStore(oidcStateCollection)
+    if err := oidcStates.EnsureIndexes(context.Background()); err != nil {
+        log.Printf("[ERROR] Failed to create OIDC state indexes: %v", err)
+    }
+
+    // Initialize WebSocket Hub with the authenticator and allowed browser origins
+    hub := websocket.NewHub(authenticator, config.CORSOrigins)
     go hub.Run()
 
+    auditLog := utils.NewAuditLog(auditCollection)
+    if err := auditLog.EnsureIndexes(context.Background()); err != nil {
+        log.Printf("[ERROR] Failed to create audit log indexes: %v", err)
+    }
+
+    // Build personal data exports in the background, storing archives in GridFS
+    exportFiles, err := gridfs.NewBucket(mongoClient.Database("social-experiment"), options.GridFSBucket().SetName("data_exports"))
+    if err != nil {
+        log.Fatalf("[ERROR] Failed to initialize data export storage: %v", err)
+    }
+    dataExporter := utils.NewDataExporter(config, keyRing, revocations, dataExportCollection, exportFiles, userCollection, postCollection, postRevisionCollection, reactionCollection, notificationCollection, sessions, personalTokens, oauthServer, auditLog)
+    if err := dataExporter.EnsureIndexes(context.Background()); err != nil {
+        log.Printf("[ERROR] Failed to create data export indexes: %v", err)
+    }
+    go dataExporter.Run(context.Background(), time.Minute)
+
+    // Erase accounts whose deletion grace period has passed
+    accountEraser, err := utils.NewAccountEraser(config, userCollection, postCollection, postRevisionCollection, reactionCollection, notificationCollection, revocations, tokenIssuer, personalTokens, oauthServer, dataExporter, auditLog, hub)
+    if err != nil {
+        log.Fatalf("[ERROR] Failed to configure account deletion: %v", err)
+    }
+    if err := accountEraser.EnsureIndexes(context.Background()); err != nil {
+        log.Printf("[ERROR] Failed to create account deletion indexes: %v", err)
+    }
+    go accountEraser.Run(context.Background(), time.Minute)
+
     // Initialize Gin Router
     router := gin.Default()
 
@@ -53,10 +194,11 @@ func main() {
     // Apply CORS Middleware
     router.Use(func(c *gin.Context) {
         origin := c.GetHeader("Origin")
-        if isAllowedOrigin(origin, config.CORSOrigins) {
+        if utils.IsAllowedOrigin(origin, config.CORSOrigins) {
             c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
-            c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, DELETE")
+            c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS, PUT, PATCH, DELETE")
             c.Writer.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
+            c.Writer.Header().Set("Access-Control-Expose-Headers", "Link")
         }
         if c.Request.Method == "OPTIONS" {
             c.AbortWithStatus(204)
@@ -70,14 +212,77 @@ func main() {
     router.Use(middleware.RateLimitMiddleware(rl))
 
     // Define Routes
-    router.POST("/register", controllers.Register(userCollection, config.JWTSecret))
-    router.POST("/login", controllers.Login(userCollection, config.JWTSecret))
-    router.POST("/posts", middleware.AuthMiddleware(config.JWTSecret), controllers.CreatePost(postCollection, hub))
-    router.GET("/posts", middleware.AuthMiddleware(config.JWTSecret), controllers.GetPosts(postCollection))
+    router.POST("/register", controllers.Register(userCollection, inviteCollection, usernamePolicy, passwordPolicy, passwordHasher, tokenIssuer, accountMailer, config.RegistrationMode))
+    router.POST("/login", controllers.Login(userCollection, passwordHasher, tokenIssuer, loginThrottle))
+    router.POST("/login/2fa", controllers.LoginTwoFactor(userCollection, tokenIssuer, revocations, loginThrottle))
+    router.POST("/2fa/setup", middleware.AuthMiddleware(authenticator), controllers.SetupTwoFactor(userCollection, config.TOTPIssuer))
+    router.POST("/2fa/confirm", middleware.AuthMiddleware(authenticator), controllers.ConfirmTwoFactor(userCollection))
+    router.POST("/2fa/disable", middleware.AuthMiddleware(authenticator), controllers.DisableTwoFactor(userCollection))
+    router.GET("/auth/oidc", controllers.ListOIDCProviders(oidcProviders))
+    router.POST("/auth/oidc/:provider/start", controllers.StartOIDCLogin(oidcProviders, oidcStates))
+    router.POST("/auth/oidc/:provider/callback", controllers.OIDCCallback(userCollection, inviteCollection, usernamePolicy, oidcProviders, oidcStates, tokenIssuer, auditLog, config.RegistrationMode))
+    router.POST("/me/identities/:provider", middleware.AuthMiddleware(authenticator), controllers.StartOIDCLink(oidcProviders, oidcStates))
+    router.POST("/me/identities/:provider/callback", middleware.AuthMiddleware(authenticator), controllers.OIDCCallback(userCollection, inviteCollection, usernamePolicy, oidcProviders, oidcStates, tokenIssuer, auditLog, config.RegistrationMode))
+    router.DELETE("/me/identities/:provider", middleware.AuthMiddleware(authenticator), controllers.UnlinkIdentity(userCollection))
+    router.POST("/token/refresh", controllers.RefreshToken(tokenIssuer))
+    router.GET("/.well-known/jwks.json", controllers.JWKS(keyRing))
+    router.POST("/logout", middleware.AuthMiddleware(authenticator), controllers.Logout(revocations, tokenIssuer, hub))
+    router.POST("/logout/all", middleware.AuthMiddleware(authenticator), controllers.LogoutAll(revocations, tokenIssuer, personalTokens, hub))
+    router.GET("/sessions", middleware.AuthMiddleware(authenticator), controllers.ListSessions(sessions))
+    router.DELETE("/sessions/:id", middleware.AuthMiddleware(authenticator), controllers.RevokeSession(revocations, tokenIssuer, hub))
+    router.POST("/me/tokens", middleware.AuthMiddleware(authenticator), controllers.CreatePersonalAccessToken(personalTokens))
+    router.GET("/me/tokens", middleware.AuthMiddleware(authenticator), controllers.ListPersonalAccessTokens(personalTokens))
+    router.DELETE("/me/tokens/:id", middleware.AuthMiddleware(authenticator), controllers.RevokePersonalAccessToken(personalTokens, hub))
+    router.POST("/oauth/clients", middleware.AuthMiddleware(authenticator), controllers.RegisterOAuthClient(oauthServer))
+    router.GET("/oauth/clients", middleware.AuthMiddleware(authenticator), controllers.ListOAuthClients(oauthServer))
+    router.DELETE("/oauth/clients/:id", middleware.AuthMiddleware(authenticator), controllers.DeleteOAuthClient(oauthServer, hub))
+    router.GET("/oauth/authorize", middleware.AuthMiddleware(authenticator), controllers.GetOAuthAuthorization(oauthServer))
+    router.POST("/oauth/authorize", middleware.AuthMiddleware(authenticator), controllers.AuthorizeOAuthClient(oauthServer))
+    router.POST("/oauth/token", controllers.OAuthToken(oauthServer))
+    router.POST("/oauth/introspect", controllers.IntrospectOAuthToken(oauthServer))
+    router.POST("/oauth/revoke", controllers.RevokeOAuthToken(oauthServer, hub))
+    router.GET("/me/authorizations", middleware.AuthMiddleware(authenticator), controllers.ListOAuthGrants(oauthServer))
+    router.DELETE("/me/authorizations/:client_id", middleware.AuthMiddleware(authenticator), controllers.RevokeOAuthGrant(oauthServer, hub))
+    router.POST("/password/forgot", controllers.ForgotPassword(userCollection, accountMailer))
+    router.POST("/password/reset", controllers.ResetPassword(userCollection, passwordPolicy, passwordHasher, actionTokens, revocations, tokenIssuer, personalTokens, hub))
+    router.POST("/password/change", middleware.AuthMiddleware(authenticator), controllers.ChangePassword(userCollection, passwordPolicy, passwordHasher, loginThrottle, tokenIssuer, revocations, personalTokens, hub))
+    router.DELETE("/me", middleware.AuthMiddleware(authenticator), controllers.DeleteAccount(userCollection, passwordHasher, loginThrottle, revocations, tokenIssuer, personalTokens, oauthServer, hub, config.AccountDeletionGracePeriod))
+    router.POST("/me/export", middleware.AuthMiddleware(authenticator), controllers.RequestDataExport(dataExporter))
+    router.GET("/me/export", middleware.AuthMiddleware(authenticator), controllers.ListDataExports(dataExporter))
+    router.GET("/me/export/:id", middleware.AuthMiddleware(authenticator), controllers.GetDataExport(dataExporter))
+    router.GET("/me/export/:id/download", controllers.DownloadDataExport(dataExporter))
+    router.PATCH("/me", middleware.AuthMiddleware(authenticator, utils.ScopeProfileWrite), controllers.UpdateProfile(userCollection))
+    router.PATCH("/me/username", middleware.AuthMiddleware(authenticator), controllers.ChangeUsername(userCollection, postCollection, usernamePolicy, config.UsernameChangeCooldown, config.UsernameReservationPeriod))
+    router.GET("/users/:username", middleware.AuthMiddleware(authenticator, utils.ScopeProfileRead), controllers.GetUserProfile(userCollection))
+    router.PUT("/me/email", middleware.AuthMiddleware(authenticator), controllers.UpdateEmail(userCollection, accountMailer))
+    router.POST("/email/verify", controllers.VerifyEmail(userCollection, actionTokens))
+    router.POST("/posts", middleware.AuthMiddleware(authenticator, utils.ScopePostsWrite), controllers.CreatePost(postCollection, userCollection, notificationCollection, hub, config.RegistrationMode == utils.RegistrationVerifyEmail))
+    router.GET("/posts", middleware.AuthMiddleware(authenticator, utils.ScopePostsRead), controllers.GetPosts(postCollection, userCollection, reactionCollection))
+    router.GET("/posts/:id", middleware.AuthMiddleware(authenticator, utils.ScopePostsRead), controllers.GetPost(postCollection, userCollection, reactionCollection))
+    router.PATCH("/posts/:id", middleware.AuthMiddleware(authenticator, utils.ScopePostsWrite), controllers.UpdatePost(postCollection, postRevisionCollection, userCollection, hub))
+    router.DELETE("/posts/:id", middleware.AuthMiddleware(authenticator, utils.ScopePostsWrite), controllers.DeletePost(postCollection, postRevisionCollection, reactionCollection, notificationCollection, hub))
+    router.GET("/posts/:id/history", middleware.AuthMiddleware(authenticator, utils.ScopePostsRead), controllers.GetPostHistory(postCollection, postRevisionCollection))
+    router.GET("/posts/:id/thread", middleware.AuthMiddleware(authenticator, utils.ScopePostsRead), controllers.GetPostThread(postCollection, userCollection, reactionCollection))
+    router.PUT("/posts/:id/repost", middleware.AuthMiddleware(authenticator, utils.ScopePostsWrite), controllers.RepostPost(postCollection, userCollection, notificationCollection, hub, config.RegistrationMode == utils.RegistrationVerifyEmail))
+    router.DELETE("/posts/:id/repost", middleware.AuthMiddleware(authenticator, utils.ScopePostsWrite), controllers.UndoRepost(postCollection, notificationCollection, hub))
+    router.PUT("/posts/:id/reactions/:emoji", middleware.AuthMiddleware(authenticator, utils.ScopePostsWrite), controllers.AddReaction(postCollection, reactionCollection, hub))
+    router.DELETE("/posts/:id/reactions/:emoji", middleware.AuthMiddleware(authenticator, utils.ScopePostsWrite), controllers.RemoveReaction(postCollection, reactionCollection, hub))
+    router.GET("/posts/:id/reactions", middleware.AuthMiddleware(authenticator, utils.ScopePostsRead), controllers.ListReactions(postCollection, reactionCollection, userCollection))
+    router.GET("/me/notifications", middleware.AuthMiddleware(authenticator), controllers.ListNotifications(notificationCollection, userCollection, postCollection))
+    router.POST("/me/notifications/read", middleware.AuthMiddleware(authenticator), controllers.MarkNotificationsRead(notificationCollection))
+    router.POST("/ws/ticket", middleware.AuthMiddleware(authenticator, utils.ScopeWSSubscribe), controllers.IssueWebSocketTicket(wsTickets))
     router.GET("/ws", func(c *gin.Context) {
         hub.HandleWebSocket(c)
     })
 
+    // Admin Routes
+    admin := router.Group("/admin", middleware.AuthMiddleware(authenticator))
+    admin.POST("/invites", middleware.RequirePermission(utils.PermissionManageInvites), controllers.CreateInvite(inviteCollection))
+    admin.GET("/invites", middleware.RequirePermission(utils.PermissionManageInvites), controllers.ListInvites(inviteCollection))
+    admin.DELETE("/invites/:id", middleware.RequirePermission(utils.PermissionManageInvites), controllers.RevokeInvite(inviteCollection))
+    admin.DELETE("/lockouts/:username", middleware.RequirePermission(utils.PermissionManageLockouts), controllers.UnlockUser(loginThrottle))
+    admin.PUT("/users/:username/roles", middleware.RequirePermission(utils.PermissionManageRoles), controllers.SetUserRoles(userCollection, revocations))
+
     // Create the HTTP server
     srv := &http.Server{
         Addr:    ":" + config.ServerPort,
@@ -111,16 +316,3 @@ func main() {
 
     log.Println("[INFO] Server exiting")
 }
-
-// isAllowedOrigin checks if the origin is allowed based on the CORS configuration
-func isAllowedOrigin(origin string, allowedOrigins []string) bool {
-    if len(allowedOrigins) == 0 {
-        return false
-    }
-    for _, ao := range allowedOrigins {
-        if ao == "*" || ao == origin {
-            return true
-        }
-    }
-    return false
-}
@@ -2,6 +2,7 @@
 package middleware
 
 import (
+	"log"
 	"net/http"
 
 	"social-experiment/utils"
@@ -9,7 +10,10 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
+// AuthMiddleware authenticates the request. Scoped tokens such as personal
+// access tokens are only accepted on routes that list the scopes they require;
+// every other route is reserved for interactive sessions.
+func AuthMiddleware(auth *utils.Authenticator, scopes ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		token := c.GetHeader("Authorization")
 		if token == "" {
@@ -18,16 +22,36 @@ func AuthMiddleware(jwtSecret string) gin.HandlerFunc {
 			return
 		}
 
-		// Validate token
-		userID, err := utils.ValidateJWT(token, jwtSecret)
+		// Validate token and check it against the revocation list
+		claims, err := auth.Authenticate(c.Request.Context(), token)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
 			return
 		}
 
-		// Set userID in context
-		c.Set("userID", userID)
+		if claims.IsScoped() {
+			if len(scopes) == 0 {
+				c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint is not available to scoped tokens"})
+				c.Abort()
+				return
+			}
+			for _, scope := range scopes {
+				if !claims.HasScope(scope) {
+					c.JSON(http.StatusForbidden, gin.H{"error": "Token is missing required scope", "scope": scope})
+					c.Abort()
+					return
+				}
+			}
+		}
+
+		if err := auth.TouchSession(c.Request.Context(), claims, c.ClientIP()); err != nil {
+			log.Printf("[ERROR] Error updating session last seen: %v", err)
+		}
+
+		// Set userID and claims in context
+		c.Set("userID", claims.UserID)
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
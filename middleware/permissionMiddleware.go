@@ -0,0 +1,34 @@
+// middleware/permissionMiddleware.go
+package middleware
+
+import (
+	"net/http"
+
+	"social-experiment/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequirePermission allows the request only if the roles in the authenticated
+// token grant every listed permission. It must run after AuthMiddleware.
+func RequirePermission(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, exists := c.Get("claims")
+		claims, ok := value.(*utils.Claims)
+		if !exists || !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+			c.Abort()
+			return
+		}
+
+		for _, permission := range permissions {
+			if !claims.HasPermission(permission) {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied", "permission": permission})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Next()
+	}
+}
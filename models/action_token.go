@@ -0,0 +1,21 @@
+// models/action_token.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ActionToken is a hashed, single-use, time-limited token emailed to a user to
+// confirm an action such as resetting a password or verifying an address.
+type ActionToken struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    TokenHash string             `bson:"token_hash" json:"-"`
+    Purpose   string             `bson:"purpose" json:"purpose"`
+    UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+    Email     string             `bson:"email,omitempty" json:"email,omitempty"`
+    CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+    ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+    UsedAt    *time.Time         `bson:"used_at,omitempty" json:"used_at,omitempty"`
+}
@@ -0,0 +1,19 @@
+// models/audit.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson"
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// AuditEvent records that a security-relevant action took place. Events must
+// not hold personal data beyond the opaque ID of the user concerned.
+type AuditEvent struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Event     string             `bson:"event" json:"event"`
+    UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+    Details   bson.M             `bson:"details,omitempty" json:"details,omitempty"`
+    CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
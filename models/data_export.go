@@ -0,0 +1,22 @@
+// models/data_export.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DataExport is a user's request for a copy of their data. The archive is
+// built in the background and kept in GridFS under FileID until ExpiresAt.
+type DataExport struct {
+    ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+    UserID      primitive.ObjectID  `bson:"user_id" json:"-"`
+    Status      string              `bson:"status" json:"status"`
+    FileID      *primitive.ObjectID `bson:"file_id,omitempty" json:"-"`
+    Size        int64               `bson:"size,omitempty" json:"size,omitempty"`
+    CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+    StartedAt   *time.Time          `bson:"started_at,omitempty" json:"started_at,omitempty"`
+    CompletedAt *time.Time          `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+    ExpiresAt   *time.Time          `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+}
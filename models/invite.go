@@ -0,0 +1,22 @@
+// models/invite.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invite is an invite code that allows registering while registration is invite-only.
+// Only the hash of the code is stored; CodePrefix lets admins recognise it.
+type Invite struct {
+    ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    CodeHash   string             `bson:"code_hash" json:"-"`
+    CodePrefix string             `bson:"code_prefix" json:"code_prefix"`
+    CreatedBy  primitive.ObjectID `bson:"created_by" json:"created_by"`
+    CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+    ExpiresAt  *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+    MaxUses    int                `bson:"max_uses" json:"max_uses"`
+    Uses       int                `bson:"uses" json:"uses"`
+    RevokedAt  *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
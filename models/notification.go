@@ -0,0 +1,29 @@
+// models/notification.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Types of notifications
+const (
+    NotificationReply  = "reply"
+    NotificationRepost = "repost"
+    NotificationQuote  = "quote"
+)
+
+// Notification tells a user that another user acted on their content, such
+// as replying to, reposting or quoting their post. Actor and Post are filled in for responses.
+type Notification struct {
+    ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+    UserID    primitive.ObjectID `json:"-" bson:"user_id"`
+    Type      string             `json:"type" bson:"type"`
+    ActorID   primitive.ObjectID `json:"-" bson:"actor_id"`
+    PostID    primitive.ObjectID `json:"post_id" bson:"post_id"`
+    CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+    ReadAt    *time.Time         `json:"read_at,omitempty" bson:"read_at,omitempty"`
+    Actor     *Author            `json:"actor,omitempty" bson:"-"`
+    Post      *Post              `json:"post,omitempty" bson:"-"`
+}
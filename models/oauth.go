@@ -0,0 +1,51 @@
+// models/oauth.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OAuthClient is a third-party application registered to act on users' behalf.
+// Confidential clients authenticate with a secret of which only the hash is
+// stored; public clients such as single-page and native apps rely on PKCE alone.
+type OAuthClient struct {
+    ID           primitive.ObjectID `bson:"_id,omitempty" json:"client_id"`
+    OwnerID      primitive.ObjectID `bson:"owner_id" json:"-"`
+    Name         string             `bson:"name" json:"name"`
+    SecretHash   string             `bson:"secret_hash,omitempty" json:"-"`
+    Confidential bool               `bson:"confidential" json:"confidential"`
+    RedirectURIs []string           `bson:"redirect_uris" json:"redirect_uris"`
+    Scopes       []string           `bson:"scopes" json:"scopes"`
+    CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// OAuthGrant records a user's consent for a client to use the given scopes.
+// Its ID identifies every token issued under the consent: it is the refresh
+// token family and the `sid` of the access tokens.
+type OAuthGrant struct {
+    ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID     primitive.ObjectID `bson:"user_id" json:"-"`
+    ClientID   primitive.ObjectID `bson:"client_id" json:"client_id"`
+    ClientName string             `bson:"-" json:"client_name"`
+    Scopes     []string           `bson:"scopes" json:"scopes"`
+    CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+    UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// OAuthAuthorizationCode is a short-lived, single-use code handed to a client
+// after the user approved its request. Only the hash of the code is stored.
+type OAuthAuthorizationCode struct {
+    ID            primitive.ObjectID `bson:"_id,omitempty"`
+    CodeHash      string             `bson:"code_hash"`
+    ClientID      primitive.ObjectID `bson:"client_id"`
+    UserID        primitive.ObjectID `bson:"user_id"`
+    GrantID       primitive.ObjectID `bson:"grant_id"`
+    RedirectURI   string             `bson:"redirect_uri"`
+    Scopes        []string           `bson:"scopes"`
+    CodeChallenge string             `bson:"code_challenge"`
+    CreatedAt     time.Time          `bson:"created_at"`
+    ExpiresAt     time.Time          `bson:"expires_at"`
+    UsedAt        *time.Time         `bson:"used_at,omitempty"`
+}
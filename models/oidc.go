@@ -0,0 +1,32 @@
+// models/oidc.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Identity links a user to an account at an external OpenID Connect provider.
+type Identity struct {
+    Provider string    `bson:"provider" json:"provider"`
+    Subject  string    `bson:"subject" json:"-"`
+    Email    string    `bson:"email,omitempty" json:"email,omitempty"`
+    LinkedAt time.Time `bson:"linked_at" json:"linked_at"`
+}
+
+// OIDCState is a pending authorization request. It is looked up by the state
+// parameter echoed back by the provider, together with the binding kept by the
+// browser that started it, and deleted on first use. UserID is set when an
+// authenticated user is linking a provider to their account.
+type OIDCState struct {
+    ID           primitive.ObjectID  `bson:"_id,omitempty"`
+    StateHash    string              `bson:"state_hash"`
+    BindingHash  string              `bson:"binding_hash"`
+    Provider     string              `bson:"provider"`
+    Nonce        string              `bson:"nonce"`
+    CodeVerifier string              `bson:"code_verifier"`
+    UserID       *primitive.ObjectID `bson:"user_id,omitempty"`
+    CreatedAt    time.Time           `bson:"created_at"`
+    ExpiresAt    time.Time           `bson:"expires_at"`
+}
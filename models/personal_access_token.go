@@ -0,0 +1,23 @@
+// models/personal_access_token.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// PersonalAccessToken is a long-lived, scoped token a user creates for bots
+// and scripts. Only the hash is stored; Prefix lets the owner recognise it.
+type PersonalAccessToken struct {
+    ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    UserID     primitive.ObjectID `bson:"user_id" json:"-"`
+    Name       string             `bson:"name" json:"name"`
+    TokenHash  string             `bson:"token_hash" json:"-"`
+    Prefix     string             `bson:"prefix" json:"prefix"`
+    Scopes     []string           `bson:"scopes" json:"scopes"`
+    CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+    ExpiresAt  *time.Time         `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+    LastUsedAt *time.Time         `bson:"last_used_at,omitempty" json:"last_used_at,omitempty"`
+    RevokedAt  *time.Time         `bson:"revoked_at,omitempty" json:"-"`
+}
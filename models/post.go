@@ -7,10 +7,48 @@ import (
     "go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+// Post is a message in the feed. Deleted posts are kept as tombstones without
+// content so references to them still resolve. A reply lists the posts above
+// it in Ancestors, starting with the post that began the conversation.
+// Reactions counts the reactions to the post by emoji; ReactedByMe lists
+// those of the requesting user. A repost has no content of its own and points
+// to the post it shares with RepostOf; a quote post adds content to the post
+// in QuoteOf. Original holds that post in responses.
 type Post struct {
-    ID        primitive.ObjectID `json:"id,omitempty" bson:"_id,omitempty"`
-    UserID    primitive.ObjectID `json:"user_id,omitempty" bson:"user_id,omitempty"`
-    Username  string             `json:"username,omitempty" bson:"username,omitempty"`
-    Content   string             `json:"content,omitempty" bson:"content,omitempty"`
-    CreatedAt time.Time          `json:"created_at,omitempty" bson:"created_at,omitempty"`
+    ID             primitive.ObjectID   `json:"id,omitempty" bson:"_id,omitempty"`
+    UserID         primitive.ObjectID   `json:"user_id,omitempty" bson:"user_id,omitempty"`
+    Username       string               `json:"username,omitempty" bson:"username,omitempty"`
+    Content        string               `json:"content,omitempty" bson:"content,omitempty"`
+    CreatedAt      time.Time            `json:"created_at,omitempty" bson:"created_at,omitempty"`
+    EditedAt       *time.Time           `json:"edited_at,omitempty" bson:"edited_at,omitempty"`
+    DeletedAt      *time.Time           `json:"deleted_at,omitempty" bson:"deleted_at,omitempty"`
+    InReplyTo      *primitive.ObjectID  `json:"in_reply_to,omitempty" bson:"in_reply_to,omitempty"`
+    ConversationID primitive.ObjectID   `json:"conversation_id,omitempty" bson:"conversation_id,omitempty"`
+    Ancestors      []primitive.ObjectID `json:"-" bson:"ancestors,omitempty"`
+    Depth          int                  `json:"-" bson:"depth,omitempty"`
+    ReplyCount     int                  `json:"reply_count" bson:"reply_count,omitempty"`
+    RepostOf       *primitive.ObjectID  `json:"repost_of,omitempty" bson:"repost_of,omitempty"`
+    QuoteOf        *primitive.ObjectID  `json:"quote_of,omitempty" bson:"quote_of,omitempty"`
+    RepostCount    int                  `json:"repost_count" bson:"repost_count,omitempty"`
+    QuoteCount     int                  `json:"quote_count" bson:"quote_count,omitempty"`
+    Reactions      map[string]int       `json:"reactions,omitempty" bson:"reactions,omitempty"`
+    ReactedByMe    []string             `json:"reacted_by_me,omitempty" bson:"-"`
+    Original       *Post                `json:"original,omitempty" bson:"-"`
+    Author         *Author              `json:"author,omitempty" bson:"-"`
+}
+
+// PostRevision is an earlier version of an edited post's content.
+type PostRevision struct {
+    ID        primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+    PostID    primitive.ObjectID `json:"-" bson:"post_id"`
+    Content   string             `json:"content" bson:"content"`
+    CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Author summarizes the current profile of a post's author in responses.
+type Author struct {
+    ID          primitive.ObjectID `json:"id" bson:"_id"`
+    Username    string             `json:"username" bson:"username"`
+    DisplayName string             `json:"display_name,omitempty" bson:"display_name,omitempty"`
+    AvatarURL   string             `json:"avatar_url,omitempty" bson:"avatar_url,omitempty"`
 }
@@ -0,0 +1,19 @@
+// models/reaction.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Reaction records that a user reacted to a post with an emoji. User is
+// filled in for responses.
+type Reaction struct {
+    ID        primitive.ObjectID `json:"-" bson:"_id,omitempty"`
+    PostID    primitive.ObjectID `json:"-" bson:"post_id"`
+    UserID    primitive.ObjectID `json:"-" bson:"user_id"`
+    Emoji     string             `json:"emoji" bson:"emoji"`
+    CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+    User      *Author            `json:"user,omitempty" bson:"-"`
+}
@@ -0,0 +1,23 @@
+// models/refresh_token.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RefreshToken is a server-side record of an issued refresh token. Tokens issued
+// by rotating one another share a FamilyID so a replayed token can revoke the chain.
+// Scopes is only set for tokens held by OAuth clients.
+type RefreshToken struct {
+    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    TokenHash string             `bson:"token_hash" json:"-"`
+    UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+    FamilyID  primitive.ObjectID `bson:"family_id" json:"family_id"`
+    Scopes    []string           `bson:"scopes,omitempty" json:"scopes,omitempty"`
+    CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+    ExpiresAt time.Time          `bson:"expires_at" json:"expires_at"`
+    UsedAt    *time.Time         `bson:"used_at,omitempty" json:"used_at,omitempty"`
+    RevokedAt *time.Time         `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+}
@@ -0,0 +1,22 @@
+// models/session.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Session is a signed-in device. Its ID is the family ID shared by the refresh
+// tokens issued to the device and is embedded in access tokens as `sid`.
+type Session struct {
+    ID          primitive.ObjectID `bson:"_id" json:"id"`
+    UserID      primitive.ObjectID `bson:"user_id" json:"-"`
+    DeviceLabel string             `bson:"device_label" json:"device_label"`
+    UserAgent   string             `bson:"user_agent" json:"user_agent"`
+    IP          string             `bson:"ip" json:"ip"`
+    CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+    LastSeenAt  time.Time          `bson:"last_seen_at" json:"last_seen_at"`
+    ExpiresAt   time.Time          `bson:"expires_at" json:"expires_at"`
+    RevokedAt   *time.Time         `bson:"revoked_at,omitempty" json:"-"`
+}
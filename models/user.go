@@ -1,11 +1,56 @@
 // models/user.go
 package models
 
-import "go.mongodb.org/mongo-driver/bson/primitive"
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
 
 type User struct {
-    ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
-    Username  string             `bson:"username" json:"username"`
-    Password  string             `bson:"password" json:"-"`
-    CreatedAt string             `bson:"created_at" json:"created_at"`
+    ID                  primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+    Username            string             `bson:"username" json:"username"`
+    UsernameKey         string             `bson:"username_key,omitempty" json:"-"`
+    UsernameSkeleton    string             `bson:"username_skeleton,omitempty" json:"-"`
+    Password            string             `bson:"password" json:"-"`
+    Email               string             `bson:"email,omitempty" json:"email,omitempty"`
+    EmailVerified       bool               `bson:"email_verified" json:"email_verified"`
+    Roles               []string           `bson:"roles,omitempty" json:"roles,omitempty"`
+    TOTPEnabled         bool               `bson:"totp_enabled" json:"totp_enabled"`
+    TOTPSecret          string             `bson:"totp_secret,omitempty" json:"-"`
+    TOTPPending         string             `bson:"totp_pending_secret,omitempty" json:"-"`
+    TOTPLastStep        int64              `bson:"totp_last_step" json:"-"`
+    RecoveryCodes       []string           `bson:"recovery_codes,omitempty" json:"-"`
+    Identities          []Identity         `bson:"identities,omitempty" json:"identities,omitempty"`
+    DisplayName         string             `bson:"display_name,omitempty" json:"display_name,omitempty"`
+    Bio                 string             `bson:"bio,omitempty" json:"bio,omitempty"`
+    AvatarURL           string             `bson:"avatar_url,omitempty" json:"avatar_url,omitempty"`
+    Website             string             `bson:"website,omitempty" json:"website,omitempty"`
+    Location            string             `bson:"location,omitempty" json:"location,omitempty"`
+    UsernameChangedAt   *time.Time         `bson:"username_changed_at,omitempty" json:"username_changed_at,omitempty"`
+    PreviousUsernames   []PreviousUsername `bson:"previous_usernames,omitempty" json:"previous_usernames,omitempty"`
+    CreatedAt           string             `bson:"created_at" json:"created_at"`
+    DeletionScheduledAt *time.Time         `bson:"deletion_scheduled_at,omitempty" json:"deletion_scheduled_at,omitempty"`
+    ErasureStartedAt    *time.Time         `bson:"erasure_started_at,omitempty" json:"-"`
+}
+
+// PreviousUsername is a handle the user gave up. It stays reserved for them,
+// and redirects to their account, until ReservedUntil.
+type PreviousUsername struct {
+    Username      string    `bson:"username" json:"username"`
+    Skeleton      string    `bson:"skeleton" json:"-"`
+    ChangedAt     time.Time `bson:"changed_at" json:"changed_at"`
+    ReservedUntil time.Time `bson:"reserved_until" json:"reserved_until"`
+}
+
+// Profile is the public part of a user's account.
+type Profile struct {
+    ID          primitive.ObjectID `json:"id"`
+    Username    string             `json:"username"`
+    DisplayName string             `json:"display_name,omitempty"`
+    Bio         string             `json:"bio,omitempty"`
+    AvatarURL   string             `json:"avatar_url,omitempty"`
+    Website     string             `json:"website,omitempty"`
+    Location    string             `json:"location,omitempty"`
+    CreatedAt   string             `json:"created_at"`
 }
@@ -0,0 +1,31 @@
+// models/ws_ticket.go
+package models
+
+import (
+    "time"
+
+    "go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WebSocketTicket is a single-use credential for opening a WebSocket
+// connection from a browser, which cannot send an Authorization header with
+// the upgrade. It stands in for the access token it was issued with and is
+// bound to the origin of the page that asked for it. Tickets issued with a
+// personal access token name it so it can be checked again when they are
+// redeemed. Only the hash is stored.
+type WebSocketTicket struct {
+    ID             primitive.ObjectID `bson:"_id,omitempty"`
+    TicketHash     string             `bson:"ticket_hash"`
+    UserID         string             `bson:"user_id"`
+    TokenID        string             `bson:"token_id"`
+    SessionID      string             `bson:"session_id,omitempty"`
+    ClientID       string             `bson:"client_id,omitempty"`
+    Scope          string             `bson:"scope,omitempty"`
+    TokenIssuedAt  int64              `bson:"token_issued_at"`
+    TokenIssuedMs  int64              `bson:"token_issued_ms,omitempty"`
+    PersonalToken  string             `bson:"personal_token_id,omitempty"`
+    TokenExpiresAt int64              `bson:"token_expires_at"`
+    Origin         string             `bson:"origin"`
+    CreatedAt      time.Time          `bson:"created_at"`
+    ExpiresAt      time.Time          `bson:"expires_at"`
+}
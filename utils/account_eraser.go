@@ -0,0 +1,358 @@
+// utils/account_eraser.go
+package utils
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"social-experiment/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// erasureLease is how long an erasure may run before another instance takes it over.
+const erasureLease = 10 * time.Minute
+
+// DeletedUsername replaces the author of posts kept after their account was erased.
+const DeletedUsername = "[deleted]"
+
+// ConnectionCloser closes live WebSocket connections. It is implemented by
+// websocket.Hub, which cannot be imported here.
+type ConnectionCloser interface {
+	DisconnectUser(userID string)
+	DisconnectSession(sessionID string)
+}
+
+// AccountEraser erases accounts whose deletion grace period has passed: it
+// revokes and deletes their credentials, closes their connections, deletes
+// their data exports, reactions, reposts and notifications, deletes or
+// anonymizes their posts, removes the user and records an audit event.
+// Every step can be repeated, so an erasure interrupted midway is resumed once
+// its lease runs out.
+type AccountEraser struct {
+	users          *mongo.Collection
+	posts          *mongo.Collection
+	postRevisions  *mongo.Collection
+	reactions      *mongo.Collection
+	notifications  *mongo.Collection
+	postsMode      string
+	revocations    *RevocationList
+	issuer         *TokenIssuer
+	personalTokens *PersonalAccessTokenStore
+	oauth          *OAuthServer
+	exports        *DataExporter
+	audit          *AuditLog
+	connections    ConnectionCloser
+}
+
+// NewAccountEraser initializes a new AccountEraser. It fails if
+// DELETED_ACCOUNT_POSTS is neither "anonymize" nor "delete".
+func NewAccountEraser(config Config, users, posts, postRevisions, reactions, notifications *mongo.Collection, revocations *RevocationList, issuer *TokenIssuer, personalTokens *PersonalAccessTokenStore, oauth *OAuthServer, exports *DataExporter, audit *AuditLog, connections ConnectionCloser) (*AccountEraser, error) {
+	if config.DeletedAccountPosts != DeletedPostsAnonymize && config.DeletedAccountPosts != DeletedPostsDelete {
+		return nil, fmt.Errorf("unknown DELETED_ACCOUNT_POSTS %q", config.DeletedAccountPosts)
+	}
+	return &AccountEraser{
+		users:          users,
+		posts:          posts,
+		postRevisions:  postRevisions,
+		reactions:      reactions,
+		notifications:  notifications,
+		postsMode:      config.DeletedAccountPosts,
+		revocations:    revocations,
+		issuer:         issuer,
+		personalTokens: personalTokens,
+		oauth:          oauth,
+		exports:        exports,
+		audit:          audit,
+		connections:    connections,
+	}, nil
+}
+
+// EnsureIndexes creates the index used to find accounts due for erasure.
+func (e *AccountEraser) EnsureIndexes(ctx context.Context) error {
+	_, err := e.users.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "deletion_scheduled_at", Value: 1}},
+		Options: options.Index().SetSparse(true),
+	})
+	return err
+}
+
+// Run erases due accounts every interval until the context is cancelled.
+func (e *AccountEraser) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := e.EraseDue(ctx); err != nil {
+			log.Printf("[ERROR] Error erasing deleted accounts: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// EraseDue erases every account whose grace period has passed and returns how
+// many were erased.
+func (e *AccountEraser) EraseDue(ctx context.Context) (int, error) {
+	erased := 0
+	for {
+		now := time.Now()
+
+		// Claim one account at a time so concurrent instances share the work
+		var user models.User
+		err := e.users.FindOneAndUpdate(ctx,
+			bson.M{
+				"deletion_scheduled_at": bson.M{"$lte": now},
+				"$or": []bson.M{
+					{"erasure_started_at": nil},
+					{"erasure_started_at": bson.M{"$lt": now.Add(-erasureLease)}},
+				},
+			},
+			bson.M{"$set": bson.M{"erasure_started_at": now}},
+		).Decode(&user)
+		if err == mongo.ErrNoDocuments {
+			return erased, nil
+		}
+		if err != nil {
+			return erased, err
+		}
+
+		if err := e.erase(ctx, user); err != nil {
+			return erased, fmt.Errorf("erasing user %s: %w", user.ID.Hex(), err)
+		}
+		erased++
+	}
+}
+
+func (e *AccountEraser) erase(ctx context.Context, user models.User) error {
+	userID := user.ID.Hex()
+
+	// Revoke and delete every credential, then close live connections
+	if err := e.revocations.RevokeUser(ctx, userID); err != nil {
+		return err
+	}
+	if err := e.issuer.DeleteUser(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := e.personalTokens.DeleteUser(ctx, user.ID); err != nil {
+		return err
+	}
+	grantIDs, err := e.oauth.DeleteUser(ctx, user.ID)
+	for _, grantID := range grantIDs {
+		e.connections.DisconnectSession(grantID)
+	}
+	if err != nil {
+		return err
+	}
+	e.connections.DisconnectUser(userID)
+
+	if err := e.exports.DeleteUser(ctx, user.ID); err != nil {
+		return err
+	}
+
+	if err := e.deleteReactions(ctx, user.ID); err != nil {
+		return err
+	}
+	if err := e.deleteReposts(ctx, user.ID); err != nil {
+		return err
+	}
+
+	_, err = e.notifications.DeleteMany(ctx, bson.M{"$or": []bson.M{
+		{"user_id": user.ID},
+		{"actor_id": user.ID},
+	}})
+	if err != nil {
+		return err
+	}
+
+	var posts int64
+	if e.postsMode == DeletedPostsDelete {
+		// Delete the edit history and reactions first so none are left
+		// behind if the erasure is interrupted
+		postIDs, err := e.posts.Distinct(ctx, "_id", bson.M{"user_id": user.ID})
+		if err != nil {
+			return err
+		}
+		if len(postIDs) > 0 {
+			if _, err := e.postRevisions.DeleteMany(ctx, bson.M{"post_id": bson.M{"$in": postIDs}}); err != nil {
+				return err
+			}
+			if _, err := e.reactions.DeleteMany(ctx, bson.M{"post_id": bson.M{"$in": postIDs}}); err != nil {
+				return err
+			}
+		}
+		replies, err := e.deleteReplies(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		// Posts others replied to, reposted or quoted stay as tombstones so
+		// those keep their place
+		result, err := e.posts.UpdateMany(ctx,
+			bson.M{"user_id": user.ID, "$or": []bson.M{
+				{"reply_count": bson.M{"$gt": 0}},
+				{"repost_count": bson.M{"$gt": 0}},
+				{"quote_count": bson.M{"$gt": 0}},
+			}},
+			bson.M{
+				"$set":   bson.M{"username": DeletedUsername, "deleted_at": time.Now()},
+				"$unset": bson.M{"user_id": "", "content": "", "edited_at": "", "reactions": ""},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		posts = replies + result.ModifiedCount
+		deleted, err := e.posts.DeleteMany(ctx, bson.M{"user_id": user.ID})
+		if err != nil {
+			return err
+		}
+		posts += deleted.DeletedCount
+	} else {
+		result, err := e.posts.UpdateMany(ctx,
+			bson.M{"user_id": user.ID},
+			bson.M{
+				"$set":   bson.M{"username": DeletedUsername},
+				"$unset": bson.M{"user_id": ""},
+			},
+		)
+		if err != nil {
+			return err
+		}
+		posts = result.ModifiedCount
+	}
+
+	if _, err := e.users.DeleteOne(ctx, bson.M{"_id": user.ID}); err != nil {
+		return err
+	}
+
+	details := bson.M{
+		"scheduled_at": user.DeletionScheduledAt,
+		"posts_mode":   e.postsMode,
+		"posts":        posts,
+	}
+	if err := e.audit.Record(ctx, AuditAccountErased, user.ID, details); err != nil {
+		log.Printf("[ERROR] Error recording erasure of user %s: %v", userID, err)
+	}
+	log.Printf("[INFO] Erased account (UserID: %s, posts %s: %d)", userID, e.postsMode, posts)
+	return nil
+}
+
+// deleteReactions takes back the user's reactions one at a time, deleting
+// each before its count, so a resumed erasure never takes one back twice.
+func (e *AccountEraser) deleteReactions(ctx context.Context, userID primitive.ObjectID) error {
+	cursor, err := e.reactions.Find(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var reaction models.Reaction
+		if err := cursor.Decode(&reaction); err != nil {
+			return err
+		}
+		result, err := e.reactions.DeleteOne(ctx, bson.M{"_id": reaction.ID})
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount == 0 {
+			continue
+		}
+		field := "reactions." + reaction.Emoji
+		if _, err := e.posts.UpdateOne(ctx, bson.M{"_id": reaction.PostID}, bson.M{"$inc": bson.M{field: -1}}); err != nil {
+			return err
+		}
+		if _, err := e.posts.UpdateOne(ctx,
+			bson.M{"_id": reaction.PostID, field: bson.M{"$lte": 0}},
+			bson.M{"$unset": bson.M{field: ""}},
+		); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// deleteReposts takes back the user's reposts one at a time, deleting each
+// before its count, so a resumed erasure never takes one back twice.
+func (e *AccountEraser) deleteReposts(ctx context.Context, userID primitive.ObjectID) error {
+	cursor, err := e.posts.Find(ctx, bson.M{"user_id": userID, "repost_of": bson.M{"$exists": true}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var repost models.Post
+		if err := cursor.Decode(&repost); err != nil {
+			return err
+		}
+		result, err := e.posts.DeleteOne(ctx, bson.M{"_id": repost.ID})
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount == 0 {
+			continue
+		}
+		if _, err := e.posts.UpdateOne(ctx, bson.M{"_id": repost.RepostOf}, bson.M{"$inc": bson.M{"repost_count": -1}}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// deleteReplies deletes the user's replies and quote posts that nobody replied
+// to, reposted or quoted, and takes them off the counts of the posts they
+// answer, returning how many were deleted. Newest go first, so a reply to the
+// user's own reply frees it too.
+func (e *AccountEraser) deleteReplies(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	cursor, err := e.posts.Find(ctx,
+		bson.M{"user_id": userID, "$or": []bson.M{
+			{"in_reply_to": bson.M{"$exists": true}},
+			{"quote_of": bson.M{"$exists": true}},
+		}},
+		options.Find().SetSort(NewestFirst()),
+	)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var deleted int64
+	for cursor.Next(ctx) {
+		var post models.Post
+		if err := cursor.Decode(&post); err != nil {
+			return 0, err
+		}
+		result, err := e.posts.DeleteOne(ctx, bson.M{"_id": post.ID, "$nor": []bson.M{
+			{"reply_count": bson.M{"$gt": 0}},
+			{"repost_count": bson.M{"$gt": 0}},
+			{"quote_count": bson.M{"$gt": 0}},
+		}})
+		if err != nil {
+			return 0, err
+		}
+		if result.DeletedCount == 0 {
+			continue
+		}
+		deleted++
+		if post.InReplyTo != nil {
+			if _, err := e.posts.UpdateOne(ctx, bson.M{"_id": *post.InReplyTo}, bson.M{"$inc": bson.M{"reply_count": -1}}); err != nil {
+				return 0, err
+			}
+		}
+		if post.QuoteOf != nil {
+			if _, err := e.posts.UpdateOne(ctx, bson.M{"_id": *post.QuoteOf}, bson.M{"$inc": bson.M{"quote_count": -1}}); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return deleted, cursor.Err()
+}
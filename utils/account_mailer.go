@@ -0,0 +1,58 @@
+// utils/account_mailer.go
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+
+	"social-experiment/models"
+)
+
+// AccountMailer issues action tokens and emails the links that redeem them.
+type AccountMailer struct {
+	mailer    Mailer
+	tokens    *ActionTokenStore
+	baseURL   string
+	resetTTL  time.Duration
+	verifyTTL time.Duration
+}
+
+// NewAccountMailer initializes a new AccountMailer.
+func NewAccountMailer(mailer Mailer, tokens *ActionTokenStore, config Config) *AccountMailer {
+	return &AccountMailer{
+		mailer:    mailer,
+		tokens:    tokens,
+		baseURL:   config.AppBaseURL,
+		resetTTL:  config.PasswordResetTTL,
+		verifyTTL: config.EmailVerificationTTL,
+	}
+}
+
+// SendPasswordReset emails a single-use password reset link to the user's verified address.
+func (am *AccountMailer) SendPasswordReset(ctx context.Context, user models.User) error {
+	token, err := am.tokens.Issue(ctx, PurposePasswordReset, user.ID, user.Email, am.resetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := am.baseURL + "/reset-password?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your account. "+
+		"Use the link below within %s to choose a new password:\n\n%s\n\n"+
+		"If you did not ask for this, you can ignore this email.", user.Username, am.resetTTL, link)
+	return am.mailer.Send(user.Email, "Reset your password", body)
+}
+
+// SendEmailVerification emails a link confirming that the user owns their address.
+func (am *AccountMailer) SendEmailVerification(ctx context.Context, user models.User) error {
+	token, err := am.tokens.Issue(ctx, PurposeEmailVerification, user.ID, user.Email, am.verifyTTL)
+	if err != nil {
+		return err
+	}
+
+	link := am.baseURL + "/verify-email?token=" + url.QueryEscape(token)
+	body := fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below within %s:\n\n%s",
+		user.Username, am.verifyTTL, link)
+	return am.mailer.Send(user.Email, "Confirm your email address", body)
+}
@@ -0,0 +1,120 @@
+// utils/action_token.go
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"social-experiment/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Action token purposes
+const (
+	PurposePasswordReset     = "password_reset"
+	PurposeEmailVerification = "email_verification"
+)
+
+// ErrActionTokenInvalid is returned for unknown, expired or already used action tokens.
+var ErrActionTokenInvalid = errors.New("invalid or expired token")
+
+// ActionTokenStore persists single-use action tokens by their hash.
+type ActionTokenStore struct {
+	coll *mongo.Collection
+}
+
+// NewActionTokenStore initializes a new ActionTokenStore backed by the given collection.
+func NewActionTokenStore(coll *mongo.Collection) *ActionTokenStore {
+	return &ActionTokenStore{coll: coll}
+}
+
+// EnsureIndexes creates the lookup indexes and the TTL index that purges expired tokens.
+func (s *ActionTokenStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "purpose", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// Issue invalidates the user's outstanding tokens for the purpose and returns a new raw token.
+func (s *ActionTokenStore) Issue(ctx context.Context, purpose string, userID primitive.ObjectID, email string, ttl time.Duration) (string, error) {
+	if err := s.Invalidate(ctx, purpose, userID); err != nil {
+		return "", err
+	}
+
+	token, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	record := models.ActionToken{
+		ID:        primitive.NewObjectID(),
+		TokenHash: HashToken(token),
+		Purpose:   purpose,
+		UserID:    userID,
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	}
+	if _, err := s.coll.InsertOne(ctx, record); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Lookup returns a valid token without consuming it.
+func (s *ActionTokenStore) Lookup(ctx context.Context, purpose, token string) (*models.ActionToken, error) {
+	var record models.ActionToken
+	err := s.coll.FindOne(ctx, bson.M{
+		"token_hash": HashToken(token),
+		"purpose":    purpose,
+		"used_at":    nil,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrActionTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Consume atomically marks a valid token as used and returns it.
+func (s *ActionTokenStore) Consume(ctx context.Context, purpose, token string) (*models.ActionToken, error) {
+	now := time.Now()
+	var record models.ActionToken
+	err := s.coll.FindOneAndUpdate(ctx,
+		bson.M{
+			"token_hash": HashToken(token),
+			"purpose":    purpose,
+			"used_at":    nil,
+			"expires_at": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrActionTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// Invalidate marks every outstanding token of the purpose for the user as used.
+func (s *ActionTokenStore) Invalidate(ctx context.Context, purpose string, userID primitive.ObjectID) error {
+	_, err := s.coll.UpdateMany(ctx,
+		bson.M{"user_id": userID, "purpose": purpose, "used_at": nil},
+		bson.M{"$set": bson.M{"used_at": time.Now()}},
+	)
+	return err
+}
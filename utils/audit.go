@@ -0,0 +1,50 @@
+// utils/audit.go
+package utils
+
+import (
+	"context"
+	"time"
+
+	"social-experiment/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Audit events
+const (
+	AuditAccountErased  = "account.erased"
+	AuditIdentityLinked = "identity.linked"
+)
+
+// AuditLog is an append-only record of security-relevant events.
+type AuditLog struct {
+	coll *mongo.Collection
+}
+
+// NewAuditLog initializes a new AuditLog backed by the given collection.
+func NewAuditLog(coll *mongo.Collection) *AuditLog {
+	return &AuditLog{coll: coll}
+}
+
+// EnsureIndexes creates the lookup indexes.
+func (l *AuditLog) EnsureIndexes(ctx context.Context) error {
+	_, err := l.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "event", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return err
+}
+
+// Record appends an event concerning the user.
+func (l *AuditLog) Record(ctx context.Context, event string, userID primitive.ObjectID, details bson.M) error {
+	_, err := l.coll.InsertOne(ctx, models.AuditEvent{
+		ID:        primitive.NewObjectID(),
+		Event:     event,
+		UserID:    userID,
+		Details:   details,
+		CreatedAt: time.Now(),
+	})
+	return err
+}
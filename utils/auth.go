@@ -0,0 +1,134 @@
+// utils/auth.go
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ErrTokenRevoked is returned when a structurally valid token has been revoked.
+var ErrTokenRevoked = errors.New("token revoked")
+
+// Authenticator validates bearer tokens presented to HTTP and WebSocket endpoints.
+type Authenticator struct {
+	keys           *KeyRing
+	revocations    *RevocationList
+	sessions       *SessionStore
+	personalTokens *PersonalAccessTokenStore
+	tickets        *WebSocketTicketStore
+}
+
+// NewAuthenticator initializes a new Authenticator.
+func NewAuthenticator(keys *KeyRing, revocations *RevocationList, sessions *SessionStore, personalTokens *PersonalAccessTokenStore, tickets *WebSocketTicketStore) *Authenticator {
+	return &Authenticator{
+		keys:           keys,
+		revocations:    revocations,
+		sessions:       sessions,
+		personalTokens: personalTokens,
+		tickets:        tickets,
+	}
+}
+
+// Authenticate validates a JWT or personal access token, with or without a
+// "Bearer " prefix, and returns its claims if it has not been revoked.
+func (a *Authenticator) Authenticate(ctx context.Context, token string) (*Claims, error) {
+	token = strings.TrimSpace(token)
+	if parts := strings.SplitN(token, " ", 2); len(parts) == 2 && strings.EqualFold(parts[0], "bearer") {
+		token = strings.TrimSpace(parts[1])
+	}
+
+	if IsPersonalAccessToken(token) {
+		return a.authenticatePersonalToken(ctx, token)
+	}
+
+	claims, err := ValidateJWT(token, a.keys)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("not an access token")
+	}
+
+	revoked, err := a.revocations.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// AuthenticateTicket redeems a WebSocket ticket presented from the given origin
+// and returns the claims of the token it was issued with, provided that token
+// has not been revoked or, for a personal access token, expired since.
+func (a *Authenticator) AuthenticateTicket(ctx context.Context, ticket, origin string) (*Claims, error) {
+	claims, err := a.tickets.Redeem(ctx, ticket, origin)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.PersonalTokenID != "" {
+		tokenID, err := primitive.ObjectIDFromHex(claims.PersonalTokenID)
+		if err != nil {
+			return nil, err
+		}
+		active, err := a.personalTokens.IsActive(ctx, tokenID)
+		if err != nil {
+			return nil, err
+		}
+		if !active {
+			return nil, ErrTokenRevoked
+		}
+	}
+
+	revoked, err := a.revocations.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	return claims, nil
+}
+
+// authenticatePersonalToken looks up a personal access token and describes it
+// as scoped claims. Its record ID stands in for the jti.
+func (a *Authenticator) authenticatePersonalToken(ctx context.Context, token string) (*Claims, error) {
+	record, err := a.personalTokens.Lookup(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{
+		UserID:          record.UserID.Hex(),
+		Scope:           strings.Join(record.Scopes, " "),
+		PersonalTokenID: record.ID.Hex(),
+	}
+	claims.Id = record.ID.Hex()
+	claims.IssuedAt = record.CreatedAt.Unix()
+	claims.IssuedAtMs = record.CreatedAt.UnixMilli()
+	if record.ExpiresAt != nil {
+		claims.ExpiresAt = record.ExpiresAt.Unix()
+	}
+	return claims, nil
+}
+
+// TouchSession records activity on the session the token belongs to. Tokens
+// issued before sessions existed carry no session ID and are ignored, as are
+// tokens of OAuth clients, whose session is their grant.
+func (a *Authenticator) TouchSession(ctx context.Context, claims *Claims, ip string) error {
+	if claims.SessionID == "" || claims.ClientID != "" {
+		return nil
+	}
+	sessionID, err := primitive.ObjectIDFromHex(claims.SessionID)
+	if err != nil {
+		return err
+	}
+	return a.sessions.Touch(ctx, sessionID, ip)
+}
@@ -6,20 +6,85 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 	"golang.org/x/time/rate"
 )
 
+// Registration modes
+const (
+	RegistrationOpen        = "open"
+	RegistrationVerifyEmail = "verify_email"
+	RegistrationInvite      = "invite"
+	RegistrationClosed      = "closed"
+)
+
+// What happens to the posts of an erased account
+const (
+	DeletedPostsAnonymize = "anonymize"
+	DeletedPostsDelete    = "delete"
+)
+
+// OIDCProviderConfig configures an external OpenID Connect identity provider.
+// TrustEmail lets the provider's verified email addresses sign in to existing
+// accounts with the same verified address.
+type OIDCProviderConfig struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	TrustEmail   bool
+}
+
 // Config holds all configuration variables
 type Config struct {
-	MongoURI        string
-	JWTSecret       string
-	ServerPort      string
-	RateLimit       rate.Limit
-	RateBurst       int
-	CORSOrigins     []string
-	SecurityHeaders bool
+	MongoURI                   string
+	JWTSecret                  string
+	ServerPort                 string
+	RateLimit                  rate.Limit
+	RateBurst                  int
+	CORSOrigins                []string
+	SecurityHeaders            bool
+	AccessTokenTTL             time.Duration
+	RefreshTokenTTL            time.Duration
+	JWTKeysFile                string
+	JWTKeyGracePeriod          time.Duration
+	AppBaseURL                 string
+	MailDriver                 string
+	MailFrom                   string
+	MailLogFile                string
+	SMTPHost                   string
+	SMTPPort                   int
+	SMTPUsername               string
+	SMTPPassword               string
+	PasswordResetTTL           time.Duration
+	EmailVerificationTTL       time.Duration
+	RegistrationMode           string
+	AdminUsers                 []string
+	TOTPIssuer                 string
+	LoginMaxFailures           int
+	LoginIPMaxFailures         int
+	LoginLockoutDuration       time.Duration
+	LoginBackoffBase           time.Duration
+	PasswordMinLength          int
+	PasswordMaxLength          int
+	BreachedPasswordsPath      string
+	PasswordHashAlgorithm      string
+	Argon2Memory               int
+	Argon2Time                 int
+	Argon2Parallelism          int
+	BcryptCost                 int
+	OIDCProviders              []OIDCProviderConfig
+	OIDCRedirectURL            string
+	AccountDeletionGracePeriod time.Duration
+	DeletedAccountPosts        string
+	DataExportRetention        time.Duration
+	DataExportDownloadTTL      time.Duration
+	ReservedUsernames          []string
+	UsernameChangeCooldown     time.Duration
+	UsernameReservationPeriod  time.Duration
 }
 
 // LoadConfig loads environment variables and returns a Config struct
@@ -30,13 +95,51 @@ func LoadConfig() Config {
 	}
 
 	config := Config{
-		MongoURI:        getEnv("MONGO_URI", "mongodb://localhost:27017/maliaki"),
-		JWTSecret:       getEnv("JWT_SECRET", "your_jwt_secret"),
-		ServerPort:      getEnv("SERVER_PORT", "8080"),
-		RateLimit:       getEnvAsRateLimit("RATE_LIMIT", 10),
-		RateBurst:       getEnvAsInt("RATE_BURST", 20),
-		CORSOrigins:     splitEnv("CORS_ORIGINS", ","),
-		SecurityHeaders: getEnvAsBool("SECURITY_HEADERS", true),
+		MongoURI:                   getEnv("MONGO_URI", "mongodb://localhost:27017/maliaki"),
+		JWTSecret:                  getEnv("JWT_SECRET", "your_jwt_secret"),
+		ServerPort:                 getEnv("SERVER_PORT", "8080"),
+		RateLimit:                  getEnvAsRateLimit("RATE_LIMIT", 10),
+		RateBurst:                  getEnvAsInt("RATE_BURST", 20),
+		CORSOrigins:                splitEnv("CORS_ORIGINS", ","),
+		SecurityHeaders:            getEnvAsBool("SECURITY_HEADERS", true),
+		AccessTokenTTL:             getEnvAsDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:            getEnvAsDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		JWTKeysFile:                getEnv("JWT_KEYS_FILE", ""),
+		JWTKeyGracePeriod:          getEnvAsDuration("JWT_KEY_GRACE_PERIOD", 24*time.Hour),
+		AppBaseURL:                 getEnv("APP_BASE_URL", "http://localhost:4200"),
+		MailDriver:                 getEnv("MAIL_DRIVER", "log"),
+		MailFrom:                   getEnv("MAIL_FROM", "no-reply@localhost"),
+		MailLogFile:                getEnv("MAIL_LOG_FILE", ""),
+		SMTPHost:                   getEnv("SMTP_HOST", "localhost"),
+		SMTPPort:                   getEnvAsInt("SMTP_PORT", 587),
+		SMTPUsername:               getEnv("SMTP_USERNAME", ""),
+		SMTPPassword:               getEnv("SMTP_PASSWORD", ""),
+		PasswordResetTTL:           getEnvAsDuration("PASSWORD_RESET_TTL", time.Hour),
+		EmailVerificationTTL:       getEnvAsDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+		RegistrationMode:           getEnvAsRegistrationMode("REGISTRATION_MODE", RegistrationOpen),
+		AdminUsers:                 splitEnv("ADMIN_USERS", ","),
+		TOTPIssuer:                 getEnv("TOTP_ISSUER", "Social-Experiment"),
+		LoginMaxFailures:           getEnvAsInt("LOGIN_MAX_FAILURES", 5),
+		LoginIPMaxFailures:         getEnvAsInt("LOGIN_IP_MAX_FAILURES", 50),
+		LoginLockoutDuration:       getEnvAsDuration("LOGIN_LOCKOUT_DURATION", 15*time.Minute),
+		LoginBackoffBase:           getEnvAsDuration("LOGIN_BACKOFF_BASE", time.Second),
+		PasswordMinLength:          getEnvAsInt("PASSWORD_MIN_LENGTH", 10),
+		PasswordMaxLength:          getEnvAsInt("PASSWORD_MAX_LENGTH", 72),
+		BreachedPasswordsPath:      getEnv("BREACHED_PASSWORDS_PATH", ""),
+		PasswordHashAlgorithm:      getEnv("PASSWORD_HASH_ALGORITHM", "argon2id"),
+		Argon2Memory:               getEnvAsInt("ARGON2_MEMORY", 64*1024),
+		Argon2Time:                 getEnvAsInt("ARGON2_TIME", 3),
+		Argon2Parallelism:          getEnvAsInt("ARGON2_PARALLELISM", 2),
+		BcryptCost:                 getEnvAsInt("BCRYPT_COST", 12),
+		OIDCProviders:              getEnvAsOIDCProviders("OIDC_PROVIDERS"),
+		OIDCRedirectURL:            getEnv("OIDC_REDIRECT_URL", ""),
+		AccountDeletionGracePeriod: getEnvAsDuration("ACCOUNT_DELETION_GRACE_PERIOD", 14*24*time.Hour),
+		DeletedAccountPosts:        getEnv("DELETED_ACCOUNT_POSTS", DeletedPostsAnonymize),
+		DataExportRetention:        getEnvAsDuration("DATA_EXPORT_RETENTION", 7*24*time.Hour),
+		DataExportDownloadTTL:      getEnvAsDuration("DATA_EXPORT_DOWNLOAD_TTL", 15*time.Minute),
+		ReservedUsernames:          splitEnv("RESERVED_USERNAMES", ","),
+		UsernameChangeCooldown:     getEnvAsDuration("USERNAME_CHANGE_COOLDOWN", 30*24*time.Hour),
+		UsernameReservationPeriod:  getEnvAsDuration("USERNAME_RESERVATION_PERIOD", 90*24*time.Hour),
 	}
 
 	return config
@@ -85,6 +188,57 @@ func getEnvAsRateLimit(name string, defaultVal rate.Limit) rate.Limit {
     return defaultVal
 }
 
+func getEnvAsDuration(name string, defaultVal time.Duration) time.Duration {
+	if valueStr, exists := os.LookupEnv(name); exists {
+		value, err := time.ParseDuration(valueStr)
+		if err != nil {
+			log.Printf("Invalid duration for %s, using default %v", name, defaultVal)
+			return defaultVal
+		}
+		return value
+	}
+	return defaultVal
+}
+
+func getEnvAsRegistrationMode(name string, defaultVal string) string {
+	if value, exists := os.LookupEnv(name); exists {
+		switch value {
+		case RegistrationOpen, RegistrationVerifyEmail, RegistrationInvite, RegistrationClosed:
+			return value
+		}
+		log.Printf("Invalid registration mode for %s, registration is closed", name)
+		return RegistrationClosed
+	}
+	return defaultVal
+}
+
+// getEnvAsOIDCProviders reads the comma-separated provider names in name and
+// each provider's OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET and _SCOPES.
+func getEnvAsOIDCProviders(name string) []OIDCProviderConfig {
+	providers := []OIDCProviderConfig{}
+	for _, providerName := range splitEnv(name, ",") {
+		providerName = strings.ToLower(strings.TrimSpace(providerName))
+		if providerName == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(providerName) + "_"
+		provider := OIDCProviderConfig{
+			Name:         providerName,
+			Issuer:       strings.TrimSuffix(getEnv(prefix+"ISSUER", ""), "/"),
+			ClientID:     getEnv(prefix+"CLIENT_ID", ""),
+			ClientSecret: getEnv(prefix+"CLIENT_SECRET", ""),
+			Scopes:       strings.Fields(getEnv(prefix+"SCOPES", "openid email profile")),
+			TrustEmail:   getEnvAsBool(prefix+"TRUST_EMAIL", false),
+		}
+		if provider.Issuer == "" || provider.ClientID == "" {
+			log.Printf("Missing %sISSUER or %sCLIENT_ID, OIDC provider %s disabled", prefix, prefix, providerName)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
 func splitEnv(name string, sep string) []string {
 	if value, exists := os.LookupEnv(name); exists {
 		parts := strings.Split(value, sep)
@@ -0,0 +1,31 @@
+// utils/confusables.go
+package utils
+
+import "strings"
+
+// confusables maps case-folded characters that are easily mistaken for one
+// another to a common prototype. It is a compact subset of the Unicode
+// confusables data (UTS #39) covering the lookalikes of Latin letters and
+// digits in the scripts usernames may use.
+var confusables = map[rune]rune{
+	// Latin and digits
+	'0': 'o', '1': 'l', 'i': 'l', 'ı': 'l', 'ɩ': 'l', 'ǀ': 'l',
+	'ɑ': 'a', 'ɡ': 'g', 'ʋ': 'u', 'ɜ': 'e',
+
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'ԁ': 'd', 'е': 'e', 'ҽ': 'e', 'һ': 'h', 'і': 'l',
+	'ӏ': 'l', 'ј': 'j', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'ԛ': 'q', 'ѕ': 's', 'т': 't', 'с': 'c', 'у': 'y', 'ү': 'y', 'ԝ': 'w',
+	'х': 'x', 'ь': 'b',
+
+	// Greek
+	'α': 'a', 'β': 'b', 'γ': 'y', 'ε': 'e', 'η': 'n', 'ι': 'l', 'κ': 'k',
+	'ν': 'v', 'ο': 'o', 'ρ': 'p', 'σ': 'o', 'τ': 't', 'υ': 'u', 'χ': 'x',
+	'ω': 'w',
+
+	// Armenian
+	'հ': 'h', 'ո': 'n', 'ս': 'u', 'օ': 'o', 'ց': 'g', 'զ': 'q',
+}
+
+// confusableSequences replaces letter pairs that read as a single letter.
+var confusableSequences = strings.NewReplacer("rn", "m", "vv", "w")
@@ -0,0 +1,728 @@
+// utils/data_export.go
+package utils
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"social-experiment/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Data export statuses
+const (
+	DataExportPending = "pending"
+	DataExportRunning = "running"
+	DataExportReady   = "ready"
+	DataExportFailed  = "failed"
+)
+
+// PurposeDataExport marks a short-lived token that downloads one data export.
+// Such tokens are not access tokens.
+const PurposeDataExport = "data_export"
+
+// dataExportLease is how long building an export may take before another
+// instance starts over.
+const dataExportLease = 30 * time.Minute
+
+// ErrDataExportNotFound is returned for unknown, unfinished or expired exports
+// and for invalid download tokens.
+var ErrDataExportNotFound = errors.New("data export not found")
+
+// activityStreamsPublic addresses an activity to everyone.
+const activityStreamsPublic = "https://www.w3.org/ns/activitystreams#Public"
+
+const dataExportReadme = `This archive contains the data stored about your account.
+
+profile.json                  Your account and linked sign-in providers
+posts.json                    Your posts
+post_revisions.json           Earlier versions of the posts you edited
+reactions.json                Your reactions to posts
+notifications.json            Notifications you received
+outbox.json                   Your posts as an ActivityStreams 2.0 collection
+sessions.json                 Devices you signed in on, including ended sessions
+personal_access_tokens.json   Your personal access tokens (without the tokens)
+authorized_apps.json          Applications you authorized to use your account
+oauth_clients.json            Applications you registered (without their secrets)
+audit_log.json                Security events recorded for your account
+
+Passwords, two-factor secrets and recovery codes are only stored as hashes
+or encrypted and are not included.
+`
+
+// DataExporter builds ZIP archives of everything stored about a user. Archives
+// are streamed into GridFS one document at a time, so the size of an account
+// does not affect memory use, and are deleted once they expire.
+type DataExporter struct {
+	exports        *mongo.Collection
+	files          *gridfs.Bucket
+	users          *mongo.Collection
+	posts          *mongo.Collection
+	postRevisions  *mongo.Collection
+	reactions      *mongo.Collection
+	notifications  *mongo.Collection
+	sessions       *SessionStore
+	personalTokens *PersonalAccessTokenStore
+	oauth          *OAuthServer
+	audit          *AuditLog
+	keys           *KeyRing
+	revocations    *RevocationList
+	baseURL        string
+	retention      time.Duration
+	downloadTTL    time.Duration
+	wake           chan struct{}
+}
+
+// NewDataExporter initializes a new DataExporter that keeps its jobs in exports
+// and its archives in files.
+func NewDataExporter(config Config, keys *KeyRing, revocations *RevocationList, exports *mongo.Collection, files *gridfs.Bucket, users, posts, postRevisions, reactions, notifications *mongo.Collection, sessions *SessionStore, personalTokens *PersonalAccessTokenStore, oauth *OAuthServer, audit *AuditLog) *DataExporter {
+	return &DataExporter{
+		exports:        exports,
+		files:          files,
+		users:          users,
+		posts:          posts,
+		postRevisions:  postRevisions,
+		reactions:      reactions,
+		notifications:  notifications,
+		sessions:       sessions,
+		personalTokens: personalTokens,
+		oauth:          oauth,
+		audit:          audit,
+		keys:           keys,
+		revocations:    revocations,
+		baseURL:        strings.TrimSuffix(config.AppBaseURL, "/"),
+		retention:      config.DataExportRetention,
+		downloadTTL:    config.DataExportDownloadTTL,
+		wake:           make(chan struct{}, 1),
+	}
+}
+
+// EnsureIndexes creates the indexes used to list, claim and expire exports.
+func (e *DataExporter) EnsureIndexes(ctx context.Context) error {
+	_, err := e.exports.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetSparse(true)},
+	})
+	return err
+}
+
+// Request queues an export of the user's data, unless one is already queued or
+// being built, in which case that one is returned. It reports whether a new
+// export was queued.
+func (e *DataExporter) Request(ctx context.Context, userID primitive.ObjectID) (*models.DataExport, bool, error) {
+	var export models.DataExport
+	err := e.exports.FindOne(ctx, bson.M{
+		"user_id": userID,
+		"status":  bson.M{"$in": []string{DataExportPending, DataExportRunning}},
+	}).Decode(&export)
+	if err == nil {
+		return &export, false, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return nil, false, err
+	}
+
+	export = models.DataExport{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Status:    DataExportPending,
+		CreatedAt: time.Now(),
+	}
+	if _, err := e.exports.InsertOne(ctx, export); err != nil {
+		return nil, false, err
+	}
+
+	// Start building right away instead of waiting for the next tick
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+	return &export, true, nil
+}
+
+// List returns the user's exports that have not expired, newest first.
+func (e *DataExporter) List(ctx context.Context, userID primitive.ObjectID) ([]models.DataExport, error) {
+	cursor, err := e.exports.Find(ctx,
+		bson.M{"user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	exports := []models.DataExport{}
+	for cursor.Next(ctx) {
+		var export models.DataExport
+		if err := cursor.Decode(&export); err != nil {
+			return nil, err
+		}
+		if !dataExportExpired(&export, time.Now()) {
+			exports = append(exports, export)
+		}
+	}
+	return exports, cursor.Err()
+}
+
+// Get returns one of the user's exports, or ErrDataExportNotFound.
+func (e *DataExporter) Get(ctx context.Context, userID, exportID primitive.ObjectID) (*models.DataExport, error) {
+	var export models.DataExport
+	err := e.exports.FindOne(ctx, bson.M{"_id": exportID, "user_id": userID}).Decode(&export)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrDataExportNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dataExportExpired(&export, time.Now()) {
+		return nil, ErrDataExportNotFound
+	}
+	return &export, nil
+}
+
+// DownloadURL returns a link, relative to the API, that downloads a ready export
+// without further authentication, and when it stops working. Links are valid
+// for the download TTL but never beyond the export's expiry.
+func (e *DataExporter) DownloadURL(export *models.DataExport) (string, time.Time, error) {
+	if export.Status != DataExportReady || export.ExpiresAt == nil {
+		return "", time.Time{}, ErrDataExportNotFound
+	}
+
+	ttl := e.downloadTTL
+	if remaining := time.Until(*export.ExpiresAt); remaining < ttl {
+		ttl = remaining
+	}
+	claims := &Claims{UserID: export.UserID.Hex(), Purpose: PurposeDataExport}
+	claims.Subject = export.ID.Hex()
+	token, err := generateJWT(claims, e.keys, ttl)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	link := "/me/export/" + export.ID.Hex() + "/download?token=" + url.QueryEscape(token)
+	return link, time.Unix(claims.ExpiresAt, 0), nil
+}
+
+// OpenDownload checks a download token for the export and opens its archive.
+// Tokens stop working when the user signs out everywhere.
+func (e *DataExporter) OpenDownload(ctx context.Context, exportID, token string) (*gridfs.DownloadStream, error) {
+	claims, err := ValidateJWT(token, e.keys)
+	if err != nil || claims.Purpose != PurposeDataExport || claims.Subject != exportID {
+		return nil, ErrDataExportNotFound
+	}
+	revoked, err := e.revocations.IsRevoked(ctx, claims)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrDataExportNotFound
+	}
+
+	id, err := primitive.ObjectIDFromHex(exportID)
+	if err != nil {
+		return nil, ErrDataExportNotFound
+	}
+	userID, err := primitive.ObjectIDFromHex(claims.UserID)
+	if err != nil {
+		return nil, ErrDataExportNotFound
+	}
+	export, err := e.Get(ctx, userID, id)
+	if err != nil {
+		return nil, err
+	}
+	if export.Status != DataExportReady || export.FileID == nil {
+		return nil, ErrDataExportNotFound
+	}
+
+	file, err := e.files.OpenDownloadStream(*export.FileID)
+	if err == gridfs.ErrFileNotFound {
+		return nil, ErrDataExportNotFound
+	}
+	return file, err
+}
+
+// Run builds queued exports and deletes expired ones every interval, and as
+// soon as an export is requested, until the context is cancelled.
+func (e *DataExporter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := e.BuildPending(ctx); err != nil {
+			log.Printf("[ERROR] Error building data exports: %v", err)
+		}
+		if err := e.DeleteExpired(ctx); err != nil {
+			log.Printf("[ERROR] Error deleting expired data exports: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-e.wake:
+		}
+	}
+}
+
+// BuildPending builds every queued export, as well as exports whose build was
+// abandoned, and returns how many were built.
+func (e *DataExporter) BuildPending(ctx context.Context) (int, error) {
+	built := 0
+	for {
+		now := time.Now()
+		fileID := primitive.NewObjectID()
+
+		// Claim one export at a time so concurrent instances share the work.
+		// The previous document tells which partial archive to clean up.
+		var export models.DataExport
+		err := e.exports.FindOneAndUpdate(ctx,
+			bson.M{"$or": []bson.M{
+				{"status": DataExportPending},
+				{"status": DataExportRunning, "started_at": bson.M{"$lt": now.Add(-dataExportLease)}},
+			}},
+			bson.M{"$set": bson.M{"status": DataExportRunning, "started_at": now, "file_id": fileID}},
+			options.FindOneAndUpdate().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+		).Decode(&export)
+		if err == mongo.ErrNoDocuments {
+			return built, nil
+		}
+		if err != nil {
+			return built, err
+		}
+		if export.FileID != nil {
+			e.deleteFile(ctx, *export.FileID)
+		}
+
+		if err := e.build(ctx, &export, fileID); err != nil {
+			log.Printf("[ERROR] Error building data export %s: %v", export.ID.Hex(), err)
+			continue
+		}
+		built++
+	}
+}
+
+// build writes the archive of the claimed export and marks it ready, or failed.
+func (e *DataExporter) build(ctx context.Context, export *models.DataExport, fileID primitive.ObjectID) error {
+	size, buildErr := e.writeArchive(ctx, export, fileID)
+
+	now := time.Now()
+	expiresAt := now.Add(e.retention)
+	update := bson.M{"status": DataExportReady, "size": size, "completed_at": now, "expires_at": expiresAt}
+	if buildErr != nil {
+		update = bson.M{"status": DataExportFailed, "completed_at": now, "expires_at": expiresAt}
+	}
+
+	// Only finish the export if it was not taken over or deleted meanwhile
+	result, err := e.exports.UpdateOne(ctx,
+		bson.M{"_id": export.ID, "status": DataExportRunning, "file_id": fileID},
+		bson.M{"$set": update},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		e.deleteFile(ctx, fileID)
+		return nil
+	}
+	if buildErr != nil {
+		return buildErr
+	}
+
+	log.Printf("[INFO] Built data export %s (UserID: %s, %d bytes)", export.ID.Hex(), export.UserID.Hex(), size)
+	return nil
+}
+
+// writeArchive streams the ZIP archive into GridFS under fileID and returns its size.
+func (e *DataExporter) writeArchive(ctx context.Context, export *models.DataExport, fileID primitive.ObjectID) (int64, error) {
+	var user models.User
+	if err := e.users.FindOne(ctx, bson.M{"_id": export.UserID}).Decode(&user); err != nil {
+		return 0, err
+	}
+
+	upload, err := e.files.OpenUploadStreamWithID(fileID, "export-"+export.ID.Hex()+".zip")
+	if err != nil {
+		return 0, err
+	}
+	out := &countingWriter{w: upload}
+	archive := zip.NewWriter(out)
+
+	entries := []struct {
+		name  string
+		write func(io.Writer) error
+	}{
+		{"README.txt", func(w io.Writer) error {
+			_, err := io.WriteString(w, dataExportReadme)
+			return err
+		}},
+		{"profile.json", func(w io.Writer) error { return writeJSON(w, user) }},
+		{"posts.json", func(w io.Writer) error { return e.writePosts(ctx, w, &user) }},
+		{"post_revisions.json", func(w io.Writer) error { return e.writePostRevisions(ctx, w, &user) }},
+		{"reactions.json", func(w io.Writer) error { return e.writeReactions(ctx, w, &user) }},
+		{"notifications.json", func(w io.Writer) error { return e.writeNotifications(ctx, w, &user) }},
+		{"outbox.json", func(w io.Writer) error { return e.writeOutbox(ctx, w, &user) }},
+		{"sessions.json", func(w io.Writer) error { return e.writeSessions(ctx, w, &user) }},
+		{"personal_access_tokens.json", func(w io.Writer) error { return e.writePersonalTokens(ctx, w, &user) }},
+		{"authorized_apps.json", func(w io.Writer) error {
+			grants, err := e.oauth.ListGrants(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+			return writeJSON(w, grants)
+		}},
+		{"oauth_clients.json", func(w io.Writer) error {
+			clients, err := e.oauth.ListClients(ctx, user.ID)
+			if err != nil {
+				return err
+			}
+			return writeJSON(w, clients)
+		}},
+		{"audit_log.json", func(w io.Writer) error { return e.writeAuditLog(ctx, w, &user) }},
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		w, err := archive.CreateHeader(&zip.FileHeader{Name: entry.name, Method: zip.Deflate, Modified: now})
+		if err == nil {
+			err = entry.write(w)
+		}
+		if err != nil {
+			upload.Abort()
+			return 0, fmt.Errorf("writing %s: %w", entry.name, err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		upload.Abort()
+		return 0, err
+	}
+	if err := upload.Close(); err != nil {
+		return 0, err
+	}
+	return out.n, nil
+}
+
+func (e *DataExporter) writePosts(ctx context.Context, w io.Writer, user *models.User) error {
+	cursor, err := e.posts.Find(ctx,
+		bson.M{"user_id": user.ID, "deleted_at": nil},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return err
+	}
+	return writeJSONArray(ctx, w, cursor, func(cursor *mongo.Cursor) (interface{}, error) {
+		var post models.Post
+		err := cursor.Decode(&post)
+		return post, err
+	})
+}
+
+// writePostRevisions writes the earlier versions of the user's posts, naming
+// the post each belongs to.
+func (e *DataExporter) writePostRevisions(ctx context.Context, w io.Writer, user *models.User) error {
+	postIDs, err := e.posts.Distinct(ctx, "_id", bson.M{"user_id": user.ID})
+	if err != nil {
+		return err
+	}
+	if postIDs == nil {
+		postIDs = []interface{}{}
+	}
+	cursor, err := e.postRevisions.Find(ctx,
+		bson.M{"post_id": bson.M{"$in": postIDs}},
+		options.Find().SetSort(bson.D{{Key: "post_id", Value: 1}, {Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return err
+	}
+	return writeJSONArray(ctx, w, cursor, func(cursor *mongo.Cursor) (interface{}, error) {
+		var revision models.PostRevision
+		if err := cursor.Decode(&revision); err != nil {
+			return nil, err
+		}
+		return struct {
+			models.PostRevision
+			PostID primitive.ObjectID `json:"post_id"`
+		}{revision, revision.PostID}, nil
+	})
+}
+
+// writeReactions writes the user's reactions, naming the post each is on.
+func (e *DataExporter) writeReactions(ctx context.Context, w io.Writer, user *models.User) error {
+	cursor, err := e.reactions.Find(ctx,
+		bson.M{"user_id": user.ID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return err
+	}
+	return writeJSONArray(ctx, w, cursor, func(cursor *mongo.Cursor) (interface{}, error) {
+		var reaction models.Reaction
+		if err := cursor.Decode(&reaction); err != nil {
+			return nil, err
+		}
+		return struct {
+			models.Reaction
+			PostID primitive.ObjectID `json:"post_id"`
+		}{reaction, reaction.PostID}, nil
+	})
+}
+
+// writeNotifications writes the notifications the user received, naming the
+// user whose action each is about.
+func (e *DataExporter) writeNotifications(ctx context.Context, w io.Writer, user *models.User) error {
+	cursor, err := e.notifications.Find(ctx,
+		bson.M{"user_id": user.ID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return err
+	}
+	return writeJSONArray(ctx, w, cursor, func(cursor *mongo.Cursor) (interface{}, error) {
+		var notification models.Notification
+		if err := cursor.Decode(&notification); err != nil {
+			return nil, err
+		}
+		return struct {
+			models.Notification
+			ActorID primitive.ObjectID `json:"actor_id"`
+		}{notification, notification.ActorID}, nil
+	})
+}
+
+// writeOutbox writes the user's posts as the ActivityStreams 2.0 outbox of
+// Create activities, and Announce activities for reposts, a federated server
+// would publish.
+func (e *DataExporter) writeOutbox(ctx context.Context, w io.Writer, user *models.User) error {
+	filter := bson.M{"user_id": user.ID, "deleted_at": nil}
+	total, err := e.posts.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	cursor, err := e.posts.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return err
+	}
+
+	actor := e.baseURL + "/users/" + url.PathEscape(user.Username)
+	header, err := json.MarshalIndent(map[string]interface{}{
+		"@context":   "https://www.w3.org/ns/activitystreams",
+		"id":         actor + "/outbox",
+		"type":       "OrderedCollection",
+		"totalItems": total,
+	}, "", "  ")
+	if err != nil {
+		cursor.Close(ctx)
+		return err
+	}
+
+	// Leave the collection open to stream its items into it
+	header = append(header[:len(header)-2], []byte(",\n  \"orderedItems\": ")...)
+	if _, err := w.Write(header); err != nil {
+		cursor.Close(ctx)
+		return err
+	}
+	err = writeJSONArray(ctx, w, cursor, func(cursor *mongo.Cursor) (interface{}, error) {
+		var post models.Post
+		if err := cursor.Decode(&post); err != nil {
+			return nil, err
+		}
+		note := e.baseURL + "/posts/" + post.ID.Hex()
+		published := post.CreatedAt.UTC().Format(time.RFC3339)
+		if post.RepostOf != nil {
+			return map[string]interface{}{
+				"id":        note + "/activity",
+				"type":      "Announce",
+				"actor":     actor,
+				"published": published,
+				"to":        []string{activityStreamsPublic},
+				"object":    e.baseURL + "/posts/" + post.RepostOf.Hex(),
+			}, nil
+		}
+		return map[string]interface{}{
+			"id":        note + "/activity",
+			"type":      "Create",
+			"actor":     actor,
+			"published": published,
+			"to":        []string{activityStreamsPublic},
+			"object": map[string]interface{}{
+				"id":           note,
+				"type":         "Note",
+				"attributedTo": actor,
+				"content":      post.Content,
+				"published":    published,
+				"to":           []string{activityStreamsPublic},
+			},
+		}, nil
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "}\n")
+	return err
+}
+
+func (e *DataExporter) writeSessions(ctx context.Context, w io.Writer, user *models.User) error {
+	cursor, err := e.sessions.coll.Find(ctx,
+		bson.M{"user_id": user.ID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return err
+	}
+	return writeJSONArray(ctx, w, cursor, func(cursor *mongo.Cursor) (interface{}, error) {
+		var session models.Session
+		if err := cursor.Decode(&session); err != nil {
+			return nil, err
+		}
+		return struct {
+			models.Session
+			RevokedAt *time.Time `json:"revoked_at,omitempty"`
+		}{session, session.RevokedAt}, nil
+	})
+}
+
+func (e *DataExporter) writePersonalTokens(ctx context.Context, w io.Writer, user *models.User) error {
+	cursor, err := e.personalTokens.coll.Find(ctx,
+		bson.M{"user_id": user.ID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return err
+	}
+	return writeJSONArray(ctx, w, cursor, func(cursor *mongo.Cursor) (interface{}, error) {
+		var token models.PersonalAccessToken
+		if err := cursor.Decode(&token); err != nil {
+			return nil, err
+		}
+		return struct {
+			models.PersonalAccessToken
+			RevokedAt *time.Time `json:"revoked_at,omitempty"`
+		}{token, token.RevokedAt}, nil
+	})
+}
+
+func (e *DataExporter) writeAuditLog(ctx context.Context, w io.Writer, user *models.User) error {
+	cursor, err := e.audit.coll.Find(ctx,
+		bson.M{"user_id": user.ID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}),
+	)
+	if err != nil {
+		return err
+	}
+	return writeJSONArray(ctx, w, cursor, func(cursor *mongo.Cursor) (interface{}, error) {
+		var event models.AuditEvent
+		err := cursor.Decode(&event)
+		return event, err
+	})
+}
+
+// DeleteExpired deletes the exports whose retention period has passed, along
+// with their archives.
+func (e *DataExporter) DeleteExpired(ctx context.Context) error {
+	return e.deleteExports(ctx, bson.M{"expires_at": bson.M{"$lte": time.Now()}})
+}
+
+// DeleteUser deletes all of the user's exports and their archives.
+func (e *DataExporter) DeleteUser(ctx context.Context, userID primitive.ObjectID) error {
+	return e.deleteExports(ctx, bson.M{"user_id": userID})
+}
+
+func (e *DataExporter) deleteExports(ctx context.Context, filter bson.M) error {
+	cursor, err := e.exports.Find(ctx, filter, options.Find().SetProjection(bson.M{"file_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var export models.DataExport
+		if err := cursor.Decode(&export); err != nil {
+			return err
+		}
+		if export.FileID != nil {
+			if err := e.files.DeleteContext(ctx, *export.FileID); err != nil && err != gridfs.ErrFileNotFound {
+				return err
+			}
+		}
+		if _, err := e.exports.DeleteOne(ctx, bson.M{"_id": export.ID}); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+// deleteFile deletes an archive that is no longer referenced.
+func (e *DataExporter) deleteFile(ctx context.Context, fileID primitive.ObjectID) {
+	if err := e.files.DeleteContext(ctx, fileID); err != nil && err != gridfs.ErrFileNotFound {
+		log.Printf("[ERROR] Error deleting data export archive %s: %v", fileID.Hex(), err)
+	}
+}
+
+func dataExportExpired(export *models.DataExport, now time.Time) bool {
+	return export.ExpiresAt != nil && !export.ExpiresAt.After(now)
+}
+
+// writeJSON writes v to w as indented JSON.
+func writeJSON(w io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// writeJSONArray writes the documents of the cursor to w as a JSON array,
+// decoding and encoding one document at a time. It closes the cursor.
+func writeJSONArray(ctx context.Context, w io.Writer, cursor *mongo.Cursor, decode func(*mongo.Cursor) (interface{}, error)) error {
+	defer cursor.Close(ctx)
+
+	if _, err := io.WriteString(w, "["); err != nil {
+		return err
+	}
+	separator := "\n  "
+	for cursor.Next(ctx) {
+		item, err := decode(cursor)
+		if err != nil {
+			return err
+		}
+		data, err := json.MarshalIndent(item, "  ", "  ")
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, separator); err != nil {
+			return err
+		}
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		separator = ",\n  "
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n]\n")
+	return err
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
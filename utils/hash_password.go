@@ -1,18 +1,230 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+    "crypto/rand"
+    "crypto/subtle"
+    "encoding/base64"
+    "errors"
+    "fmt"
+    "strings"
+    "sync"
 
-// HashPassword hashes a given password using bcrypt
-func HashPassword(password string) (string, error) {
-    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+    "golang.org/x/crypto/argon2"
+    "golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnknownHashFormat is returned for stored hashes no configured scheme understands.
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// PasswordScheme is a password hashing algorithm producing self-describing
+// PHC-style strings.
+type PasswordScheme interface {
+    // Name is the algorithm identifier used in configuration.
+    Name() string
+    // Hash hashes the password with the scheme's current parameters.
+    Hash(password string) (string, error)
+    // Recognizes reports whether the encoded hash was produced by this scheme.
+    Recognizes(encoded string) bool
+    // Verify compares the password with an encoded hash of this scheme.
+    Verify(password, encoded string) (bool, error)
+    // NeedsRehash reports whether the encoded hash uses weaker parameters than
+    // the scheme is currently configured with.
+    NeedsRehash(encoded string) bool
+}
+
+// PasswordHasher hashes new passwords with the preferred scheme and verifies
+// hashes of every known scheme, flagging outdated ones for rehashing.
+type PasswordHasher struct {
+    preferred PasswordScheme
+    schemes   []PasswordScheme
+
+    dummyOnce sync.Once
+    dummyHash string
+}
+
+// NewPasswordHasher builds the hasher from configuration.
+func NewPasswordHasher(config Config) (*PasswordHasher, error) {
+    argon := &Argon2idScheme{
+        Memory:      uint32(config.Argon2Memory),
+        Time:        uint32(config.Argon2Time),
+        Parallelism: uint8(config.Argon2Parallelism),
+        SaltLength:  16,
+        KeyLength:   32,
+    }
+    bc := &BcryptScheme{Cost: config.BcryptCost}
+
+    if argon.Memory < 8*uint32(argon.Parallelism) || argon.Time < 1 || argon.Parallelism < 1 {
+        return nil, fmt.Errorf("invalid argon2id parameters m=%d t=%d p=%d", argon.Memory, argon.Time, argon.Parallelism)
+    }
+    if bc.Cost < bcrypt.MinCost || bc.Cost > bcrypt.MaxCost {
+        return nil, fmt.Errorf("invalid bcrypt cost %d", bc.Cost)
+    }
+
+    h := &PasswordHasher{schemes: []PasswordScheme{argon, bc}}
+    for _, scheme := range h.schemes {
+        if scheme.Name() == config.PasswordHashAlgorithm {
+            h.preferred = scheme
+        }
+    }
+    if h.preferred == nil {
+        return nil, fmt.Errorf("unsupported password hash algorithm %q", config.PasswordHashAlgorithm)
+    }
+    return h, nil
+}
+
+// Hash hashes a password with the preferred scheme.
+func (h *PasswordHasher) Hash(password string) (string, error) {
+    return h.preferred.Hash(password)
+}
+
+// Verify checks a password against a stored hash. needsRehash is true when the
+// password matched but the hash should be replaced with a fresh Hash result.
+func (h *PasswordHasher) Verify(password, encoded string) (ok bool, needsRehash bool, err error) {
+    for _, scheme := range h.schemes {
+        if !scheme.Recognizes(encoded) {
+            continue
+        }
+        ok, err := scheme.Verify(password, encoded)
+        if err != nil || !ok {
+            return false, false, err
+        }
+        return true, scheme != h.preferred || scheme.NeedsRehash(encoded), nil
+    }
+    return false, false, ErrUnknownHashFormat
+}
+
+// DummyVerify performs a password comparison against a throwaway hash so
+// that a login for a non-existent user takes as long as one with a wrong password.
+func (h *PasswordHasher) DummyVerify(password string) {
+    h.dummyOnce.Do(func() {
+        h.dummyHash, _ = h.preferred.Hash("dummy-password")
+    })
+    h.preferred.Verify(password, h.dummyHash)
+}
+
+// Argon2idScheme hashes passwords with argon2id, encoded as
+// $argon2id$v=19$m=<KiB>,t=<passes>,p=<lanes>$<salt>$<hash>.
+type Argon2idScheme struct {
+    Memory      uint32
+    Time        uint32
+    Parallelism uint8
+    SaltLength  int
+    KeyLength   uint32
+}
+
+type argon2Hash struct {
+    memory      uint32
+    time        uint32
+    parallelism uint8
+    salt        []byte
+    key         []byte
+}
+
+// Name implements PasswordScheme.
+func (s *Argon2idScheme) Name() string {
+    return "argon2id"
+}
+
+// Hash implements PasswordScheme.
+func (s *Argon2idScheme) Hash(password string) (string, error) {
+    salt := make([]byte, s.SaltLength)
+    if _, err := rand.Read(salt); err != nil {
+        return "", err
+    }
+    key := argon2.IDKey([]byte(password), salt, s.Time, s.Memory, s.Parallelism, s.KeyLength)
+    return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+        argon2.Version, s.Memory, s.Time, s.Parallelism,
+        base64.RawStdEncoding.EncodeToString(salt),
+        base64.RawStdEncoding.EncodeToString(key),
+    ), nil
+}
+
+// Recognizes implements PasswordScheme.
+func (s *Argon2idScheme) Recognizes(encoded string) bool {
+    return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+// Verify implements PasswordScheme.
+func (s *Argon2idScheme) Verify(password, encoded string) (bool, error) {
+    parsed, err := parseArgon2Hash(encoded)
+    if err != nil {
+        return false, err
+    }
+    key := argon2.IDKey([]byte(password), parsed.salt, parsed.time, parsed.memory, parsed.parallelism, uint32(len(parsed.key)))
+    return subtle.ConstantTimeCompare(key, parsed.key) == 1, nil
+}
+
+// NeedsRehash implements PasswordScheme.
+func (s *Argon2idScheme) NeedsRehash(encoded string) bool {
+    parsed, err := parseArgon2Hash(encoded)
+    if err != nil {
+        return true
+    }
+    return parsed.memory < s.Memory || parsed.time < s.Time || parsed.parallelism < s.Parallelism ||
+        len(parsed.salt) < s.SaltLength || uint32(len(parsed.key)) < s.KeyLength
+}
+
+func parseArgon2Hash(encoded string) (*argon2Hash, error) {
+    parts := strings.Split(encoded, "$")
+    if len(parts) != 6 || parts[1] != "argon2id" {
+        return nil, ErrUnknownHashFormat
+    }
+
+    var version int
+    if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+        return nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+    }
+
+    parsed := &argon2Hash{}
+    if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &parsed.memory, &parsed.time, &parsed.parallelism); err != nil {
+        return nil, fmt.Errorf("parsing argon2 parameters: %w", err)
+    }
+
+    var err error
+    if parsed.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+        return nil, fmt.Errorf("decoding argon2 salt: %w", err)
+    }
+    if parsed.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+        return nil, fmt.Errorf("decoding argon2 hash: %w", err)
+    }
+    return parsed, nil
+}
+
+// BcryptScheme hashes passwords with bcrypt in its standard $2a$/$2b$ format.
+type BcryptScheme struct {
+    Cost int
+}
+
+// Name implements PasswordScheme.
+func (s *BcryptScheme) Name() string {
+    return "bcrypt"
+}
+
+// Hash implements PasswordScheme.
+func (s *BcryptScheme) Hash(password string) (string, error) {
+    hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), s.Cost)
     if err != nil {
         return "", err
     }
     return string(hashedPassword), nil
 }
 
-// CheckPasswordHash compares a hashed password with its plaintext version
-func CheckPasswordHash(password, hash string) bool {
-    err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-    return err == nil
+// Recognizes implements PasswordScheme.
+func (s *BcryptScheme) Recognizes(encoded string) bool {
+    return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+// Verify implements PasswordScheme.
+func (s *BcryptScheme) Verify(password, encoded string) (bool, error) {
+    err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+    if err == bcrypt.ErrMismatchedHashAndPassword {
+        return false, nil
+    }
+    return err == nil, err
+}
+
+// NeedsRehash implements PasswordScheme.
+func (s *BcryptScheme) NeedsRehash(encoded string) bool {
+    cost, err := bcrypt.Cost([]byte(encoded))
+    return err != nil || cost < s.Cost
 }
@@ -2,52 +2,113 @@
 package utils
 
 import (
+    "crypto/rand"
+    "encoding/hex"
     "fmt"
+    "strings"
     "time"
 
     "github.com/dgrijalva/jwt-go"
 )
 
+// PurposeTwoFactor marks a short-lived token proving the password step of a
+// two-factor login. Such tokens are not access tokens.
+const PurposeTwoFactor = "2fa"
+
+// Claims are the JWT claims issued by this service. Every token carries a
+// unique ID in the standard `jti` claim (StandardClaims.Id) so it can be revoked.
+// Access tokens have an empty Purpose and carry the session they belong to and
+// the user's roles. Scope is a space-separated list of scopes for tokens acting
+// on a user's behalf with restricted rights; it is empty for interactive sessions.
+// Tokens issued to OAuth clients name the client and use their grant as session.
+// IssuedAtMs repeats the standard `iat` claim in milliseconds, so that a token
+// issued right after a revocation is not mistaken for one issued before it.
+// PersonalTokenID is set on claims describing a personal access token and is
+// never part of a JWT.
 type Claims struct {
-    UserID string `json:"user_id"`
+    UserID          string   `json:"user_id"`
+    SessionID       string   `json:"sid,omitempty"`
+    ClientID        string   `json:"client_id,omitempty"`
+    Roles           []string `json:"roles,omitempty"`
+    Scope           string   `json:"scope,omitempty"`
+    Purpose         string   `json:"purpose,omitempty"`
+    IssuedAtMs      int64    `json:"iat_ms,omitempty"`
+    PersonalTokenID string   `json:"-"`
     jwt.StandardClaims
 }
 
-// GenerateJWT generates a JWT token for authenticated users.
-func GenerateJWT(userID string, secret string) (string, error) {
-    expirationTime := time.Now().Add(24 * time.Hour)
-    claims := &Claims{
-        UserID: userID,
-        StandardClaims: jwt.StandardClaims{
-            ExpiresAt: expirationTime.Unix(),
-            IssuedAt:  time.Now().Unix(),
-            Issuer:    "maliaki-backend",
-        },
+// IssuedTime returns when the token was issued, to the millisecond if known.
+// Tokens issued before IssuedAtMs existed only carry whole seconds.
+func (c *Claims) IssuedTime() time.Time {
+    if c.IssuedAtMs != 0 {
+        return time.UnixMilli(c.IssuedAtMs)
     }
+    return time.Unix(c.IssuedAt, 0)
+}
 
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    return token.SignedString([]byte(secret))
+// GenerateJWT generates a JWT access token for authenticated users that expires after ttl,
+// signed with the keyring's current signing key.
+func GenerateJWT(userID string, sessionID string, roles []string, keys *KeyRing, ttl time.Duration) (string, error) {
+    return generateJWT(&Claims{UserID: userID, SessionID: sessionID, Roles: roles}, keys, ttl)
 }
 
-// ValidateJWT validates a JWT token and returns the user ID.
-func ValidateJWT(tokenStr string, secret string) (string, error) {
-    claims := &Claims{}
+// GenerateOAuthJWT generates a scoped access token for an OAuth client acting
+// under the given grant.
+func GenerateOAuthJWT(userID string, grantID string, clientID string, scopes []string, keys *KeyRing, ttl time.Duration) (string, error) {
+    return generateJWT(&Claims{UserID: userID, SessionID: grantID, ClientID: clientID, Scope: strings.Join(scopes, " ")}, keys, ttl)
+}
 
-    token, err := jwt.ParseWithClaims(tokenStr, claims, func(token *jwt.Token) (interface{}, error) {
-        // Ensure the token method is HMAC
-        if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-            return nil, fmt.Errorf("unexpected signing method")
-        }
-        return []byte(secret), nil
-    })
+// GenerateChallengeJWT generates a token that only proves the password step of a
+// two-factor login and cannot be used as an access token.
+func GenerateChallengeJWT(userID string, keys *KeyRing, ttl time.Duration) (string, error) {
+    return generateJWT(&Claims{UserID: userID, Purpose: PurposeTwoFactor}, keys, ttl)
+}
 
+// generateJWT fills in the standard claims and signs the token.
+func generateJWT(claims *Claims, keys *KeyRing, ttl time.Duration) (string, error) {
+    tokenID, err := newTokenID()
     if err != nil {
         return "", err
     }
 
+    now := time.Now()
+    claims.IssuedAtMs = now.UnixMilli()
+    claims.StandardClaims = jwt.StandardClaims{
+        Id:        tokenID,
+        ExpiresAt: now.Add(ttl).Unix(),
+        IssuedAt:  now.Unix(),
+        Issuer:    "maliaki-backend",
+    }
+
+    return keys.Sign(claims)
+}
+
+// ValidateJWT validates a JWT token against the keyring and returns its claims.
+func ValidateJWT(tokenStr string, keys *KeyRing) (*Claims, error) {
+    claims := &Claims{}
+
+    token, err := jwt.ParseWithClaims(tokenStr, claims, keys.Keyfunc)
+
+    if err != nil {
+        return nil, err
+    }
+
     if !token.Valid {
-        return "", fmt.Errorf("invalid token")
+        return nil, fmt.Errorf("invalid token")
+    }
+
+    if claims.Id == "" {
+        return nil, fmt.Errorf("token has no jti claim")
     }
 
-    return claims.UserID, nil
+    return claims, nil
+}
+
+// newTokenID returns a random identifier for the jti claim.
+func newTokenID() (string, error) {
+    b := make([]byte, 16)
+    if _, err := rand.Read(b); err != nil {
+        return "", err
+    }
+    return hex.EncodeToString(b), nil
 }
@@ -0,0 +1,288 @@
+// utils/keyring.go
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// DefaultKeyID identifies the HS256 key derived from JWT_SECRET. Tokens without a
+// `kid` header (issued before key rotation existed) are verified against it.
+const DefaultKeyID = "default"
+
+// SigningKey is a single JWT key in the keyring.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	RetiredAt time.Time
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeyRing holds every key that may verify tokens and the one key used to sign new ones.
+type KeyRing struct {
+	keys    map[string]*SigningKey
+	current *SigningKey
+	grace   time.Duration
+}
+
+// keyRingFile is the on-disk format of JWT_KEYS_FILE.
+type keyRingFile struct {
+	SigningKey string `json:"signing_key"`
+	Keys       []struct {
+		ID             string     `json:"kid"`
+		Algorithm      string     `json:"alg"`
+		PrivateKeyFile string     `json:"private_key_file"`
+		PublicKeyFile  string     `json:"public_key_file"`
+		SecretEnv      string     `json:"secret_env"`
+		RetiredAt      *time.Time `json:"retired_at"`
+	} `json:"keys"`
+}
+
+// LoadKeyRing builds the keyring from configuration. Without a keys file a
+// single HS256 key derived from JWT_SECRET is used.
+func LoadKeyRing(config Config) (*KeyRing, error) {
+	kr := &KeyRing{keys: make(map[string]*SigningKey), grace: config.JWTKeyGracePeriod}
+
+	if config.JWTKeysFile == "" {
+		key := &SigningKey{
+			ID:        DefaultKeyID,
+			Algorithm: jwt.SigningMethodHS256.Alg(),
+			method:    jwt.SigningMethodHS256,
+			signKey:   []byte(config.JWTSecret),
+			verifyKey: []byte(config.JWTSecret),
+		}
+		kr.keys[key.ID] = key
+		kr.current = key
+		return kr, nil
+	}
+
+	data, err := os.ReadFile(config.JWTKeysFile)
+	if err != nil {
+		return nil, fmt.Errorf("reading keys file: %w", err)
+	}
+	var file keyRingFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing keys file: %w", err)
+	}
+
+	for _, entry := range file.Keys {
+		if entry.ID == "" {
+			return nil, fmt.Errorf("key without kid in keys file")
+		}
+		if _, exists := kr.keys[entry.ID]; exists {
+			return nil, fmt.Errorf("duplicate kid %q", entry.ID)
+		}
+
+		key := &SigningKey{ID: entry.ID, Algorithm: entry.Algorithm}
+		if entry.RetiredAt != nil {
+			key.RetiredAt = *entry.RetiredAt
+		}
+
+		switch entry.Algorithm {
+		case "HS256":
+			secret := config.JWTSecret
+			if entry.SecretEnv != "" {
+				secret = os.Getenv(entry.SecretEnv)
+			}
+			if secret == "" {
+				return nil, fmt.Errorf("key %q: empty HMAC secret", entry.ID)
+			}
+			key.method = jwt.SigningMethodHS256
+			key.signKey = []byte(secret)
+			key.verifyKey = []byte(secret)
+		case "RS256", "EdDSA":
+			if entry.Algorithm == "RS256" {
+				key.method = jwt.SigningMethodRS256
+			} else {
+				key.method = SigningMethodEd25519
+			}
+			if err := loadAsymmetricKey(key, entry.PrivateKeyFile, entry.PublicKeyFile); err != nil {
+				return nil, fmt.Errorf("key %q: %w", entry.ID, err)
+			}
+		default:
+			return nil, fmt.Errorf("key %q: unsupported algorithm %q", entry.ID, entry.Algorithm)
+		}
+
+		kr.keys[key.ID] = key
+	}
+
+	current, ok := kr.keys[file.SigningKey]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found in keys file", file.SigningKey)
+	}
+	if current.signKey == nil {
+		return nil, fmt.Errorf("signing key %q has no private key", current.ID)
+	}
+	if !current.RetiredAt.IsZero() {
+		return nil, fmt.Errorf("signing key %q is retired", current.ID)
+	}
+	kr.current = current
+
+	return kr, nil
+}
+
+// loadAsymmetricKey reads a PEM private key (PKCS#8, or PKCS#1 for RSA) or, for
+// verify-only keys, a PEM public key (PKIX).
+func loadAsymmetricKey(key *SigningKey, privateKeyFile, publicKeyFile string) error {
+	if privateKeyFile != "" {
+		block, err := readPEM(privateKeyFile)
+		if err != nil {
+			return err
+		}
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+			if err != nil {
+				return fmt.Errorf("parsing private key: %w", err)
+			}
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return fmt.Errorf("unsupported private key type %T", parsed)
+		}
+		key.signKey = parsed
+		key.verifyKey = signer.Public()
+	} else if publicKeyFile != "" {
+		block, err := readPEM(publicKeyFile)
+		if err != nil {
+			return err
+		}
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return fmt.Errorf("parsing public key: %w", err)
+		}
+		key.verifyKey = parsed
+	} else {
+		return fmt.Errorf("private_key_file or public_key_file is required")
+	}
+
+	switch key.verifyKey.(type) {
+	case *rsa.PublicKey:
+		if key.Algorithm != "RS256" {
+			return fmt.Errorf("RSA key used with %s", key.Algorithm)
+		}
+	case ed25519.PublicKey:
+		if key.Algorithm != "EdDSA" {
+			return fmt.Errorf("ed25519 key used with %s", key.Algorithm)
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", key.verifyKey)
+	}
+	return nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s: no PEM data found", path)
+	}
+	return block, nil
+}
+
+// Sign signs the claims with the current signing key and sets the `kid` header.
+func (kr *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(kr.current.method, claims)
+	token.Header["kid"] = kr.current.ID
+	return token.SignedString(kr.current.signKey)
+}
+
+// Keyfunc resolves the verification key for a parsed token. The token's `alg`
+// must match the algorithm registered for its `kid`, and retired keys are only
+// accepted until their grace period has elapsed.
+func (kr *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = DefaultKeyID
+	}
+
+	key, ok := kr.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Algorithm {
+		return nil, fmt.Errorf("unexpected signing method")
+	}
+	if !kr.verifies(key) {
+		return nil, fmt.Errorf("signing key %q has expired", kid)
+	}
+	return key.verifyKey, nil
+}
+
+// verifies reports whether the key may still verify tokens.
+func (kr *KeyRing) verifies(key *SigningKey) bool {
+	return key.RetiredAt.IsZero() || time.Now().Before(key.RetiredAt.Add(kr.grace))
+}
+
+// JSONWebKey is a public key in JWK format (RFC 7517).
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	Use       string `json:"use"`
+	KeyID     string `json:"kid"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JSONWebKeySet is a JWK set as served from /.well-known/jwks.json.
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// JWKS returns the public halves of every asymmetric key that still verifies tokens.
+// HMAC keys are never published.
+func (kr *KeyRing) JWKS() JSONWebKeySet {
+	ids := make([]string, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, id := range ids {
+		key := kr.keys[id]
+		if !kr.verifies(key) {
+			continue
+		}
+		switch pub := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JSONWebKey{
+				KeyType:   "RSA",
+				Use:       "sig",
+				KeyID:     key.ID,
+				Algorithm: key.Algorithm,
+				N:         base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:         base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			set.Keys = append(set.Keys, JSONWebKey{
+				KeyType:   "OKP",
+				Use:       "sig",
+				KeyID:     key.ID,
+				Algorithm: key.Algorithm,
+				Curve:     "Ed25519",
+				X:         base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return set
+}
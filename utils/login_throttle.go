@@ -0,0 +1,201 @@
+// utils/login_throttle.go
+package utils
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// loginAttempt tracks recent login attempts for one username or client IP.
+// Attempts count as failures from the moment they are reserved until they succeed.
+type loginAttempt struct {
+	Key         string    `bson:"_id"`
+	Failures    int       `bson:"failures"`
+	LastFailure time.Time `bson:"last_failure"`
+	RetryAt     time.Time `bson:"retry_at,omitempty"`
+	LockedUntil time.Time `bson:"locked_until,omitempty"`
+	ExpiresAt   time.Time `bson:"expires_at"`
+}
+
+// allowedAt returns when the next attempt will be accepted.
+func (a *loginAttempt) allowedAt() time.Time {
+	if a.RetryAt.After(a.LockedUntil) {
+		return a.RetryAt
+	}
+	return a.LockedUntil
+}
+
+// LoginThrottle slows down and eventually locks out repeated failed logins,
+// tracked separately per username and per client IP so that neither a
+// distributed attack on one account nor one client spraying many accounts works.
+type LoginThrottle struct {
+	coll            *mongo.Collection
+	userMaxFailures int
+	ipMaxFailures   int
+	lockout         time.Duration
+	backoffBase     time.Duration
+}
+
+// NewLoginThrottle initializes a new LoginThrottle backed by the given collection.
+func NewLoginThrottle(coll *mongo.Collection, config Config) *LoginThrottle {
+	return &LoginThrottle{
+		coll:            coll,
+		userMaxFailures: config.LoginMaxFailures,
+		ipMaxFailures:   config.LoginIPMaxFailures,
+		lockout:         config.LoginLockoutDuration,
+		backoffBase:     config.LoginBackoffBase,
+	}
+}
+
+// EnsureIndexes creates the TTL index that forgets failures once they are stale.
+func (lt *LoginThrottle) EnsureIndexes(ctx context.Context) error {
+	_, err := lt.coll.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+func userKey(username string) string { return "user:" + UsernameKey(username) }
+func ipKey(ip string) string         { return "ip:" + ip }
+
+// Reserve counts a login attempt for the username and the IP before the
+// credentials are checked. It returns zero if the attempt may go ahead, or how
+// long to wait if either is backing off or locked out. Each reservation is a
+// single atomic update, so parallel attempts cannot get past the limit before
+// their failures are counted. Successful attempts must be passed to
+// RecordSuccess or Release.
+func (lt *LoginThrottle) Reserve(ctx context.Context, username, ip string) (time.Duration, error) {
+	wait, err := lt.reserve(ctx, ipKey(ip), lt.ipMaxFailures)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+	wait, err = lt.reserve(ctx, userKey(username), lt.userMaxFailures)
+	if err != nil || wait > 0 {
+		if releaseErr := lt.release(ctx, ipKey(ip)); err == nil {
+			err = releaseErr
+		}
+	}
+	return wait, err
+}
+
+// reserve counts an attempt for the key unless it must wait, and locks the key
+// once it reaches its failure limit.
+func (lt *LoginThrottle) reserve(ctx context.Context, key string, maxFailures int) (time.Duration, error) {
+	for try := 0; ; try++ {
+		now := time.Now()
+		var attempt loginAttempt
+		err := lt.coll.FindOneAndUpdate(ctx,
+			bson.M{
+				"_id":          key,
+				"failures":     bson.M{"$not": bson.M{"$gte": maxFailures}},
+				"retry_at":     bson.M{"$not": bson.M{"$gt": now}},
+				"locked_until": bson.M{"$not": bson.M{"$gt": now}},
+			},
+			bson.M{
+				"$inc": bson.M{"failures": 1},
+				"$set": bson.M{"last_failure": now},
+				"$max": bson.M{"expires_at": now.Add(lt.lockout)},
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&attempt)
+		if err == nil {
+			return 0, lt.applyBackoff(ctx, key, attempt.Failures, maxFailures, now)
+		}
+		if !mongo.IsDuplicateKeyError(err) {
+			return 0, err
+		}
+
+		// The key exists but is not accepting attempts; the upsert collided with it
+		if err := lt.coll.FindOne(ctx, bson.M{"_id": key}).Decode(&attempt); err != nil && err != mongo.ErrNoDocuments {
+			return 0, err
+		}
+		if wait := attempt.allowedAt().Sub(time.Now()); wait > 0 {
+			return wait, nil
+		}
+		// It changed in between, or is about to be locked by a concurrent attempt
+		if try >= 2 {
+			return lt.backoffBase, nil
+		}
+	}
+}
+
+// applyBackoff makes the key wait after its failures-th attempt, and locks it
+// out once the attempt reaches the failure limit.
+func (lt *LoginThrottle) applyBackoff(ctx context.Context, key string, failures, maxFailures int, now time.Time) error {
+	if failures >= maxFailures {
+		lockedUntil := now.Add(lt.lockout)
+		_, err := lt.coll.UpdateOne(ctx,
+			bson.M{"_id": key, "failures": failures},
+			bson.M{"$set": bson.M{"locked_until": lockedUntil, "failures": 0}, "$max": bson.M{"expires_at": lockedUntil}},
+		)
+		return err
+	}
+
+	delay := lt.backoff(failures, maxFailures)
+	if delay == 0 {
+		return nil
+	}
+	_, err := lt.coll.UpdateOne(ctx,
+		bson.M{"_id": key},
+		bson.M{"$max": bson.M{"retry_at": now.Add(delay)}},
+	)
+	return err
+}
+
+// backoff grows exponentially once half of the allowed failures are used up.
+func (lt *LoginThrottle) backoff(failures, maxFailures int) time.Duration {
+	free := maxFailures / 2
+	if failures <= free {
+		return 0
+	}
+	exp := failures - free - 1
+	if exp > 30 {
+		return lt.lockout
+	}
+	delay := lt.backoffBase << uint(exp)
+	if delay > lt.lockout {
+		delay = lt.lockout
+	}
+	return delay
+}
+
+// RecordSuccess clears the failure count of the username after a successful
+// login and takes back the attempt counted for the IP. The rest of the IP
+// counter is left to expire so one valid account cannot reset it.
+func (lt *LoginThrottle) RecordSuccess(ctx context.Context, username, ip string) error {
+	if _, err := lt.coll.DeleteOne(ctx, bson.M{"_id": userKey(username)}); err != nil {
+		return err
+	}
+	return lt.release(ctx, ipKey(ip))
+}
+
+// Release takes back a reserved attempt that neither failed nor completed a
+// login, such as a correct password still awaiting a second factor.
+func (lt *LoginThrottle) Release(ctx context.Context, username, ip string) error {
+	if err := lt.release(ctx, userKey(username)); err != nil {
+		return err
+	}
+	return lt.release(ctx, ipKey(ip))
+}
+
+func (lt *LoginThrottle) release(ctx context.Context, key string) error {
+	_, err := lt.coll.UpdateOne(ctx,
+		bson.M{"_id": key, "failures": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"failures": -1}},
+	)
+	return err
+}
+
+// Unlock removes any lockout and failure count for the username.
+func (lt *LoginThrottle) Unlock(ctx context.Context, username string) (bool, error) {
+	result, err := lt.coll.DeleteOne(ctx, bson.M{"_id": userKey(username)})
+	if err != nil {
+		return false, err
+	}
+	return result.DeletedCount > 0, nil
+}
@@ -0,0 +1,105 @@
+// utils/mailer.go
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer delivers plain-text email.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// NewMailer returns the Mailer selected by MAIL_DRIVER ("smtp" or "log").
+func NewMailer(config Config) Mailer {
+	if config.MailDriver == "smtp" {
+		return &SMTPMailer{
+			addr:     config.SMTPHost + ":" + strconv.Itoa(config.SMTPPort),
+			host:     config.SMTPHost,
+			username: config.SMTPUsername,
+			password: config.SMTPPassword,
+			from:     config.MailFrom,
+		}
+	}
+	return NewLogMailer(config.MailLogFile)
+}
+
+// NormalizeEmail validates an email address and returns it trimmed and lower-cased.
+func NormalizeEmail(email string) (string, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return "", errors.New("invalid email address")
+	}
+	return email, nil
+}
+
+// SMTPMailer sends email through an SMTP relay.
+type SMTPMailer struct {
+	addr     string
+	host     string
+	username string
+	password string
+	from     string
+}
+
+// Send delivers the message, authenticating with PLAIN auth when credentials are set.
+func (m *SMTPMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.username != "" {
+		auth = smtp.PlainAuth("", m.username, m.password, m.host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + m.from,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	return smtp.SendMail(m.addr, auth, m.from, []string{to}, []byte(msg))
+}
+
+// LogMailer is a development stand-in that writes messages to a file, or to the
+// server log when no file is configured, instead of sending them.
+type LogMailer struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewLogMailer returns a LogMailer appending to path, or logging when path is empty.
+func NewLogMailer(path string) *LogMailer {
+	return &LogMailer{path: path}
+}
+
+// Send records the message.
+func (m *LogMailer) Send(to, subject, body string) error {
+	if m.path == "" {
+		log.Printf("[INFO] Mail to %s: %s\n%s", to, subject, body)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	f, err := os.OpenFile(m.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "Date: %s\nTo: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC3339), to, subject, body)
+	return err
+}
@@ -0,0 +1,727 @@
+// utils/oauth.go
+package utils
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"social-experiment/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// OAuthCodeTTL is how long a client has to redeem an authorization code.
+const OAuthCodeTTL = time.Minute
+
+// Error codes reported to OAuth clients (RFC 6749)
+const (
+	OAuthInvalidRequest          = "invalid_request"
+	OAuthInvalidClient           = "invalid_client"
+	OAuthInvalidGrant            = "invalid_grant"
+	OAuthInvalidScope            = "invalid_scope"
+	OAuthUnsupportedGrantType    = "unsupported_grant_type"
+	OAuthUnsupportedResponseType = "unsupported_response_type"
+	OAuthAccessDenied            = "access_denied"
+)
+
+// ErrOAuthClientNotFound is returned for unknown client IDs.
+var ErrOAuthClientNotFound = errors.New("unknown OAuth client")
+
+// OAuthError is a protocol error that is reported to the client as is.
+type OAuthError struct {
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func oauthError(code, description string) *OAuthError {
+	return &OAuthError{Code: code, Description: description}
+}
+
+// OAuthAuthorizationRequest holds the parameters a client sends the user with
+// to the authorization endpoint.
+type OAuthAuthorizationRequest struct {
+	ResponseType        string `form:"response_type" json:"response_type"`
+	ClientID            string `form:"client_id" json:"client_id"`
+	RedirectURI         string `form:"redirect_uri" json:"redirect_uri"`
+	Scope               string `form:"scope" json:"scope"`
+	State               string `form:"state" json:"state"`
+	CodeChallenge       string `form:"code_challenge" json:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method"`
+}
+
+// OAuthTokenResponse is the token endpoint response (RFC 6749 section 5.1).
+type OAuthTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+// OAuthIntrospection is the introspection endpoint response (RFC 7662).
+type OAuthIntrospection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"`
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"`
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// OAuthServer lets registered third-party clients obtain scoped tokens for
+// users through the authorization code grant with PKCE. The access tokens it
+// issues are ordinary scoped JWTs that carry their grant as session, so
+// revoking a grant revokes them like signing out a device does. A grant ends
+// as a whole: revoking one of its refresh tokens, replaying one of its codes,
+// the user withdrawing consent and deleting the client all end it.
+type OAuthServer struct {
+	keys          *KeyRing
+	accessTTL     time.Duration
+	clients       *mongo.Collection
+	grants        *mongo.Collection
+	codes         *mongo.Collection
+	refreshTokens *RefreshTokenStore
+	revocations   *RevocationList
+}
+
+// NewOAuthServer initializes a new OAuthServer. Its refresh tokens must be
+// kept apart from those of interactive sessions.
+func NewOAuthServer(keys *KeyRing, accessTTL time.Duration, clients, grants, codes *mongo.Collection, refreshTokens *RefreshTokenStore, revocations *RevocationList) *OAuthServer {
+	return &OAuthServer{
+		keys:          keys,
+		accessTTL:     accessTTL,
+		clients:       clients,
+		grants:        grants,
+		codes:         codes,
+		refreshTokens: refreshTokens,
+		revocations:   revocations,
+	}
+}
+
+// EnsureIndexes creates the lookup indexes and the TTL index that purges expired codes.
+func (s *OAuthServer) EnsureIndexes(ctx context.Context) error {
+	if _, err := s.clients.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "owner_id", Value: 1}},
+	}); err != nil {
+		return err
+	}
+	if _, err := s.grants.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "client_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "client_id", Value: 1}}},
+	}); err != nil {
+		return err
+	}
+	_, err := s.codes.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "code_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "client_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// ValidateRedirectURI checks that a redirect URI can be registered: it must be
+// an absolute https URL without fragment, or plain http on a loopback address
+// for native apps.
+func ValidateRedirectURI(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || !u.IsAbs() || u.Host == "" {
+		return fmt.Errorf("redirect URI %q must be an absolute URL", raw)
+	}
+	if u.Fragment != "" {
+		return fmt.Errorf("redirect URI %q must not contain a fragment", raw)
+	}
+	switch u.Scheme {
+	case "https":
+		return nil
+	case "http":
+		host := u.Hostname()
+		if host == "localhost" || net.ParseIP(host).IsLoopback() {
+			return nil
+		}
+	}
+	return fmt.Errorf("redirect URI %q must use https", raw)
+}
+
+// OAuthRedirectURL adds the parameters to the query of a redirect URI.
+func OAuthRedirectURL(redirectURI string, params url.Values) string {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return redirectURI
+	}
+	query := u.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	u.RawQuery = query.Encode()
+	return u.String()
+}
+
+// RegisterClient registers a client owned by the user. Confidential clients
+// get a secret, which is only returned here.
+func (s *OAuthServer) RegisterClient(ctx context.Context, ownerID primitive.ObjectID, name string, redirectURIs, scopes []string, confidential bool) (string, *models.OAuthClient, error) {
+	client := &models.OAuthClient{
+		ID:           primitive.NewObjectID(),
+		OwnerID:      ownerID,
+		Name:         name,
+		Confidential: confidential,
+		RedirectURIs: redirectURIs,
+		Scopes:       scopes,
+		CreatedAt:    time.Now(),
+	}
+
+	var secret string
+	if confidential {
+		var err error
+		secret, err = GenerateOpaqueToken()
+		if err != nil {
+			return "", nil, err
+		}
+		client.SecretHash = HashToken(secret)
+	}
+
+	if _, err := s.clients.InsertOne(ctx, client); err != nil {
+		return "", nil, err
+	}
+	return secret, client, nil
+}
+
+// ListClients returns the clients the user registered, newest first.
+func (s *OAuthServer) ListClients(ctx context.Context, ownerID primitive.ObjectID) ([]models.OAuthClient, error) {
+	cursor, err := s.clients.Find(ctx,
+		bson.M{"owner_id": ownerID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	clients := []models.OAuthClient{}
+	if err := cursor.All(ctx, &clients); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// DeleteClient deletes one of the user's clients and ends every grant made to
+// it. It returns the IDs of the ended grants, or false if the user has no such client.
+func (s *OAuthServer) DeleteClient(ctx context.Context, ownerID, clientID primitive.ObjectID) ([]string, bool, error) {
+	result, err := s.clients.DeleteOne(ctx, bson.M{"_id": clientID, "owner_id": ownerID})
+	if err != nil {
+		return nil, false, err
+	}
+	if result.DeletedCount == 0 {
+		return nil, false, nil
+	}
+
+	if _, err := s.codes.DeleteMany(ctx, bson.M{"client_id": clientID}); err != nil {
+		return nil, true, err
+	}
+
+	ended, err := s.endGrants(ctx, bson.M{"client_id": clientID})
+	return ended, true, err
+}
+
+// RevokeUser ends every grant the user made and returns their IDs.
+func (s *OAuthServer) RevokeUser(ctx context.Context, userID primitive.ObjectID) ([]string, error) {
+	return s.endGrants(ctx, bson.M{"user_id": userID})
+}
+
+// DeleteUser ends every grant the user made and deletes the clients the user
+// registered. It returns the IDs of all grants ended, including those other
+// users made to the deleted clients.
+func (s *OAuthServer) DeleteUser(ctx context.Context, userID primitive.ObjectID) ([]string, error) {
+	ended, err := s.RevokeUser(ctx, userID)
+	if err != nil {
+		return ended, err
+	}
+
+	cursor, err := s.clients.Find(ctx, bson.M{"owner_id": userID}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return ended, err
+	}
+	var clients []models.OAuthClient
+	if err := cursor.All(ctx, &clients); err != nil {
+		return ended, err
+	}
+	for _, client := range clients {
+		grantIDs, _, err := s.DeleteClient(ctx, userID, client.ID)
+		ended = append(ended, grantIDs...)
+		if err != nil {
+			return ended, err
+		}
+	}
+	return ended, nil
+}
+
+// Client returns a registered client by its client ID.
+func (s *OAuthServer) Client(ctx context.Context, clientID string) (*models.OAuthClient, error) {
+	id, err := primitive.ObjectIDFromHex(clientID)
+	if err != nil {
+		return nil, ErrOAuthClientNotFound
+	}
+
+	var client models.OAuthClient
+	err = s.clients.FindOne(ctx, bson.M{"_id": id}).Decode(&client)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrOAuthClientNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &client, nil
+}
+
+// AuthenticateClient verifies the credentials a client presents to the token,
+// introspection and revocation endpoints. Public clients present no secret.
+func (s *OAuthServer) AuthenticateClient(ctx context.Context, clientID, secret string) (*models.OAuthClient, error) {
+	client, err := s.Client(ctx, clientID)
+	if err == ErrOAuthClientNotFound {
+		return nil, oauthError(OAuthInvalidClient, "Unknown client")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if !client.Confidential {
+		if secret != "" {
+			return nil, oauthError(OAuthInvalidClient, "Public clients must not send a client secret")
+		}
+		return client, nil
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(HashToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, oauthError(OAuthInvalidClient, "Invalid client credentials")
+	}
+	return client, nil
+}
+
+// ValidateAuthorization checks an authorization request and returns the client
+// and the scopes it asks for, which default to all scopes the client was
+// registered with. Errors returned together with a nil client concern the
+// client or redirect URI themselves and must not be reported to the redirect URI.
+func (s *OAuthServer) ValidateAuthorization(ctx context.Context, req *OAuthAuthorizationRequest) (*models.OAuthClient, []string, error) {
+	client, err := s.Client(ctx, req.ClientID)
+	if err == ErrOAuthClientNotFound {
+		return nil, nil, oauthError(OAuthInvalidClient, "Unknown client")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !containsString(client.RedirectURIs, req.RedirectURI) {
+		return nil, nil, oauthError(OAuthInvalidRequest, "redirect_uri is not registered for this client")
+	}
+
+	if req.ResponseType != "code" {
+		return client, nil, oauthError(OAuthUnsupportedResponseType, "Only the authorization code flow is supported")
+	}
+	if req.CodeChallengeMethod != "S256" || len(req.CodeChallenge) != 43 {
+		return client, nil, oauthError(OAuthInvalidRequest, "PKCE with code_challenge_method S256 is required")
+	}
+
+	scopes, err := NormalizeScopes(strings.Fields(req.Scope))
+	if err != nil {
+		return client, nil, oauthError(OAuthInvalidScope, err.Error())
+	}
+	if len(scopes) == 0 {
+		return client, client.Scopes, nil
+	}
+	for _, scope := range scopes {
+		if !containsString(client.Scopes, scope) {
+			return client, nil, oauthError(OAuthInvalidScope, fmt.Sprintf("Client is not registered for scope %q", scope))
+		}
+	}
+	return client, scopes, nil
+}
+
+// HasConsent reports whether the user already granted the client all of the scopes.
+func (s *OAuthServer) HasConsent(ctx context.Context, userID, clientID primitive.ObjectID, scopes []string) (bool, error) {
+	count, err := s.grants.CountDocuments(ctx, bson.M{
+		"user_id":   userID,
+		"client_id": clientID,
+		"scopes":    bson.M{"$all": scopes},
+	})
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Authorize records the user's consent to a validated request and returns the
+// authorization code for the client.
+func (s *OAuthServer) Authorize(ctx context.Context, userID primitive.ObjectID, client *models.OAuthClient, req *OAuthAuthorizationRequest, scopes []string) (string, error) {
+	now := time.Now()
+
+	var grant models.OAuthGrant
+	err := s.grants.FindOneAndUpdate(ctx,
+		bson.M{"user_id": userID, "client_id": client.ID},
+		bson.M{
+			"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "created_at": now},
+			"$addToSet":    bson.M{"scopes": bson.M{"$each": scopes}},
+			"$set":         bson.M{"updated_at": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&grant)
+	if err != nil {
+		return "", err
+	}
+
+	code, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+	record := models.OAuthAuthorizationCode{
+		ID:            primitive.NewObjectID(),
+		CodeHash:      HashToken(code),
+		ClientID:      client.ID,
+		UserID:        userID,
+		GrantID:       grant.ID,
+		RedirectURI:   req.RedirectURI,
+		Scopes:        scopes,
+		CodeChallenge: req.CodeChallenge,
+		CreatedAt:     now,
+		ExpiresAt:     now.Add(OAuthCodeTTL),
+	}
+	if _, err := s.codes.InsertOne(ctx, record); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ExchangeCode redeems an authorization code for a token pair. Codes are
+// single-use: presenting one again ends the grant it was issued under.
+func (s *OAuthServer) ExchangeCode(ctx context.Context, client *models.OAuthClient, code, redirectURI, codeVerifier string) (*OAuthTokenResponse, error) {
+	if code == "" || codeVerifier == "" {
+		return nil, oauthError(OAuthInvalidRequest, "code and code_verifier are required")
+	}
+
+	hash := HashToken(code)
+	now := time.Now()
+
+	// Atomically mark the code as used so concurrent replays cannot both succeed.
+	// Only its own client and redirect_uri may use it up.
+	var record models.OAuthAuthorizationCode
+	err := s.codes.FindOneAndUpdate(ctx,
+		bson.M{
+			"code_hash":    hash,
+			"client_id":    client.ID,
+			"redirect_uri": redirectURI,
+			"used_at":      nil,
+			"expires_at":   bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, s.rejectCode(ctx, hash, client.ID, redirectURI)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(codeVerifier) < 43 || len(codeVerifier) > 128 ||
+		subtle.ConstantTimeCompare([]byte(PKCEChallenge(codeVerifier)), []byte(record.CodeChallenge)) != 1 {
+		return nil, oauthError(OAuthInvalidGrant, "PKCE verification failed")
+	}
+
+	// The user may have withdrawn consent since approving the request
+	count, err := s.grants.CountDocuments(ctx, bson.M{"_id": record.GrantID})
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		return nil, oauthError(OAuthInvalidGrant, "Authorization was revoked")
+	}
+
+	refreshToken, err := s.refreshTokens.IssueScoped(ctx, record.UserID, record.GrantID, record.Scopes)
+	if err != nil {
+		return nil, err
+	}
+	return s.tokenResponse(record.UserID, record.GrantID, client.ID, record.Scopes, refreshToken)
+}
+
+// rejectCode determines why a code could not be redeemed by the given client
+// and redirect_uri, and ends its grant when the code had already been used.
+func (s *OAuthServer) rejectCode(ctx context.Context, hash string, clientID primitive.ObjectID, redirectURI string) error {
+	var existing models.OAuthAuthorizationCode
+	err := s.codes.FindOne(ctx, bson.M{"code_hash": hash}).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return oauthError(OAuthInvalidGrant, "Invalid or expired authorization code")
+	}
+	if err != nil {
+		return err
+	}
+	if existing.ClientID != clientID || existing.RedirectURI != redirectURI {
+		return oauthError(OAuthInvalidGrant, "Authorization code was not issued to this client or redirect_uri")
+	}
+	if existing.UsedAt == nil {
+		return oauthError(OAuthInvalidGrant, "Invalid or expired authorization code")
+	}
+
+	log.Printf("[WARNING] Authorization code reuse detected, ending grant %s (UserID: %s)", existing.GrantID.Hex(), existing.UserID.Hex())
+	if err := s.endGrant(ctx, existing.GrantID); err != nil {
+		return err
+	}
+	return oauthError(OAuthInvalidGrant, "Authorization code was already used")
+}
+
+// Refresh rotates a refresh token held by the client and returns a new token
+// pair with the same scopes.
+func (s *OAuthServer) Refresh(ctx context.Context, client *models.OAuthClient, refreshToken string) (*OAuthTokenResponse, error) {
+	if refreshToken == "" {
+		return nil, oauthError(OAuthInvalidRequest, "refresh_token is required")
+	}
+
+	next, current, err := s.refreshTokens.Rotate(ctx, refreshToken)
+	switch err {
+	case nil:
+	case ErrRefreshTokenReused:
+		return nil, oauthError(OAuthInvalidGrant, "Refresh token reuse detected")
+	case ErrRefreshTokenInvalid:
+		return nil, oauthError(OAuthInvalidGrant, "Invalid or expired refresh token")
+	default:
+		return nil, err
+	}
+
+	grant, err := s.grant(ctx, current.FamilyID)
+	if err != nil {
+		return nil, err
+	}
+	if grant == nil || grant.ClientID != client.ID {
+		// A token presented by another client has leaked; stop the whole chain
+		if err := s.refreshTokens.RevokeFamily(ctx, current.FamilyID); err != nil {
+			return nil, err
+		}
+		return nil, oauthError(OAuthInvalidGrant, "Invalid or expired refresh token")
+	}
+
+	return s.tokenResponse(current.UserID, grant.ID, client.ID, current.Scopes, next)
+}
+
+// Introspect describes a token issued to the client. Tokens that are invalid,
+// expired, revoked or belong to another client are reported as inactive.
+func (s *OAuthServer) Introspect(ctx context.Context, client *models.OAuthClient, token string) (*OAuthIntrospection, error) {
+	inactive := &OAuthIntrospection{Active: false}
+
+	if claims, err := ValidateJWT(token, s.keys); err == nil {
+		if claims.Purpose != "" || claims.ClientID != client.ID.Hex() {
+			return inactive, nil
+		}
+		revoked, err := s.revocations.IsRevoked(ctx, claims)
+		if err != nil {
+			return nil, err
+		}
+		if revoked {
+			return inactive, nil
+		}
+		return &OAuthIntrospection{
+			Active:    true,
+			Scope:     claims.Scope,
+			ClientID:  claims.ClientID,
+			Subject:   claims.UserID,
+			TokenType: "Bearer",
+			ExpiresAt: claims.ExpiresAt,
+			IssuedAt:  claims.IssuedAt,
+		}, nil
+	}
+
+	record, grant, err := s.lookupRefreshToken(ctx, client, token)
+	if err != nil || record == nil {
+		return inactive, err
+	}
+	return &OAuthIntrospection{
+		Active:    true,
+		Scope:     strings.Join(record.Scopes, " "),
+		ClientID:  grant.ClientID.Hex(),
+		Subject:   record.UserID.Hex(),
+		TokenType: "refresh_token",
+		ExpiresAt: record.ExpiresAt.Unix(),
+		IssuedAt:  record.CreatedAt.Unix(),
+	}, nil
+}
+
+// RevokeAccessToken revokes an access token issued to the client and returns
+// its ID, or false if the token is not a valid access token of the client.
+func (s *OAuthServer) RevokeAccessToken(ctx context.Context, client *models.OAuthClient, token string) (string, bool, error) {
+	claims, err := ValidateJWT(token, s.keys)
+	if err != nil || claims.Purpose != "" || claims.ClientID != client.ID.Hex() {
+		return "", false, nil
+	}
+	if err := s.revocations.RevokeToken(ctx, claims); err != nil {
+		return "", false, err
+	}
+	return claims.Id, true, nil
+}
+
+// RevokeRefreshToken ends the grant of a refresh token held by the client and
+// returns the grant ID, or false if the token is not a valid refresh token of the client.
+func (s *OAuthServer) RevokeRefreshToken(ctx context.Context, client *models.OAuthClient, token string) (string, bool, error) {
+	_, grant, err := s.lookupRefreshToken(ctx, client, token)
+	if err != nil || grant == nil {
+		return "", false, err
+	}
+	if err := s.endGrant(ctx, grant.ID); err != nil {
+		return "", false, err
+	}
+	return grant.ID.Hex(), true, nil
+}
+
+// ListGrants returns the clients the user has authorized, most recently authorized first.
+func (s *OAuthServer) ListGrants(ctx context.Context, userID primitive.ObjectID) ([]models.OAuthGrant, error) {
+	cursor, err := s.grants.Find(ctx,
+		bson.M{"user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	grants := []models.OAuthGrant{}
+	if err := cursor.All(ctx, &grants); err != nil {
+		return nil, err
+	}
+	if len(grants) == 0 {
+		return grants, nil
+	}
+
+	clientIDs := make([]primitive.ObjectID, 0, len(grants))
+	for _, grant := range grants {
+		clientIDs = append(clientIDs, grant.ClientID)
+	}
+	cursor, err = s.clients.Find(ctx,
+		bson.M{"_id": bson.M{"$in": clientIDs}},
+		options.Find().SetProjection(bson.M{"name": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var clients []models.OAuthClient
+	if err := cursor.All(ctx, &clients); err != nil {
+		return nil, err
+	}
+
+	names := make(map[primitive.ObjectID]string, len(clients))
+	for _, client := range clients {
+		names[client.ID] = client.Name
+	}
+	for i := range grants {
+		grants[i].ClientName = names[grants[i].ClientID]
+	}
+	return grants, nil
+}
+
+// RevokeGrant withdraws the user's consent for a client and revokes every token
+// issued under it. It returns the grant ID, or false if the client was not authorized.
+func (s *OAuthServer) RevokeGrant(ctx context.Context, userID, clientID primitive.ObjectID) (string, bool, error) {
+	var grant models.OAuthGrant
+	err := s.grants.FindOne(ctx, bson.M{"user_id": userID, "client_id": clientID}).Decode(&grant)
+	if err == mongo.ErrNoDocuments {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	if err := s.endGrant(ctx, grant.ID); err != nil {
+		return "", false, err
+	}
+	return grant.ID.Hex(), true, nil
+}
+
+// endGrants ends every grant matching the filter and returns their IDs.
+func (s *OAuthServer) endGrants(ctx context.Context, filter bson.M) ([]string, error) {
+	cursor, err := s.grants.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	var grants []models.OAuthGrant
+	if err := cursor.All(ctx, &grants); err != nil {
+		return nil, err
+	}
+
+	ended := make([]string, 0, len(grants))
+	for _, grant := range grants {
+		if err := s.endGrant(ctx, grant.ID); err != nil {
+			return ended, err
+		}
+		ended = append(ended, grant.ID.Hex())
+	}
+	return ended, nil
+}
+
+// endGrant deletes a grant, revokes its refresh tokens and the access tokens
+// issued under it. A new authorization starts a new grant, so its tokens are
+// not caught by the revocation.
+func (s *OAuthServer) endGrant(ctx context.Context, grantID primitive.ObjectID) error {
+	if _, err := s.grants.DeleteOne(ctx, bson.M{"_id": grantID}); err != nil {
+		return err
+	}
+	if err := s.refreshTokens.RevokeFamily(ctx, grantID); err != nil {
+		return err
+	}
+	return s.revocations.RevokeSession(ctx, grantID.Hex())
+}
+
+// grant returns the grant with the given ID, or nil if it has ended.
+func (s *OAuthServer) grant(ctx context.Context, grantID primitive.ObjectID) (*models.OAuthGrant, error) {
+	var grant models.OAuthGrant
+	err := s.grants.FindOne(ctx, bson.M{"_id": grantID}).Decode(&grant)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &grant, nil
+}
+
+// lookupRefreshToken returns a valid refresh token of the client with its
+// grant, or nils if the token is not one.
+func (s *OAuthServer) lookupRefreshToken(ctx context.Context, client *models.OAuthClient, token string) (*models.RefreshToken, *models.OAuthGrant, error) {
+	record, err := s.refreshTokens.Lookup(ctx, token)
+	if err == ErrRefreshTokenInvalid {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	grant, err := s.grant(ctx, record.FamilyID)
+	if err != nil || grant == nil || grant.ClientID != client.ID {
+		return nil, nil, err
+	}
+	return record, grant, nil
+}
+
+func (s *OAuthServer) tokenResponse(userID, grantID, clientID primitive.ObjectID, scopes []string, refreshToken string) (*OAuthTokenResponse, error) {
+	accessToken, err := GenerateOAuthJWT(userID.Hex(), grantID.Hex(), clientID.Hex(), scopes, s.keys, s.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &OAuthTokenResponse{
+		AccessToken:  accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(s.accessTTL.Seconds()),
+		RefreshToken: refreshToken,
+		Scope:        strings.Join(scopes, " "),
+	}, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
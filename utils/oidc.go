@@ -0,0 +1,549 @@
+// utils/oidc.go
+package utils
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"social-experiment/models"
+
+	"github.com/dgrijalva/jwt-go"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// oidcStateTTL is how long a user has to complete sign-in at the provider.
+	oidcStateTTL = 10 * time.Minute
+	// oidcKeysRefreshInterval limits JWKS refetches triggered by unknown key IDs.
+	oidcKeysRefreshInterval = time.Minute
+	// oidcClockSkew is the leeway allowed when checking ID token timestamps.
+	oidcClockSkew = time.Minute
+)
+
+var (
+	// ErrOIDCStateInvalid is returned for unknown, expired or already used state parameters.
+	ErrOIDCStateInvalid = errors.New("invalid or expired OIDC state")
+	// ErrOIDCProviderUnavailable is returned when a provider cannot be reached or misbehaves.
+	ErrOIDCProviderUnavailable = errors.New("OIDC provider unavailable")
+)
+
+// oidcSigningMethods are the ID token algorithms accepted from providers.
+// Symmetric algorithms and "none" are never accepted.
+var oidcSigningMethods = []string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// OIDCIdentity is the verified identity asserted by a provider's ID token.
+type OIDCIdentity struct {
+	Provider          string
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	PreferredUsername string
+	Name              string
+}
+
+// OIDCProvider is an OpenID Connect identity provider this service signs users
+// in with, using the authorization code flow with PKCE. Provider metadata and
+// signing keys are discovered from the issuer and cached.
+type OIDCProvider struct {
+	Name        string
+	config      OIDCProviderConfig
+	redirectURL string
+	client      *http.Client
+
+	mu            sync.Mutex
+	metadata      *oidcMetadata
+	keys          map[string]interface{}
+	keysFetchedAt time.Time
+}
+
+// oidcMetadata is the subset of the discovery document this service uses.
+type oidcMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewOIDCProviders builds the configured providers, keyed by name. Providers
+// redirect back to OIDC_REDIRECT_URL, by default the frontend's /oidc/callback.
+func NewOIDCProviders(config Config) map[string]*OIDCProvider {
+	redirectURL := config.OIDCRedirectURL
+	if redirectURL == "" {
+		redirectURL = strings.TrimSuffix(config.AppBaseURL, "/") + "/oidc/callback"
+	}
+
+	providers := make(map[string]*OIDCProvider, len(config.OIDCProviders))
+	for _, providerConfig := range config.OIDCProviders {
+		providers[providerConfig.Name] = &OIDCProvider{
+			Name:        providerConfig.Name,
+			config:      providerConfig,
+			redirectURL: redirectURL,
+			client:      &http.Client{Timeout: 10 * time.Second},
+		}
+	}
+	return providers
+}
+
+// TrustsEmail reports whether the provider's verified email addresses may be
+// used to sign in to existing accounts.
+func (p *OIDCProvider) TrustsEmail() bool {
+	return p.config.TrustEmail
+}
+
+// AuthorizationURL returns the provider URL the user is sent to in order to sign in.
+func (p *OIDCProvider) AuthorizationURL(ctx context.Context, state *OIDCAuthorization) (string, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.config.ClientID},
+		"redirect_uri":          {p.redirectURL},
+		"scope":                 {strings.Join(p.config.Scopes, " ")},
+		"state":                 {state.State},
+		"nonce":                 {state.Nonce},
+		"code_challenge":        {PKCEChallenge(state.CodeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return metadata.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity from the
+// verified ID token.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, codeVerifier, nonce string) (*OIDCIdentity, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.redirectURL},
+		"client_id":     {p.config.ClientID},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.config.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.config.ClientID), url.QueryEscape(p.config.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: token request: %v", ErrOIDCProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResponse struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tokenResponse); err != nil {
+		return nil, fmt.Errorf("decoding token response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK || tokenResponse.Error != "" {
+		return nil, fmt.Errorf("token request rejected: %s %s", tokenResponse.Error, tokenResponse.ErrorDescription)
+	}
+	if tokenResponse.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return p.VerifyIDToken(ctx, tokenResponse.IDToken, nonce)
+}
+
+// idTokenClaims are the ID token claims this service reads.
+type idTokenClaims struct {
+	Issuer            string       `json:"iss"`
+	Subject           string       `json:"sub"`
+	Audience          audience     `json:"aud"`
+	AuthorizedParty   string       `json:"azp"`
+	ExpiresAt         int64        `json:"exp"`
+	IssuedAt          int64        `json:"iat"`
+	NotBefore         int64        `json:"nbf"`
+	Nonce             string       `json:"nonce"`
+	Email             string       `json:"email"`
+	EmailVerified     flexibleBool `json:"email_verified"`
+	PreferredUsername string       `json:"preferred_username"`
+	Name              string       `json:"name"`
+}
+
+// Valid is a no-op; ID token claims are checked by VerifyIDToken with clock skew allowance.
+func (c *idTokenClaims) Valid() error {
+	return nil
+}
+
+// audience accepts the aud claim as a single string or an array.
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+func (a audience) contains(value string) bool {
+	for _, entry := range a {
+		if entry == value {
+			return true
+		}
+	}
+	return false
+}
+
+// flexibleBool accepts booleans sent as JSON booleans or strings, as some providers do.
+type flexibleBool bool
+
+func (b *flexibleBool) UnmarshalJSON(data []byte) error {
+	var value bool
+	if err := json.Unmarshal(data, &value); err == nil {
+		*b = flexibleBool(value)
+		return nil
+	}
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	*b = flexibleBool(strings.EqualFold(text, "true"))
+	return nil
+}
+
+// VerifyIDToken checks an ID token's signature against the provider's JWKS and
+// validates its issuer, audience, expiry and nonce.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw, nonce string) (*OIDCIdentity, error) {
+	claims := &idTokenClaims{}
+	parser := &jwt.Parser{ValidMethods: oidcSigningMethods}
+	_, err := parser.ParseWithClaims(raw, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.publicKey(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("verifying ID token: %w", err)
+	}
+
+	now := time.Now()
+	switch {
+	case claims.Issuer != p.config.Issuer:
+		return nil, fmt.Errorf("ID token issuer %q does not match %q", claims.Issuer, p.config.Issuer)
+	case !claims.Audience.contains(p.config.ClientID):
+		return nil, errors.New("ID token audience does not include client ID")
+	case len(claims.Audience) > 1 && claims.AuthorizedParty != p.config.ClientID:
+		return nil, errors.New("ID token authorized party does not match client ID")
+	case claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(oidcClockSkew)):
+		return nil, errors.New("ID token has expired")
+	case claims.IssuedAt > 0 && now.Add(oidcClockSkew).Before(time.Unix(claims.IssuedAt, 0)):
+		return nil, errors.New("ID token issued in the future")
+	case claims.NotBefore > 0 && now.Add(oidcClockSkew).Before(time.Unix(claims.NotBefore, 0)):
+		return nil, errors.New("ID token not yet valid")
+	case claims.Nonce != nonce:
+		return nil, errors.New("ID token nonce mismatch")
+	case claims.Subject == "":
+		return nil, errors.New("ID token has no subject")
+	}
+
+	return &OIDCIdentity{
+		Provider:          p.Name,
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     bool(claims.EmailVerified),
+		PreferredUsername: claims.PreferredUsername,
+		Name:              claims.Name,
+	}, nil
+}
+
+// discover fetches and caches the provider's discovery document.
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcMetadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	var metadata oidcMetadata
+	if err := p.getJSON(ctx, p.config.Issuer+"/.well-known/openid-configuration", &metadata); err != nil {
+		return nil, err
+	}
+	if strings.TrimSuffix(metadata.Issuer, "/") != p.config.Issuer {
+		return nil, fmt.Errorf("%w: discovery issuer %q does not match %q", ErrOIDCProviderUnavailable, metadata.Issuer, p.config.Issuer)
+	}
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete discovery document", ErrOIDCProviderUnavailable)
+	}
+
+	p.metadata = &metadata
+	return p.metadata, nil
+}
+
+// publicKey returns the provider key with the given ID, refetching the JWKS
+// when the key is unknown so provider key rotation is picked up.
+func (p *OIDCProvider) publicKey(ctx context.Context, kid string) (interface{}, error) {
+	metadata, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetchedAt) < oidcKeysRefreshInterval {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	var set struct {
+		Keys []json.RawMessage `json:"keys"`
+	}
+	if err := p.getJSON(ctx, metadata.JWKSURI, &set); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, raw := range set.Keys {
+		id, key, err := parseJWK(raw)
+		if err != nil {
+			// Skip keys we cannot use, such as encryption keys
+			continue
+		}
+		keys[id] = key
+	}
+	p.keys = keys
+	p.keysFetchedAt = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// lookupKey finds a cached key. A token without kid is accepted only if the
+// provider publishes a single key.
+func (p *OIDCProvider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, endpoint string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOIDCProviderUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned status %d", ErrOIDCProviderUnavailable, endpoint, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
+
+// parseJWK decodes an RSA, EC or Ed25519 public signing key in JWK format.
+func parseJWK(raw json.RawMessage) (string, interface{}, error) {
+	var jwk struct {
+		KeyType string `json:"kty"`
+		Use     string `json:"use"`
+		KeyID   string `json:"kid"`
+		N       string `json:"n"`
+		E       string `json:"e"`
+		Curve   string `json:"crv"`
+		X       string `json:"x"`
+		Y       string `json:"y"`
+	}
+	if err := json.Unmarshal(raw, &jwk); err != nil {
+		return "", nil, err
+	}
+	if jwk.Use != "" && jwk.Use != "sig" {
+		return "", nil, fmt.Errorf("key %q is not a signing key", jwk.KeyID)
+	}
+
+	decode := base64.RawURLEncoding.DecodeString
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return "", nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return "", nil, err
+		}
+		return jwk.KeyID, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return "", nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return "", nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return "", nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return "", nil, errors.New("EC point is not on curve")
+		}
+		return jwk.KeyID, key, nil
+	case "OKP":
+		if jwk.Curve != "Ed25519" {
+			return "", nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := decode(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return "", nil, errors.New("invalid Ed25519 key")
+		}
+		return jwk.KeyID, ed25519.PublicKey(x), nil
+	}
+	return "", nil, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+}
+
+// PKCEChallenge derives the S256 code challenge for a PKCE code verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// OIDCAuthorization holds the secrets of a pending authorization request. Only
+// State, Binding and the authorization URL are handed to the browser. Binding
+// never leaves the browser that started the request, so a callback URL handed
+// to someone else cannot be completed by them.
+type OIDCAuthorization struct {
+	State        string
+	Binding      string
+	Nonce        string
+	CodeVerifier string
+}
+
+// OIDCStateStore persists pending authorization requests between the redirect
+// to the provider and the callback.
+type OIDCStateStore struct {
+	coll *mongo.Collection
+}
+
+// NewOIDCStateStore initializes a new OIDCStateStore backed by the given collection.
+func NewOIDCStateStore(coll *mongo.Collection) *OIDCStateStore {
+	return &OIDCStateStore{coll: coll}
+}
+
+// EnsureIndexes creates the lookup index and the TTL index that purges abandoned requests.
+func (s *OIDCStateStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "state_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// Create starts an authorization request with the provider. linkUserID is set
+// when an authenticated user links the provider to their existing account.
+func (s *OIDCStateStore) Create(ctx context.Context, provider string, linkUserID *primitive.ObjectID) (*OIDCAuthorization, error) {
+	var auth OIDCAuthorization
+	for _, value := range []*string{&auth.State, &auth.Binding, &auth.Nonce, &auth.CodeVerifier} {
+		token, err := GenerateOpaqueToken()
+		if err != nil {
+			return nil, err
+		}
+		*value = token
+	}
+
+	now := time.Now()
+	record := models.OIDCState{
+		ID:           primitive.NewObjectID(),
+		StateHash:    HashToken(auth.State),
+		BindingHash:  HashToken(auth.Binding),
+		Provider:     provider,
+		Nonce:        auth.Nonce,
+		CodeVerifier: auth.CodeVerifier,
+		UserID:       linkUserID,
+		CreatedAt:    now,
+		ExpiresAt:    now.Add(oidcStateTTL),
+	}
+	if _, err := s.coll.InsertOne(ctx, record); err != nil {
+		return nil, err
+	}
+	return &auth, nil
+}
+
+// Consume atomically removes and returns the pending request for the state. The
+// binding must be the one handed out with the state, and userID must be the
+// user who started a link, or nil for a sign-in.
+func (s *OIDCStateStore) Consume(ctx context.Context, provider, state, binding string, userID *primitive.ObjectID) (*models.OIDCState, error) {
+	filter := bson.M{
+		"state_hash":   HashToken(state),
+		"binding_hash": HashToken(binding),
+		"provider":     provider,
+		"expires_at":   bson.M{"$gt": time.Now()},
+	}
+	if userID != nil {
+		filter["user_id"] = *userID
+	} else {
+		filter["user_id"] = bson.M{"$exists": false}
+	}
+
+	var record models.OIDCState
+	err := s.coll.FindOneAndDelete(ctx, filter).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrOIDCStateInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
@@ -0,0 +1,15 @@
+// utils/origin.go
+package utils
+
+// IsAllowedOrigin checks if the origin is allowed based on the CORS configuration
+func IsAllowedOrigin(origin string, allowedOrigins []string) bool {
+	if len(allowedOrigins) == 0 {
+		return false
+	}
+	for _, ao := range allowedOrigins {
+		if ao == "*" || ao == origin {
+			return true
+		}
+	}
+	return false
+}
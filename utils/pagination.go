@@ -0,0 +1,121 @@
+// utils/pagination.go
+package utils
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Page sizes for paginated lists
+const (
+	DefaultPageSize = 20
+	MaxPageSize     = 100
+)
+
+// Pagination errors
+var (
+	ErrInvalidCursor   = errors.New("invalid cursor")
+	ErrInvalidPageSize = errors.New("invalid page size")
+)
+
+// PageCursor is a position in a list ordered newest first by creation time,
+// with the ID breaking ties. Newer selects the page of items before the
+// position instead of the page after it.
+type PageCursor struct {
+	CreatedAt time.Time
+	ID        primitive.ObjectID
+	Newer     bool
+}
+
+type pageCursorJSON struct {
+	CreatedAt int64  `json:"t"`
+	ID        string `json:"id"`
+	Newer     bool   `json:"n,omitempty"`
+}
+
+// Encode returns the cursor as an opaque URL-safe string.
+func (c PageCursor) Encode() string {
+	data, _ := json.Marshal(pageCursorJSON{
+		CreatedAt: c.CreatedAt.UnixMilli(),
+		ID:        c.ID.Hex(),
+		Newer:     c.Newer,
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// ParsePageCursor decodes a cursor returned by Encode.
+func ParsePageCursor(s string) (*PageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var raw pageCursorJSON
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	id, err := primitive.ObjectIDFromHex(raw.ID)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &PageCursor{CreatedAt: time.UnixMilli(raw.CreatedAt), ID: id, Newer: raw.Newer}, nil
+}
+
+// Filter selects the items on the cursor's side of its position.
+func (c PageCursor) Filter() bson.M {
+	if c.Newer {
+		return NewerThan(c.CreatedAt, c.ID)
+	}
+	return OlderThan(c.CreatedAt, c.ID)
+}
+
+// Sort returns the order in which to read the cursor's page: away from its
+// position. Pages of newer items are read oldest first and must be reversed.
+func (c PageCursor) Sort() bson.D {
+	if c.Newer {
+		return bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}
+	}
+	return NewestFirst()
+}
+
+// NewestFirst is the order of paginated lists.
+func NewestFirst() bson.D {
+	return bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: -1}}
+}
+
+// OlderThan selects the items listed after the given position.
+func OlderThan(createdAt time.Time, id primitive.ObjectID) bson.M {
+	return bson.M{"$or": []bson.M{
+		{"created_at": bson.M{"$lt": createdAt}},
+		{"created_at": createdAt, "_id": bson.M{"$lt": id}},
+	}}
+}
+
+// NewerThan selects the items listed before the given position.
+func NewerThan(createdAt time.Time, id primitive.ObjectID) bson.M {
+	return bson.M{"$or": []bson.M{
+		{"created_at": bson.M{"$gt": createdAt}},
+		{"created_at": createdAt, "_id": bson.M{"$gt": id}},
+	}}
+}
+
+// ParsePageSize parses the limit parameter of a paginated request, defaulting
+// to DefaultPageSize and capping it at MaxPageSize.
+func ParsePageSize(s string) (int, error) {
+	if s == "" {
+		return DefaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(s)
+	if err != nil || limit < 1 {
+		return 0, ErrInvalidPageSize
+	}
+	if limit > MaxPageSize {
+		limit = MaxPageSize
+	}
+	return limit, nil
+}
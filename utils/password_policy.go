@@ -0,0 +1,194 @@
+// utils/password_policy.go
+package utils
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// bcryptMaxBytes is the length after which bcrypt silently ignores input.
+const bcryptMaxBytes = 72
+
+// Password policy error codes returned to clients
+const (
+	PasswordTooShort         = "password_too_short"
+	PasswordTooLong          = "password_too_long"
+	PasswordContainsUsername = "password_contains_username"
+	PasswordBreached         = "password_breached"
+)
+
+// PasswordPolicyError describes why a password was rejected.
+type PasswordPolicyError struct {
+	Code    string
+	Message string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return e.Message
+}
+
+// PasswordPolicy validates new passwords on registration, change and reset.
+type PasswordPolicy struct {
+	minLength int
+	maxBytes  int
+	breached  *BreachedPasswords
+}
+
+// NewPasswordPolicy builds the policy from configuration, loading the breached
+// password list when one is configured.
+func NewPasswordPolicy(config Config) (*PasswordPolicy, error) {
+	policy := &PasswordPolicy{
+		minLength: config.PasswordMinLength,
+		maxBytes:  config.PasswordMaxLength,
+	}
+	if policy.maxBytes <= 0 || policy.maxBytes > bcryptMaxBytes {
+		policy.maxBytes = bcryptMaxBytes
+	}
+
+	if config.BreachedPasswordsPath != "" {
+		breached, err := LoadBreachedPasswords(config.BreachedPasswordsPath)
+		if err != nil {
+			return nil, err
+		}
+		policy.breached = breached
+	}
+	return policy, nil
+}
+
+// Validate returns a *PasswordPolicyError if the password is not acceptable for the user.
+func (p *PasswordPolicy) Validate(username, password string) error {
+	if utf8.RuneCountInString(password) < p.minLength {
+		return &PasswordPolicyError{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("Password must be at least %d characters", p.minLength),
+		}
+	}
+	if len(password) > p.maxBytes {
+		return &PasswordPolicyError{
+			Code:    PasswordTooLong,
+			Message: fmt.Sprintf("Password must be at most %d bytes", p.maxBytes),
+		}
+	}
+	if len(username) >= 3 && strings.Contains(strings.ToLower(password), strings.ToLower(username)) {
+		return &PasswordPolicyError{
+			Code:    PasswordContainsUsername,
+			Message: "Password must not contain your username",
+		}
+	}
+
+	if p.breached != nil {
+		count, err := p.breached.Count(password)
+		if err != nil {
+			// An unreadable range file should not block sign-ups; the other rules still apply
+			log.Printf("[ERROR] Error checking breached passwords: %v", err)
+		} else if count > 0 {
+			return &PasswordPolicyError{
+				Code:    PasswordBreached,
+				Message: "This password has appeared in a data breach, please choose another",
+			}
+		}
+	}
+	return nil
+}
+
+// BreachedPasswords looks up SHA-1 hashes in an offline copy of the Pwned
+// Passwords list using the k-anonymity range format: hashes are bucketed by
+// their first five hex characters and each bucket lists "SUFFIX:COUNT" lines.
+//
+// The path may be a directory of range files named by prefix (as written by
+// the HIBP downloader, optionally with a .txt extension), which are read on
+// demand, or a single file of "HASH:COUNT" lines, which is loaded into memory.
+type BreachedPasswords struct {
+	dir    string
+	ranges map[string]map[string]int
+}
+
+// LoadBreachedPasswords opens the breached password list at path.
+func LoadBreachedPasswords(path string) (*BreachedPasswords, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir() {
+		return &BreachedPasswords{dir: path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	bp := &BreachedPasswords{ranges: make(map[string]map[string]int)}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hash, count, ok := parseRangeLine(scanner.Text())
+		if !ok || len(hash) != 40 {
+			continue
+		}
+		prefix, suffix := hash[:5], hash[5:]
+		if bp.ranges[prefix] == nil {
+			bp.ranges[prefix] = make(map[string]int)
+		}
+		bp.ranges[prefix][suffix] = count
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("[INFO] Loaded breached password list with %d ranges", len(bp.ranges))
+	return bp, nil
+}
+
+// Count returns how often the password appears in the list.
+func (bp *BreachedPasswords) Count(password string) (int, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	if bp.dir == "" {
+		return bp.ranges[prefix][suffix], nil
+	}
+
+	f, err := os.Open(filepath.Join(bp.dir, prefix))
+	if os.IsNotExist(err) {
+		f, err = os.Open(filepath.Join(bp.dir, prefix+".txt"))
+	}
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineSuffix, count, ok := parseRangeLine(scanner.Text())
+		if ok && lineSuffix == suffix {
+			return count, nil
+		}
+	}
+	return 0, scanner.Err()
+}
+
+// parseRangeLine parses a "HASH:COUNT" line, upper-casing the hash.
+func parseRangeLine(line string) (string, int, bool) {
+	parts := strings.SplitN(strings.TrimSpace(line), ":", 2)
+	if len(parts) != 2 {
+		return "", 0, false
+	}
+	count, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return "", 0, false
+	}
+	return strings.ToUpper(parts[0]), count, true
+}
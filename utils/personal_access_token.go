@@ -0,0 +1,169 @@
+// utils/personal_access_token.go
+package utils
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"social-experiment/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PersonalAccessTokenPrefix marks personal access tokens so they can be told
+// apart from JWTs and recognised by secret scanners.
+const PersonalAccessTokenPrefix = "sxp_"
+
+// personalTokenPrefixLength is how much of the token is kept in clear for display.
+const personalTokenPrefixLength = len(PersonalAccessTokenPrefix) + 8
+
+// personalTokenTouchInterval limits how often last-used is written for a busy token.
+const personalTokenTouchInterval = time.Minute
+
+// ErrPersonalAccessTokenInvalid is returned for unknown, expired or revoked tokens.
+var ErrPersonalAccessTokenInvalid = errors.New("invalid personal access token")
+
+// PersonalAccessTokenStore persists hashed personal access tokens.
+type PersonalAccessTokenStore struct {
+	coll *mongo.Collection
+}
+
+// NewPersonalAccessTokenStore initializes a new PersonalAccessTokenStore backed by the given collection.
+func NewPersonalAccessTokenStore(coll *mongo.Collection) *PersonalAccessTokenStore {
+	return &PersonalAccessTokenStore{coll: coll}
+}
+
+// EnsureIndexes creates the lookup indexes.
+func (s *PersonalAccessTokenStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	})
+	return err
+}
+
+// IsPersonalAccessToken reports whether a bearer token looks like a personal access token.
+func IsPersonalAccessToken(token string) bool {
+	return strings.HasPrefix(token, PersonalAccessTokenPrefix)
+}
+
+// Create stores a new token for the user and returns the raw token with its record.
+func (s *PersonalAccessTokenStore) Create(ctx context.Context, userID primitive.ObjectID, name string, scopes []string, expiresAt *time.Time) (string, *models.PersonalAccessToken, error) {
+	secret, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", nil, err
+	}
+	token := PersonalAccessTokenPrefix + secret
+
+	record := &models.PersonalAccessToken{
+		ID:        primitive.NewObjectID(),
+		UserID:    userID,
+		Name:      name,
+		TokenHash: HashToken(token),
+		Prefix:    token[:personalTokenPrefixLength],
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+	if _, err := s.coll.InsertOne(ctx, record); err != nil {
+		return "", nil, err
+	}
+	return token, record, nil
+}
+
+// List returns the user's tokens that have not been revoked, newest first.
+func (s *PersonalAccessTokenStore) List(ctx context.Context, userID primitive.ObjectID) ([]models.PersonalAccessToken, error) {
+	cursor, err := s.coll.Find(ctx,
+		bson.M{"user_id": userID, "revoked_at": nil},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	tokens := []models.PersonalAccessToken{}
+	if err := cursor.All(ctx, &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// Lookup returns the record of a valid token and records that it was used.
+func (s *PersonalAccessTokenStore) Lookup(ctx context.Context, token string) (*models.PersonalAccessToken, error) {
+	now := time.Now()
+	var record models.PersonalAccessToken
+	err := s.coll.FindOne(ctx, bson.M{
+		"token_hash": HashToken(token),
+		"revoked_at": nil,
+		"$or": []bson.M{
+			{"expires_at": nil},
+			{"expires_at": bson.M{"$gt": now}},
+		},
+	}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrPersonalAccessTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if record.LastUsedAt == nil || record.LastUsedAt.Before(now.Add(-personalTokenTouchInterval)) {
+		_, err := s.coll.UpdateOne(ctx,
+			bson.M{"_id": record.ID},
+			bson.M{"$set": bson.M{"last_used_at": now}},
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &record, nil
+}
+
+// Revoke revokes one of the user's tokens. It returns false if the user has no such token.
+func (s *PersonalAccessTokenStore) Revoke(ctx context.Context, userID, tokenID primitive.ObjectID) (bool, error) {
+	result, err := s.coll.UpdateOne(ctx,
+		bson.M{"_id": tokenID, "user_id": userID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// IsActive reports whether the token with the given ID is neither revoked nor expired.
+func (s *PersonalAccessTokenStore) IsActive(ctx context.Context, tokenID primitive.ObjectID) (bool, error) {
+	count, err := s.coll.CountDocuments(ctx, bson.M{
+		"_id":        tokenID,
+		"revoked_at": nil,
+		"$or": []bson.M{
+			{"expires_at": nil},
+			{"expires_at": bson.M{"$gt": time.Now()}},
+		},
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// RevokeUser revokes every token belonging to the user.
+func (s *PersonalAccessTokenStore) RevokeUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.coll.UpdateMany(ctx,
+		bson.M{"user_id": userID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// DeleteUser deletes every token belonging to the user.
+func (s *PersonalAccessTokenStore) DeleteUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.coll.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
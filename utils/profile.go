@@ -0,0 +1,122 @@
+// utils/profile.go
+package utils
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// Profile field limits, in characters
+const (
+	MaxDisplayNameLength = 50
+	MaxBioLength         = 300
+	MaxLocationLength    = 100
+	MaxProfileURLLength  = 2048
+)
+
+// ProfileUpdate holds the profile fields a user wants to change. Fields left
+// out are kept; empty strings clear them.
+type ProfileUpdate struct {
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	AvatarURL   *string `json:"avatar_url"`
+	Website     *string `json:"website"`
+	Location    *string `json:"location"`
+}
+
+// ProfileError describes why a profile field was rejected.
+type ProfileError struct {
+	Field   string
+	Message string
+}
+
+func (e *ProfileError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// Changes validates and sanitizes the update and returns the fields to set and
+// the fields to unset.
+func (u *ProfileUpdate) Changes() (bson.M, bson.M, error) {
+	set := bson.M{}
+	unset := bson.M{}
+
+	fields := []struct {
+		name  string
+		value *string
+		clean func(string) (string, error)
+	}{
+		{"display_name", u.DisplayName, profileText(MaxDisplayNameLength, false)},
+		{"bio", u.Bio, profileText(MaxBioLength, true)},
+		{"avatar_url", u.AvatarURL, profileURL(true)},
+		{"website", u.Website, profileURL(false)},
+		{"location", u.Location, profileText(MaxLocationLength, false)},
+	}
+	for _, field := range fields {
+		if field.value == nil {
+			continue
+		}
+		value, err := field.clean(strings.TrimSpace(*field.value))
+		if err != nil {
+			return nil, nil, &ProfileError{Field: field.name, Message: err.Error()}
+		}
+		if value == "" {
+			unset[field.name] = ""
+		} else {
+			set[field.name] = value
+		}
+	}
+	return set, unset, nil
+}
+
+// profileText accepts up to max characters of text without control or
+// direction-changing characters, allowing line breaks if multiline is set.
+func profileText(max int, multiline bool) func(string) (string, error) {
+	return func(value string) (string, error) {
+		if multiline {
+			value = strings.ReplaceAll(value, "\r\n", "\n")
+		}
+		if utf8.RuneCountInString(value) > max {
+			return "", fmt.Errorf("must be at most %d characters", max)
+		}
+		for _, r := range value {
+			if r == '\n' && multiline {
+				continue
+			}
+			if unicode.IsControl(r) || unicode.Is(unicode.Bidi_Control, r) {
+				return "", fmt.Errorf("contains invalid characters")
+			}
+		}
+		return SanitizeInput(value), nil
+	}
+}
+
+// profileURL accepts absolute https URLs, and http URLs unless secureOnly is
+// set. Images must be served over https to avoid mixed content.
+func profileURL(secureOnly bool) func(string) (string, error) {
+	return func(value string) (string, error) {
+		if value == "" {
+			return "", nil
+		}
+		if len(value) > MaxProfileURLLength {
+			return "", fmt.Errorf("must be at most %d characters", MaxProfileURLLength)
+		}
+		u, err := url.Parse(value)
+		if err != nil || u.Host == "" || u.User != nil {
+			return "", fmt.Errorf("must be an absolute URL")
+		}
+		switch {
+		case u.Scheme == "https":
+		case u.Scheme == "http" && !secureOnly:
+		case secureOnly:
+			return "", fmt.Errorf("must be an https URL")
+		default:
+			return "", fmt.Errorf("must be an http or https URL")
+		}
+		return u.String(), nil
+	}
+}
@@ -0,0 +1,57 @@
+// utils/rbac.go
+package utils
+
+// Roles that can be assigned to users. Users without a role have the default
+// permissions every account gets.
+const (
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+)
+
+// Permissions guarding privileged endpoints
+const (
+	PermissionManageInvites  = "invites:manage"
+	PermissionManageLockouts = "lockouts:manage"
+	PermissionManageRoles    = "roles:manage"
+	PermissionModeratePosts  = "posts:moderate"
+)
+
+// rolePermissions maps each role to the permissions it grants.
+var rolePermissions = map[string][]string{
+	RoleAdmin: {
+		PermissionManageInvites,
+		PermissionManageLockouts,
+		PermissionManageRoles,
+		PermissionModeratePosts,
+	},
+	RoleModerator: {
+		PermissionModeratePosts,
+	},
+}
+
+// IsKnownRole reports whether the role exists.
+func IsKnownRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RolesHavePermission reports whether any of the roles grants the permission.
+func RolesHavePermission(roles []string, permission string) bool {
+	for _, role := range roles {
+		for _, granted := range rolePermissions[role] {
+			if granted == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether the token's roles grant the permission.
+// Scoped tokens never act with the user's privileges.
+func (c *Claims) HasPermission(permission string) bool {
+	if c.IsScoped() {
+		return false
+	}
+	return RolesHavePermission(c.Roles, permission)
+}
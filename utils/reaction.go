@@ -0,0 +1,30 @@
+// utils/reaction.go
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+// Reactions are the emoji users can react to posts with. The heart doubles
+// as a like.
+var Reactions = []string{"❤️", "👍", "👎", "😂", "😮", "😢", "🎉", "🙏"}
+
+// ErrUnknownReaction is returned for emoji that are not in Reactions.
+var ErrUnknownReaction = errors.New("unknown reaction")
+
+// ParseReaction returns the reaction as listed in Reactions. Variation
+// selectors are ignored, since clients disagree on whether to send them.
+func ParseReaction(emoji string) (string, error) {
+	emoji = stripVariationSelector(strings.TrimSpace(emoji))
+	for _, reaction := range Reactions {
+		if stripVariationSelector(reaction) == emoji {
+			return reaction, nil
+		}
+	}
+	return "", ErrUnknownReaction
+}
+
+func stripVariationSelector(s string) string {
+	return strings.ReplaceAll(s, "\uFE0F", "")
+}
@@ -0,0 +1,325 @@
+// utils/refresh_token.go
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"social-experiment/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var (
+	// ErrRefreshTokenInvalid is returned for unknown, expired or revoked refresh tokens.
+	ErrRefreshTokenInvalid = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused is returned when an already rotated refresh token is presented again.
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+)
+
+// RefreshTokenStore persists hashed refresh tokens and rotates them on use.
+type RefreshTokenStore struct {
+	coll *mongo.Collection
+	ttl  time.Duration
+}
+
+// NewRefreshTokenStore initializes a new RefreshTokenStore backed by the given collection.
+func NewRefreshTokenStore(coll *mongo.Collection, ttl time.Duration) *RefreshTokenStore {
+	return &RefreshTokenStore{coll: coll, ttl: ttl}
+}
+
+// EnsureIndexes creates the lookup indexes and the TTL index that purges expired tokens.
+func (s *RefreshTokenStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "family_id", Value: 1}}},
+		{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// Issue stores a new refresh token for the user in the given family and returns the raw token.
+func (s *RefreshTokenStore) Issue(ctx context.Context, userID, familyID primitive.ObjectID) (string, error) {
+	return s.IssueScoped(ctx, userID, familyID, nil)
+}
+
+// IssueScoped is like Issue for tokens limited to the given scopes. Rotating
+// the token carries its scopes over to the successor.
+func (s *RefreshTokenStore) IssueScoped(ctx context.Context, userID, familyID primitive.ObjectID, scopes []string) (string, error) {
+	token, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	record := models.RefreshToken{
+		ID:        primitive.NewObjectID(),
+		TokenHash: HashToken(token),
+		UserID:    userID,
+		FamilyID:  familyID,
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.ttl),
+	}
+	if _, err := s.coll.InsertOne(ctx, record); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// Rotate consumes a refresh token and issues its successor in the same family.
+// Presenting a token that was already consumed revokes the whole family.
+func (s *RefreshTokenStore) Rotate(ctx context.Context, token string) (string, *models.RefreshToken, error) {
+	hash := HashToken(token)
+	now := time.Now()
+
+	// Atomically mark the token as used so concurrent replays cannot both succeed
+	var current models.RefreshToken
+	err := s.coll.FindOneAndUpdate(ctx,
+		bson.M{
+			"token_hash": hash,
+			"used_at":    nil,
+			"revoked_at": nil,
+			"expires_at": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&current)
+	if err == mongo.ErrNoDocuments {
+		return "", nil, s.classifyRejected(ctx, hash)
+	}
+	if err != nil {
+		return "", nil, err
+	}
+
+	next, err := s.IssueScoped(ctx, current.UserID, current.FamilyID, current.Scopes)
+	if err != nil {
+		return "", nil, err
+	}
+	return next, &current, nil
+}
+
+// Lookup returns the record of a refresh token that can still be rotated
+// without consuming it.
+func (s *RefreshTokenStore) Lookup(ctx context.Context, token string) (*models.RefreshToken, error) {
+	var record models.RefreshToken
+	err := s.coll.FindOne(ctx, bson.M{
+		"token_hash": HashToken(token),
+		"used_at":    nil,
+		"revoked_at": nil,
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// classifyRejected determines why a token could not be rotated and revokes its
+// family when the token had already been used.
+func (s *RefreshTokenStore) classifyRejected(ctx context.Context, hash string) error {
+	var existing models.RefreshToken
+	err := s.coll.FindOne(ctx, bson.M{"token_hash": hash}).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return err
+	}
+	if existing.UsedAt == nil {
+		return ErrRefreshTokenInvalid
+	}
+
+	log.Printf("[WARNING] Refresh token reuse detected, revoking family %s (UserID: %s)", existing.FamilyID.Hex(), existing.UserID.Hex())
+	if err := s.RevokeFamily(ctx, existing.FamilyID); err != nil {
+		return err
+	}
+	return ErrRefreshTokenReused
+}
+
+// RevokeFamily revokes every outstanding token descended from the same login.
+func (s *RefreshTokenStore) RevokeFamily(ctx context.Context, familyID primitive.ObjectID) error {
+	_, err := s.coll.UpdateMany(ctx,
+		bson.M{"family_id": familyID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// RevokeToken revokes the family of the given refresh token if it belongs to
+// the user and returns the family ID.
+func (s *RefreshTokenStore) RevokeToken(ctx context.Context, token string, userID primitive.ObjectID) (primitive.ObjectID, error) {
+	var existing models.RefreshToken
+	err := s.coll.FindOne(ctx, bson.M{"token_hash": HashToken(token), "user_id": userID}).Decode(&existing)
+	if err == mongo.ErrNoDocuments {
+		return primitive.NilObjectID, ErrRefreshTokenInvalid
+	}
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	return existing.FamilyID, s.RevokeFamily(ctx, existing.FamilyID)
+}
+
+// RevokeUser revokes every outstanding refresh token belonging to the user.
+func (s *RefreshTokenStore) RevokeUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.coll.UpdateMany(ctx,
+		bson.M{"user_id": userID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// DeleteUser deletes every refresh token belonging to the user.
+func (s *RefreshTokenStore) DeleteUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.coll.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// TokenPair is the access/refresh token pair returned to clients.
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// TwoFactorChallengeTTL is how long a user has to complete the second login step.
+const TwoFactorChallengeTTL = 5 * time.Minute
+
+// TokenIssuer mints access tokens together with rotating refresh tokens. Each
+// login starts a session whose ID doubles as the refresh token family. Access
+// tokens carry the user's roles as they are when the token is minted.
+type TokenIssuer struct {
+	keys          *KeyRing
+	accessTTL     time.Duration
+	refreshTokens *RefreshTokenStore
+	sessions      *SessionStore
+	users         *mongo.Collection
+}
+
+// NewTokenIssuer initializes a new TokenIssuer.
+func NewTokenIssuer(keys *KeyRing, accessTTL time.Duration, refreshTokens *RefreshTokenStore, sessions *SessionStore, users *mongo.Collection) *TokenIssuer {
+	return &TokenIssuer{
+		keys:          keys,
+		accessTTL:     accessTTL,
+		refreshTokens: refreshTokens,
+		sessions:      sessions,
+		users:         users,
+	}
+}
+
+// Issue starts a new session for the user and returns its token pair.
+func (ti *TokenIssuer) Issue(ctx context.Context, userID primitive.ObjectID, info SessionInfo) (*TokenPair, error) {
+	session, err := ti.sessions.Create(ctx, userID, info)
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := ti.refreshTokens.Issue(ctx, userID, session.ID)
+	if err != nil {
+		return nil, err
+	}
+	return ti.pair(ctx, userID, session.ID, refreshToken)
+}
+
+// Refresh rotates the presented refresh token and returns a fresh token pair
+// for the same session.
+func (ti *TokenIssuer) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	next, current, err := ti.refreshTokens.Rotate(ctx, refreshToken)
+	if err != nil {
+		return nil, err
+	}
+	if err := ti.sessions.Extend(ctx, current.FamilyID); err != nil {
+		log.Printf("[ERROR] Error extending session %s: %v", current.FamilyID.Hex(), err)
+	}
+	pair, err := ti.pair(ctx, current.UserID, current.FamilyID, next)
+	if err == mongo.ErrNoDocuments {
+		// The account no longer exists
+		return nil, ErrRefreshTokenInvalid
+	}
+	return pair, err
+}
+
+// RevokeSession ends one of the user's sessions and its refresh tokens. It
+// returns false if the user has no such active session.
+func (ti *TokenIssuer) RevokeSession(ctx context.Context, userID, sessionID primitive.ObjectID) (bool, error) {
+	revoked, err := ti.sessions.Revoke(ctx, userID, sessionID)
+	if err != nil || !revoked {
+		return revoked, err
+	}
+	return true, ti.refreshTokens.RevokeFamily(ctx, sessionID)
+}
+
+// RevokeRefreshToken ends the session the given refresh token belongs to and
+// returns its ID.
+func (ti *TokenIssuer) RevokeRefreshToken(ctx context.Context, refreshToken string, userID primitive.ObjectID) (primitive.ObjectID, error) {
+	sessionID, err := ti.refreshTokens.RevokeToken(ctx, refreshToken, userID)
+	if err != nil {
+		return sessionID, err
+	}
+	_, err = ti.sessions.Revoke(ctx, userID, sessionID)
+	return sessionID, err
+}
+
+// RevokeUser ends every session of the user and revokes all of their refresh tokens.
+func (ti *TokenIssuer) RevokeUser(ctx context.Context, userID primitive.ObjectID) error {
+	if err := ti.sessions.RevokeUser(ctx, userID); err != nil {
+		return err
+	}
+	return ti.refreshTokens.RevokeUser(ctx, userID)
+}
+
+// DeleteUser deletes every session and refresh token of the user.
+func (ti *TokenIssuer) DeleteUser(ctx context.Context, userID primitive.ObjectID) error {
+	if err := ti.sessions.DeleteUser(ctx, userID); err != nil {
+		return err
+	}
+	return ti.refreshTokens.DeleteUser(ctx, userID)
+}
+
+// IssueChallenge returns a token proving the user passed the password step of a
+// two-factor login.
+func (ti *TokenIssuer) IssueChallenge(userID primitive.ObjectID) (string, error) {
+	return GenerateChallengeJWT(userID.Hex(), ti.keys, TwoFactorChallengeTTL)
+}
+
+// VerifyChallenge validates a two-factor challenge token and returns its claims.
+func (ti *TokenIssuer) VerifyChallenge(token string) (*Claims, error) {
+	claims, err := ValidateJWT(token, ti.keys)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != PurposeTwoFactor {
+		return nil, errors.New("not a two-factor challenge token")
+	}
+	return claims, nil
+}
+
+func (ti *TokenIssuer) pair(ctx context.Context, userID, sessionID primitive.ObjectID, refreshToken string) (*TokenPair, error) {
+	var user models.User
+	err := ti.users.FindOne(ctx,
+		bson.M{"_id": userID},
+		options.FindOne().SetProjection(bson.M{"roles": 1}),
+	).Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken, err := GenerateJWT(userID.Hex(), sessionID.Hex(), user.Roles, ti.keys, ti.accessTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(ti.accessTTL.Seconds()),
+	}, nil
+}
@@ -0,0 +1,95 @@
+// utils/revocation.go
+package utils
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RevocationList records access tokens that must be rejected before they expire.
+// Entries are a single token (by jti), every token of a session (by sid) or
+// every token a user was issued before a point in time. Each entry expires together with the tokens it covers.
+type RevocationList struct {
+	coll      *mongo.Collection
+	accessTTL time.Duration
+}
+
+// NewRevocationList initializes a new RevocationList backed by the given collection.
+func NewRevocationList(coll *mongo.Collection, accessTTL time.Duration) *RevocationList {
+	return &RevocationList{coll: coll, accessTTL: accessTTL}
+}
+
+// EnsureIndexes creates the lookup indexes and the TTL index matching token expiry.
+func (rl *RevocationList) EnsureIndexes(ctx context.Context) error {
+	_, err := rl.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "jti", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "session_id", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "issued_before", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// RevokeToken revokes a single access token until it would have expired anyway.
+func (rl *RevocationList) RevokeToken(ctx context.Context, claims *Claims) error {
+	_, err := rl.coll.InsertOne(ctx, bson.M{
+		"jti":        claims.Id,
+		"user_id":    claims.UserID,
+		"expires_at": time.Unix(claims.ExpiresAt, 0),
+	})
+	return err
+}
+
+// RevokeSession revokes every access token issued to the session up to now.
+func (rl *RevocationList) RevokeSession(ctx context.Context, sessionID string) error {
+	_, err := rl.coll.InsertOne(ctx, bson.M{
+		"session_id": sessionID,
+		"expires_at": time.Now().Add(rl.accessTTL),
+	})
+	return err
+}
+
+// RevokeUser revokes every access token issued to the user up to now. Tokens
+// issued from now on, even within the same second, remain valid.
+func (rl *RevocationList) RevokeUser(ctx context.Context, userID string) error {
+	now := revocationTime(time.Now())
+	_, err := rl.coll.InsertOne(ctx, bson.M{
+		"user_id":       userID,
+		"issued_before": now,
+		"expires_at":    now.Add(rl.accessTTL),
+	})
+	return err
+}
+
+// revocationTime truncates t to the millisecond precision of stored dates and
+// of IssuedAtMs.
+func revocationTime(t time.Time) time.Time {
+	return t.Truncate(time.Millisecond)
+}
+
+// userRevocationFilter matches the user-wide revocations recorded after the
+// token described by claims was issued.
+func userRevocationFilter(claims *Claims) bson.M {
+	return bson.M{"user_id": claims.UserID, "issued_before": bson.M{"$gt": claims.IssuedTime()}}
+}
+
+// IsRevoked reports whether the token described by claims has been revoked.
+func (rl *RevocationList) IsRevoked(ctx context.Context, claims *Claims) (bool, error) {
+	conditions := []bson.M{
+		{"jti": claims.Id},
+		userRevocationFilter(claims),
+	}
+	if claims.SessionID != "" {
+		conditions = append(conditions, bson.M{"session_id": claims.SessionID})
+	}
+
+	count, err := rl.coll.CountDocuments(ctx, bson.M{"$or": conditions}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
@@ -0,0 +1,83 @@
+// utils/revocation_test.go
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// revokedBy reports whether a user-wide revocation recorded at issuedBefore
+// matches the filter, as MongoDB would evaluate its $gt condition.
+func revokedBy(t *testing.T, filter bson.M, issuedBefore time.Time) bool {
+	t.Helper()
+	condition, ok := filter["issued_before"].(bson.M)
+	if !ok {
+		t.Fatalf("filter has no issued_before condition: %v", filter)
+	}
+	after, ok := condition["$gt"].(time.Time)
+	if !ok {
+		t.Fatalf("issued_before condition is not $gt a time: %v", condition)
+	}
+	return issuedBefore.After(after)
+}
+
+func TestUserRevocationSameSecond(t *testing.T) {
+	second := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	revokedAt := revocationTime(second.Add(400*time.Millisecond + 123*time.Microsecond))
+
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		revoked  bool
+	}{
+		{"issued in an earlier second", second.Add(-300 * time.Millisecond), true},
+		{"issued earlier in the same second", second.Add(100 * time.Millisecond), true},
+		{"issued later in the same second", second.Add(700 * time.Millisecond), false},
+		{"issued in a later second", second.Add(1200 * time.Millisecond), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims := &Claims{UserID: "user", IssuedAtMs: tt.issuedAt.UnixMilli()}
+			claims.IssuedAt = tt.issuedAt.Unix()
+			if got := revokedBy(t, userRevocationFilter(claims), revokedAt); got != tt.revoked {
+				t.Errorf("revoked = %v, want %v", got, tt.revoked)
+			}
+		})
+	}
+}
+
+func TestUserRevocationThenIssue(t *testing.T) {
+	keys, err := LoadKeyRing(Config{JWTSecret: "test-secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revokedAt := revocationTime(time.Now())
+	token, err := GenerateJWT("user", "", nil, keys, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ValidateJWT(token, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claims.IssuedAtMs == 0 {
+		t.Fatal("token carries no millisecond issue time")
+	}
+	if revokedBy(t, userRevocationFilter(claims), revokedAt) {
+		t.Error("token issued after the revocation is revoked")
+	}
+}
+
+func TestUserRevocationLegacyToken(t *testing.T) {
+	issuedAt := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	claims := &Claims{UserID: "user"}
+	claims.IssuedAt = issuedAt.Unix()
+
+	if !revokedBy(t, userRevocationFilter(claims), issuedAt.Add(500*time.Millisecond)) {
+		t.Error("token without a millisecond issue time is not revoked by a later revocation")
+	}
+}
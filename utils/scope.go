@@ -0,0 +1,67 @@
+// utils/scope.go
+package utils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Scopes that can be granted to tokens acting on a user's behalf
+const (
+	ScopePostsRead    = "posts:read"
+	ScopePostsWrite   = "posts:write"
+	ScopeProfileRead  = "profile:read"
+	ScopeProfileWrite = "profile:write"
+	ScopeWSSubscribe  = "ws:subscribe"
+)
+
+// KnownScopes lists every grantable scope.
+var KnownScopes = []string{ScopePostsRead, ScopePostsWrite, ScopeProfileRead, ScopeProfileWrite, ScopeWSSubscribe}
+
+// NormalizeScopes validates the requested scopes and returns them sorted and
+// de-duplicated.
+func NormalizeScopes(scopes []string) ([]string, error) {
+	seen := make(map[string]bool)
+	normalized := []string{}
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if !isKnownScope(scope) {
+			return nil, fmt.Errorf("unknown scope %q", scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			normalized = append(normalized, scope)
+		}
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+func isKnownScope(scope string) bool {
+	for _, known := range KnownScopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+// IsScoped reports whether the token is limited to the scopes it carries.
+// Interactive session tokens carry no scope and are not restricted.
+func (c *Claims) IsScoped() bool {
+	return c.Scope != ""
+}
+
+// HasScope reports whether the token grants the scope.
+func (c *Claims) HasScope(scope string) bool {
+	if !c.IsScoped() {
+		return true
+	}
+	for _, granted := range strings.Fields(c.Scope) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
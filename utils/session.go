@@ -0,0 +1,175 @@
+// utils/session.go
+package utils
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"social-experiment/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// sessionTouchInterval limits how often last-seen is written for a busy session.
+const sessionTouchInterval = time.Minute
+
+// SessionInfo describes the device a session is created for.
+type SessionInfo struct {
+	DeviceLabel string
+	UserAgent   string
+	IP          string
+}
+
+// SessionStore persists signed-in devices. Sessions live as long as their
+// refresh token family and are extended whenever it is rotated.
+type SessionStore struct {
+	coll *mongo.Collection
+	ttl  time.Duration
+}
+
+// NewSessionStore initializes a new SessionStore backed by the given collection.
+func NewSessionStore(coll *mongo.Collection, ttl time.Duration) *SessionStore {
+	return &SessionStore{coll: coll, ttl: ttl}
+}
+
+// EnsureIndexes creates the lookup index and the TTL index that purges expired sessions.
+func (s *SessionStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "last_seen_at", Value: -1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// Create records a new session for the user.
+func (s *SessionStore) Create(ctx context.Context, userID primitive.ObjectID, info SessionInfo) (*models.Session, error) {
+	now := time.Now()
+	label := info.DeviceLabel
+	if label == "" {
+		label = DescribeUserAgent(info.UserAgent)
+	}
+
+	session := &models.Session{
+		ID:          primitive.NewObjectID(),
+		UserID:      userID,
+		DeviceLabel: label,
+		UserAgent:   info.UserAgent,
+		IP:          info.IP,
+		CreatedAt:   now,
+		LastSeenAt:  now,
+		ExpiresAt:   now.Add(s.ttl),
+	}
+	if _, err := s.coll.InsertOne(ctx, session); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// List returns the user's active sessions, most recently used first.
+func (s *SessionStore) List(ctx context.Context, userID primitive.ObjectID) ([]models.Session, error) {
+	cursor, err := s.coll.Find(ctx,
+		bson.M{"user_id": userID, "revoked_at": nil, "expires_at": bson.M{"$gt": time.Now()}},
+		options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	sessions := []models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Touch records activity on a session. Writes are skipped if the session was
+// seen within the last minute.
+func (s *SessionStore) Touch(ctx context.Context, sessionID primitive.ObjectID, ip string) error {
+	now := time.Now()
+	_, err := s.coll.UpdateOne(ctx,
+		bson.M{"_id": sessionID, "revoked_at": nil, "last_seen_at": bson.M{"$lt": now.Add(-sessionTouchInterval)}},
+		bson.M{"$set": bson.M{"last_seen_at": now, "ip": ip}},
+	)
+	return err
+}
+
+// Extend records activity and pushes back expiry after the session's refresh token was rotated.
+func (s *SessionStore) Extend(ctx context.Context, sessionID primitive.ObjectID) error {
+	now := time.Now()
+	_, err := s.coll.UpdateOne(ctx,
+		bson.M{"_id": sessionID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"last_seen_at": now, "expires_at": now.Add(s.ttl)}},
+	)
+	return err
+}
+
+// Revoke marks one of the user's sessions as revoked. It returns false if the
+// user has no such active session.
+func (s *SessionStore) Revoke(ctx context.Context, userID, sessionID primitive.ObjectID) (bool, error) {
+	result, err := s.coll.UpdateOne(ctx,
+		bson.M{"_id": sessionID, "user_id": userID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+// RevokeUser marks every session of the user as revoked.
+func (s *SessionStore) RevokeUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.coll.UpdateMany(ctx,
+		bson.M{"user_id": userID, "revoked_at": nil},
+		bson.M{"$set": bson.M{"revoked_at": time.Now()}},
+	)
+	return err
+}
+
+// DeleteUser deletes every session of the user, including the devices and
+// addresses they were used from.
+func (s *SessionStore) DeleteUser(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := s.coll.DeleteMany(ctx, bson.M{"user_id": userID})
+	return err
+}
+
+// DescribeUserAgent derives a short device label such as "Firefox on Linux"
+// from a User-Agent header.
+func DescribeUserAgent(userAgent string) string {
+	if userAgent == "" {
+		return "Unknown device"
+	}
+
+	browser := "Unknown browser"
+	for _, candidate := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			browser = candidate.name
+			break
+		}
+	}
+
+	for _, candidate := range []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(userAgent, candidate.token) {
+			return browser + " on " + candidate.name
+		}
+	}
+	return browser
+}
@@ -0,0 +1,135 @@
+// utils/totp.go
+package utils
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"image/png"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+)
+
+// TOTP parameters (RFC 6238 defaults understood by every authenticator app)
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	totpSkew   = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// recoveryCodeBytes is the entropy of a recovery code: 80 bits, so that its
+// unsalted hash cannot be brute-forced.
+const recoveryCodeBytes = 10
+
+// GenerateTOTPSecret returns a new random base32-encoded TOTP secret.
+func GenerateTOTPSecret() (string, error) {
+	b := make([]byte, 20)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(b), nil
+}
+
+// TOTPURI returns the otpauth:// provisioning URI for an authenticator app.
+func TOTPURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(totpDigits))
+	v.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// TOTPQRCode renders the provisioning URI as a PNG QR code.
+func TOTPQRCode(uri string) ([]byte, error) {
+	code, err := qr.Encode(uri, qr.M, qr.Auto)
+	if err != nil {
+		return nil, err
+	}
+	code, err = barcode.Scale(code, 256, 256)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, code); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// ValidateTOTP checks a code against the secret, allowing one step of clock skew.
+// It returns the matched time step, which callers persist so that a code cannot
+// be replayed: only steps greater than lastStep are accepted.
+func ValidateTOTP(secret, code string, now time.Time, lastStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if subtle.ConstantTimeCompare([]byte(totpCode(key, step)), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// totpCode computes the HOTP value (RFC 4226) for the given counter.
+func totpCode(key []byte, counter int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(counter))
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// GenerateRecoveryCodes returns n one-time recovery codes and their hashes for
+// storage. Codes are written in groups of four characters, like abcd-efgh-ijkl-mnop.
+func GenerateRecoveryCodes(n int) ([]string, []string, error) {
+	codes := make([]string, n)
+	hashes := make([]string, n)
+	for i := range codes {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(b))
+		groups := make([]string, 0, len(raw)/4+1)
+		for len(raw) > 4 {
+			groups = append(groups, raw[:4])
+			raw = raw[4:]
+		}
+		codes[i] = strings.Join(append(groups, raw), "-")
+		hashes[i] = HashRecoveryCode(codes[i])
+	}
+	return codes, hashes, nil
+}
+
+// HashRecoveryCode normalizes and hashes a recovery code as entered by the user.
+func HashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	return HashToken(code)
+}
@@ -0,0 +1,35 @@
+// utils/totp_test.go
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, hashes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(codes) != 10 || len(hashes) != 10 {
+		t.Fatalf("got %d codes and %d hashes, want 10 each", len(codes), len(hashes))
+	}
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		// Each base32 character carries 5 bits
+		if bits := 5 * len(strings.ReplaceAll(code, "-", "")); bits < 80 {
+			t.Errorf("code %q carries %d bits, want at least 80", code, bits)
+		}
+		if seen[code] {
+			t.Errorf("duplicate code %q", code)
+		}
+		seen[code] = true
+
+		// Codes are accepted as typed, in any case and without dashes
+		entered := " " + strings.ToUpper(strings.ReplaceAll(code, "-", "")) + " "
+		if HashRecoveryCode(entered) != hashes[i] {
+			t.Errorf("code %q entered as %q does not match its hash", code, entered)
+		}
+	}
+}
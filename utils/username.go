@@ -0,0 +1,163 @@
+// utils/username.go
+package utils
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Username length limits, in characters
+const (
+	MinUsernameLength = 3
+	MaxUsernameLength = 30
+)
+
+// ReservedUsernames cannot be registered or taken by renaming an account, in
+// addition to the names listed in RESERVED_USERNAMES. They are matched by
+// skeleton, so lookalikes are reserved too.
+var ReservedUsernames = []string{
+	"about", "account", "admin", "administrator", "anonymous", "api", "auth",
+	"deleted", "email", "everyone", "help", "here", "login", "logout", "mail",
+	"me", "mod", "moderator", "null", "oauth", "owner", "posts", "privacy",
+	"register", "root", "security", "settings", "signup", "staff", "support",
+	"system", "terms", "undefined", "users", "webmaster", "ws", "www",
+}
+
+// Username validation errors
+var (
+	ErrUsernameRequired     = errors.New("username is required")
+	ErrUsernameLength       = errors.New("username has an invalid length")
+	ErrUsernameCharacters   = errors.New("username contains invalid characters")
+	ErrUsernameMixedScripts = errors.New("username mixes scripts")
+	ErrUsernameReserved     = errors.New("username is reserved")
+)
+
+// usernameScripts are the writing systems usernames may be written in. Han,
+// Hiragana and Katakana count as one so Japanese names can combine them.
+var usernameScripts = []struct {
+	name  string
+	table *unicode.RangeTable
+}{
+	{"Latin", unicode.Latin},
+	{"Cyrillic", unicode.Cyrillic},
+	{"Greek", unicode.Greek},
+	{"Armenian", unicode.Armenian},
+	{"Georgian", unicode.Georgian},
+	{"Hebrew", unicode.Hebrew},
+	{"Arabic", unicode.Arabic},
+	{"Devanagari", unicode.Devanagari},
+	{"Bengali", unicode.Bengali},
+	{"Tamil", unicode.Tamil},
+	{"Thai", unicode.Thai},
+	{"Hangul", unicode.Hangul},
+	{"Han", unicode.Han},
+	{"Han", unicode.Hiragana},
+	{"Han", unicode.Katakana},
+}
+
+// UsernamePolicy decides which usernames may be taken.
+type UsernamePolicy struct {
+	reserved map[string]bool
+}
+
+// NewUsernamePolicy initializes a UsernamePolicy with the built-in and the
+// configured reserved names.
+func NewUsernamePolicy(config Config) *UsernamePolicy {
+	reserved := make(map[string]bool)
+	for _, names := range [][]string{ReservedUsernames, config.ReservedUsernames} {
+		for _, name := range names {
+			if name = strings.TrimSpace(name); name != "" {
+				reserved[UsernameSkeleton(name)] = true
+			}
+		}
+	}
+	return &UsernamePolicy{reserved: reserved}
+}
+
+// Validate returns the username in NFKC form after checking that it may be
+// taken: 3 to 30 letters, digits, '_', '.' or '-' of a single script,
+// starting and ending with a letter or digit, and not reserved. Whether
+// another account uses it is up to the caller.
+func (p *UsernamePolicy) Validate(username string) (string, error) {
+	username = norm.NFKC.String(strings.TrimSpace(username))
+	if username == "" {
+		return "", ErrUsernameRequired
+	}
+	if length := utf8.RuneCountInString(username); length < MinUsernameLength || length > MaxUsernameLength {
+		return "", ErrUsernameLength
+	}
+
+	script := ""
+	runes := []rune(username)
+	for i, r := range runes {
+		switch {
+		case unicode.IsLetter(r):
+			s := usernameScript(r)
+			if s == "" {
+				return "", ErrUsernameCharacters
+			}
+			if script != "" && s != script {
+				return "", ErrUsernameMixedScripts
+			}
+			script = s
+		case r >= '0' && r <= '9':
+		case unicode.In(r, unicode.Mn, unicode.Mc) && i > 0 && unicode.In(runes[i-1], unicode.L, unicode.Mn, unicode.Mc):
+		case (r == '_' || r == '.' || r == '-') && i > 0 && i < len(runes)-1:
+		default:
+			return "", ErrUsernameCharacters
+		}
+	}
+
+	if p.IsReserved(username) {
+		return "", ErrUsernameReserved
+	}
+	return username, nil
+}
+
+// IsReserved reports whether the username looks like a reserved name.
+func (p *UsernamePolicy) IsReserved(username string) bool {
+	return p.reserved[UsernameSkeleton(username)]
+}
+
+// UsernameKey returns the canonical form usernames are looked up by: NFKC
+// with full case folding, so "Alice" and "ＡＬＩＣＥ" are the same account.
+func UsernameKey(username string) string {
+	return norm.NFKC.String(cases.Fold().String(norm.NFKC.String(username)))
+}
+
+// UsernameSkeleton returns the form under which lookalike usernames coincide,
+// such as "alice" and "аlice" with a Cyrillic "а", or "paypal" and "paypa1".
+// No two accounts may share a skeleton.
+func UsernameSkeleton(username string) string {
+	var b strings.Builder
+	previous := rune(0)
+	for _, r := range norm.NFD.String(UsernameKey(username)) {
+		// Accents on Latin lookalikes are easy to miss; marks in other
+		// scripts often distinguish letters and are kept
+		if unicode.Is(unicode.Mn, r) && previous < utf8.RuneSelf {
+			continue
+		}
+		if prototype, ok := confusables[r]; ok {
+			r = prototype
+		}
+		b.WriteRune(r)
+		previous = r
+	}
+	return confusableSequences.Replace(b.String())
+}
+
+// usernameScript returns the name of the script the letter belongs to, or ""
+// if usernames may not use it.
+func usernameScript(r rune) string {
+	for _, script := range usernameScripts {
+		if unicode.Is(script.table, r) {
+			return script.name
+		}
+	}
+	return ""
+}
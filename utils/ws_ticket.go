@@ -0,0 +1,103 @@
+// utils/ws_ticket.go
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"social-experiment/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// WebSocketTicketTTL is how long a client has to open the connection a ticket was issued for.
+const WebSocketTicketTTL = 30 * time.Second
+
+// ErrWebSocketTicketInvalid is returned for unknown, expired, used or misbound tickets.
+var ErrWebSocketTicketInvalid = errors.New("invalid WebSocket ticket")
+
+// WebSocketTicketStore issues and redeems single-use WebSocket tickets.
+type WebSocketTicketStore struct {
+	coll *mongo.Collection
+}
+
+// NewWebSocketTicketStore initializes a new WebSocketTicketStore backed by the given collection.
+func NewWebSocketTicketStore(coll *mongo.Collection) *WebSocketTicketStore {
+	return &WebSocketTicketStore{coll: coll}
+}
+
+// EnsureIndexes creates the lookup index and the TTL index that purges expired tickets.
+func (s *WebSocketTicketStore) EnsureIndexes(ctx context.Context) error {
+	_, err := s.coll.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "ticket_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	return err
+}
+
+// Issue returns a ticket that opens one connection with the rights of the
+// token described by claims, from the given origin only.
+func (s *WebSocketTicketStore) Issue(ctx context.Context, claims *Claims, origin string) (string, error) {
+	ticket, err := GenerateOpaqueToken()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	record := models.WebSocketTicket{
+		ID:             primitive.NewObjectID(),
+		TicketHash:     HashToken(ticket),
+		UserID:         claims.UserID,
+		TokenID:        claims.Id,
+		SessionID:      claims.SessionID,
+		ClientID:       claims.ClientID,
+		Scope:          claims.Scope,
+		TokenIssuedAt:  claims.IssuedAt,
+		TokenIssuedMs:  claims.IssuedAtMs,
+		PersonalToken:  claims.PersonalTokenID,
+		TokenExpiresAt: claims.ExpiresAt,
+		Origin:         origin,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(WebSocketTicketTTL),
+	}
+	if _, err := s.coll.InsertOne(ctx, record); err != nil {
+		return "", err
+	}
+	return ticket, nil
+}
+
+// Redeem consumes a ticket presented from the given origin and returns the
+// claims of the token it was issued with.
+func (s *WebSocketTicketStore) Redeem(ctx context.Context, ticket, origin string) (*Claims, error) {
+	var record models.WebSocketTicket
+	err := s.coll.FindOneAndDelete(ctx, bson.M{
+		"ticket_hash": HashToken(ticket),
+		"expires_at":  bson.M{"$gt": time.Now()},
+	}).Decode(&record)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrWebSocketTicketInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if record.Origin != origin {
+		return nil, ErrWebSocketTicketInvalid
+	}
+
+	claims := &Claims{
+		UserID:    record.UserID,
+		SessionID: record.SessionID,
+		ClientID:  record.ClientID,
+		Scope:     record.Scope,
+	}
+	claims.Id = record.TokenID
+	claims.IssuedAt = record.TokenIssuedAt
+	claims.IssuedAtMs = record.TokenIssuedMs
+	claims.PersonalTokenID = record.PersonalToken
+	claims.ExpiresAt = record.TokenExpiresAt
+	return claims, nil
+}
@@ -9,19 +9,23 @@ import (
 
 // Client represents a WebSocket client
 type Client struct {
-    hub    *Hub
-    conn   *websocket.Conn
-    send   chan []byte
-    UserID string
+    hub       *Hub
+    conn      *websocket.Conn
+    send      chan []byte
+    UserID    string
+    TokenID   string
+    SessionID string
 }
 
 // NewClient creates a new WebSocket client instance
-func NewClient(hub *Hub, conn *websocket.Conn, userID string) *Client {
+func NewClient(hub *Hub, conn *websocket.Conn, userID string, tokenID string, sessionID string) *Client {
     return &Client{
-        hub:    hub,
-        conn:   conn,
-        send:   make(chan []byte, 256),
-        UserID: userID,
+        hub:       hub,
+        conn:      conn,
+        send:      make(chan []byte, 256),
+        UserID:    userID,
+        TokenID:   tokenID,
+        SessionID: sessionID,
     }
 }
 
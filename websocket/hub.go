@@ -2,11 +2,12 @@
 package websocket
 
 import (
+    "context"
     "net/http"
     "encoding/json"
     "log"
-    "strings"
     "sync"
+    "time"
 
     "social-experiment/models"
     "social-experiment/utils"
@@ -19,25 +20,37 @@ import (
 type Hub struct {
     clients    map[*Client]bool
     broadcast  chan []byte
+    direct     chan userMessage
     register   chan *Client
     unregister chan *Client
+    disconnect chan func(*Client) bool
     mu         sync.Mutex
-    jwtSecret  string
+    reactions  map[string]map[string]int
+    auth       *utils.Authenticator
+    origins    []string
 }
 
-// NewHub initializes a new Hub with the provided JWT secret
-func NewHub(jwtSecret string) *Hub {
+// NewHub initializes a new Hub that authenticates connections with the provided
+// Authenticator and accepts browser connections from the allowed CORS origins
+func NewHub(auth *utils.Authenticator, allowedOrigins []string) *Hub {
     return &Hub{
         clients:    make(map[*Client]bool),
         broadcast:  make(chan []byte),
+        direct:     make(chan userMessage),
         register:   make(chan *Client),
         unregister: make(chan *Client),
-        jwtSecret:  jwtSecret,
+        disconnect: make(chan func(*Client) bool),
+        reactions:  make(map[string]map[string]int),
+        auth:       auth,
+        origins:    allowedOrigins,
     }
 }
 
 // Run starts the hub's event loop
 func (h *Hub) Run() {
+    ticker := time.NewTicker(ReactionUpdateInterval)
+    defer ticker.Stop()
+
     for {
         select {
         case client := <-h.register:
@@ -53,66 +66,205 @@ func (h *Hub) Run() {
                 log.Printf("[INFO] Client unregistered: %v (UserID: %s)", client.conn.RemoteAddr(), client.UserID)
             }
             h.mu.Unlock()
-        case message := <-h.broadcast:
+        case match := <-h.disconnect:
             h.mu.Lock()
             for client := range h.clients {
-                select {
-                case client.send <- message:
-                default:
-                    close(client.send)
+                if match(client) {
                     delete(h.clients, client)
-                    log.Printf("[WARNING] Client send channel full, removed client: %v (UserID: %s)", client.conn.RemoteAddr(), client.UserID)
+                    close(client.send)
+                    log.Printf("[INFO] Client disconnected: %v (UserID: %s)", client.conn.RemoteAddr(), client.UserID)
                 }
             }
             h.mu.Unlock()
+        case message := <-h.broadcast:
+            h.mu.Lock()
+            for client := range h.clients {
+                h.deliver(client, message)
+            }
+            h.mu.Unlock()
+        case message := <-h.direct:
+            h.mu.Lock()
+            for client := range h.clients {
+                if client.UserID == message.userID {
+                    h.deliver(client, message.data)
+                }
+            }
+            h.mu.Unlock()
+        case <-ticker.C:
+            h.flushReactions()
         }
     }
 }
 
+// deliver queues a message for the client, dropping clients that fall behind.
+// The caller must hold h.mu.
+func (h *Hub) deliver(client *Client, message []byte) {
+    select {
+    case client.send <- message:
+    default:
+        close(client.send)
+        delete(h.clients, client)
+        log.Printf("[WARNING] Client send channel full, removed client: %v (UserID: %s)", client.conn.RemoteAddr(), client.UserID)
+    }
+}
+
+// userMessage is a message for every connection of one user
+type userMessage struct {
+    userID string
+    data   []byte
+}
+
+// Types of the events sent to clients
+const (
+    EventPostCreated  = "post.created"
+    EventPostUpdated  = "post.updated"
+    EventPostDeleted  = "post.deleted"
+    EventReactions    = "post.reactions"
+    EventNotification = "notification"
+)
+
+// ReactionUpdateInterval is how often the reaction counts of a post are sent
+// at most; changes in between are combined into one event.
+const ReactionUpdateInterval = time.Second
+
+// Event is a message sent to clients. Deleted posts are sent as tombstones.
+// Notifications are only sent to the user they are for.
+type Event struct {
+    Type         string               `json:"type"`
+    Post         *models.Post         `json:"post,omitempty"`
+    Reactions    *ReactionCounts      `json:"reactions,omitempty"`
+    Notification *models.Notification `json:"notification,omitempty"`
+}
+
+// ReactionCounts are the current reaction counts of a post by emoji
+type ReactionCounts struct {
+    PostID string         `json:"post_id"`
+    Counts map[string]int `json:"counts"`
+}
+
 // BroadcastPost sends a new post to all connected clients
 func (h *Hub) BroadcastPost(post models.Post) {
-    postJSON, err := json.Marshal(post)
-    if err != nil {
-        log.Printf("[ERROR] Failed to marshal post: %v", err)
+    h.broadcastEvent(EventPostCreated, post)
+}
+
+// BroadcastPostUpdated sends an edited post to all connected clients
+func (h *Hub) BroadcastPostUpdated(post models.Post) {
+    h.broadcastEvent(EventPostUpdated, post)
+}
+
+// BroadcastPostDeleted sends the tombstone of a deleted post to all connected clients
+func (h *Hub) BroadcastPostDeleted(post models.Post) {
+    h.broadcastEvent(EventPostDeleted, post)
+}
+
+// BroadcastReactions queues the new reaction counts of a post for the next
+// reaction update sent to all connected clients
+func (h *Hub) BroadcastReactions(postID string, counts map[string]int) {
+    if counts == nil {
+        counts = map[string]int{}
+    }
+    h.mu.Lock()
+    h.reactions[postID] = counts
+    h.mu.Unlock()
+}
+
+// flushReactions sends the queued reaction counts to all connected clients
+func (h *Hub) flushReactions() {
+    h.mu.Lock()
+    defer h.mu.Unlock()
+    if len(h.reactions) == 0 {
         return
     }
-    h.broadcast <- postJSON
+
+    for postID, counts := range h.reactions {
+        eventJSON, err := json.Marshal(Event{Type: EventReactions, Reactions: &ReactionCounts{PostID: postID, Counts: counts}})
+        if err != nil {
+            log.Printf("[ERROR] Failed to marshal %s event: %v", EventReactions, err)
+            continue
+        }
+        for client := range h.clients {
+            h.deliver(client, eventJSON)
+        }
+    }
+    h.reactions = make(map[string]map[string]int)
 }
 
-// HandleWebSocket handles incoming WebSocket connections with JWT authentication
-func (h *Hub) HandleWebSocket(c *gin.Context) {
-    // Extract and validate JWT token from Authorization header
-    tokenString := c.GetHeader("Authorization")
-    if tokenString == "" {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header missing"})
+// SendNotification sends a notification to the connections of its recipient
+func (h *Hub) SendNotification(notification models.Notification) {
+    eventJSON, err := json.Marshal(Event{Type: EventNotification, Notification: &notification})
+    if err != nil {
+        log.Printf("[ERROR] Failed to marshal %s event: %v", EventNotification, err)
         return
     }
+    h.direct <- userMessage{userID: notification.UserID.Hex(), data: eventJSON}
+}
 
-    // Assuming the token is prefixed with "Bearer "
-    parts := strings.SplitN(tokenString, " ", 2)
-    if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid Authorization header format"})
+func (h *Hub) broadcastEvent(eventType string, post models.Post) {
+    eventJSON, err := json.Marshal(Event{Type: eventType, Post: &post})
+    if err != nil {
+        log.Printf("[ERROR] Failed to marshal %s event: %v", eventType, err)
         return
     }
+    h.broadcast <- eventJSON
+}
 
-    tokenString = parts[1]
+// DisconnectToken closes every connection that was opened with the given token ID
+func (h *Hub) DisconnectToken(tokenID string) {
+    h.disconnect <- func(c *Client) bool { return c.TokenID == tokenID }
+}
 
-    // Parse and verify JWT token
-    userID, err := utils.ValidateJWT(tokenString, h.jwtSecret)
-    if err != nil {
-        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+// DisconnectSession closes every connection opened with a token of the given session
+func (h *Hub) DisconnectSession(sessionID string) {
+    h.disconnect <- func(c *Client) bool { return c.SessionID == sessionID }
+}
+
+// DisconnectUser closes every connection belonging to the given user
+func (h *Hub) DisconnectUser(userID string) {
+    h.disconnect <- func(c *Client) bool { return c.UserID == userID }
+}
+
+// TicketSubprotocol is the WebSocket subprotocol browsers offer, followed by the
+// ticket itself, to authenticate with a ticket instead of a query parameter.
+const TicketSubprotocol = "ticket"
+
+// HandleWebSocket handles incoming WebSocket connections. Browsers authenticate
+// with a ticket from POST /ws/ticket, passed as the `ticket` query parameter or
+// as the subprotocol after "ticket"; other clients can send their access token
+// in the Authorization header.
+func (h *Hub) HandleWebSocket(c *gin.Context) {
+    // Reject cross-site pages before a ticket is spent; clients without an
+    // Origin header are not browsers
+    origin := c.GetHeader("Origin")
+    if !h.checkOrigin(c.Request) {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Origin not allowed"})
         return
     }
 
-    // (Optional) Use userID if needed for further authorization
-    // For example, you can associate the userID with the client for user-specific messages
+    // Authenticate with a ticket or a bearer token, rejecting revoked tokens
+    var claims *utils.Claims
+    var err error
+    if ticket := ticketFromRequest(c.Request); ticket != "" {
+        claims, err = h.auth.AuthenticateTicket(context.Background(), ticket, origin)
+    } else if tokenString := c.GetHeader("Authorization"); tokenString != "" {
+        claims, err = h.auth.Authenticate(context.Background(), tokenString)
+    } else {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Ticket or Authorization header missing"})
+        return
+    }
+    if err != nil {
+        c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid ticket or token"})
+        return
+    }
+    if !claims.HasScope(utils.ScopeWSSubscribe) {
+        c.JSON(http.StatusForbidden, gin.H{"error": "Token is missing required scope", "scope": utils.ScopeWSSubscribe})
+        return
+    }
+    userID := claims.UserID
 
-    // Upgrade to WebSocket
+    // Upgrade to WebSocket, answering the ticket subprotocol without echoing the ticket
     upgrader := websocket.Upgrader{
-        CheckOrigin: func(r *http.Request) bool {
-            // Implement origin checking based on CORS if necessary
-            return true
-        },
+        CheckOrigin:  h.checkOrigin,
+        Subprotocols: []string{TicketSubprotocol},
     }
 
     conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -121,7 +273,7 @@ func (h *Hub) HandleWebSocket(c *gin.Context) {
         return
     }
 
-    client := NewClient(h, conn, userID)
+    client := NewClient(h, conn, userID, claims.Id, claims.SessionID)
     h.register <- client
 
     // Start read and write pumps
@@ -130,3 +282,25 @@ func (h *Hub) HandleWebSocket(c *gin.Context) {
 
     log.Printf("[INFO] New WebSocket connection established: %v (UserID: %s)", conn.RemoteAddr(), userID)
 }
+
+// checkOrigin allows requests without an Origin header and browser requests
+// from the allowed CORS origins
+func (h *Hub) checkOrigin(r *http.Request) bool {
+    origin := r.Header.Get("Origin")
+    return origin == "" || utils.IsAllowedOrigin(origin, h.origins)
+}
+
+// ticketFromRequest returns the ticket from the query string or the subprotocol
+// following TicketSubprotocol
+func ticketFromRequest(r *http.Request) string {
+    if ticket := r.URL.Query().Get("ticket"); ticket != "" {
+        return ticket
+    }
+    protocols := websocket.Subprotocols(r)
+    for i := 0; i < len(protocols)-1; i++ {
+        if protocols[i] == TicketSubprotocol {
+            return protocols[i+1]
+        }
+    }
+    return ""
+}